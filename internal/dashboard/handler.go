@@ -1,6 +1,8 @@
 package dashboard
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"time"
 
@@ -11,16 +13,45 @@ import (
 
 // Handler adalah struct untuk dashboard handlers
 type Handler struct {
-	Limiter limiter.RateLimiter     // Active rate limiter (via manager)
-	Manager *limiter.LimiterManager // Manager for algorithm switching
+	Limiter   limiter.RateLimiter     // Active rate limiter (via manager)
+	Manager   *limiter.LimiterManager // Manager for algorithm switching
+	Storage   storage.Storage         // Backend tempat state limiter disimpan (untuk listing keys)
+	DenyCache *limiter.DenyCache      // Optional; statistik di /deny-cache dan reset ikut menghapus cache
+	Cluster   *limiter.ClusterSync    // Optional; perubahan algoritma/config disebarkan ke semua instance
+}
+
+// Option mengatur konfigurasi opsional NewHandler
+type Option func(*Handler)
+
+// WithDenyCache memakai deny cache yang sama dengan middleware API, sehingga reset dari dashboard
+// langsung berlaku dan statistiknya bisa dibaca di GetDenyCacheStats
+func WithDenyCache(dc *limiter.DenyCache) Option {
+	return func(h *Handler) {
+		h.DenyCache = dc
+		h.Limiter = dc
+	}
+}
+
+// WithClusterSync menyebarkan perubahan algoritma dan config ke semua instance lewat Redis,
+// dan mengaktifkan daftar acknowledgement per instance di GetInstances
+func WithClusterSync(cs *limiter.ClusterSync) Option {
+	return func(h *Handler) {
+		h.Cluster = cs
+	}
 }
 
 // NewHandler membuat instance baru dashboard handler
-func NewHandler(manager *limiter.LimiterManager) *Handler {
-	return &Handler{
+// store harus backend yang sama dengan yang dipakai limiter di manager
+func NewHandler(manager *limiter.LimiterManager, store storage.Storage, opts ...Option) *Handler {
+	h := &Handler{
 		Limiter: manager,
 		Manager: manager,
+		Storage: store,
 	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 // Index menampilkan halaman dashboard utama
@@ -105,31 +136,7 @@ func (h *Handler) ResetKey(c *gin.Context) {
 	hxTarget := c.GetHeader("HX-Target")
 	if hxTarget == "keys-container" {
 		// Request from keys table - return refreshed keys list
-		ctx := c.Request.Context()
-
-		// Get key pattern based on current algorithm
-		var keyPattern string
-		var prefixLen, suffixLen int
-		currentAlgo := h.Manager.GetCurrentAlgorithm()
-		if currentAlgo == "token_bucket" {
-			keyPattern = "token:*:tokens"
-			prefixLen = 6 // "token:"
-			suffixLen = 7 // ":tokens"
-		} else {
-			keyPattern = "bucket:*:water"
-			prefixLen = 7 // "bucket:"
-			suffixLen = 6 // ":water"
-		}
-
-		keys, _ := storage.RedisClient.Keys(ctx, keyPattern).Result()
-		var statuses []*limiter.Status
-		for _, fullKey := range keys {
-			k := fullKey[prefixLen : len(fullKey)-suffixLen]
-			status, err := h.Limiter.GetStatus(ctx, k)
-			if err == nil {
-				statuses = append(statuses, status)
-			}
-		}
+		statuses, _ := h.listStatuses(c.Request.Context())
 		c.HTML(http.StatusOK, "partials/keys.html", gin.H{
 			"keys": statuses,
 		})
@@ -145,24 +152,7 @@ func (h *Handler) ResetKey(c *gin.Context) {
 
 // ListKeys mendapatkan daftar semua keys yang sedang di-track
 func (h *Handler) ListKeys(c *gin.Context) {
-	ctx := c.Request.Context()
-
-	// Get key pattern based on current algorithm
-	var keyPattern string
-	var prefixLen, suffixLen int
-	currentAlgo := h.Manager.GetCurrentAlgorithm()
-	if currentAlgo == "token_bucket" {
-		keyPattern = "token:*:tokens"
-		prefixLen = 6 // "token:"
-		suffixLen = 7 // ":tokens"
-	} else {
-		keyPattern = "bucket:*:water"
-		prefixLen = 7 // "bucket:"
-		suffixLen = 6 // ":water"
-	}
-
-	// Scan untuk keys dengan pattern sesuai algoritma
-	keys, err := storage.RedisClient.Keys(ctx, keyPattern).Result()
+	statuses, err := h.listStatuses(c.Request.Context())
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "partials/keys.html", gin.H{
 			"error": err.Error(),
@@ -170,17 +160,6 @@ func (h *Handler) ListKeys(c *gin.Context) {
 		return
 	}
 
-	// Extract key names dan dapatkan status masing-masing
-	var statuses []*limiter.Status
-	for _, fullKey := range keys {
-		// Extract key dari pattern
-		key := fullKey[prefixLen : len(fullKey)-suffixLen]
-		status, err := h.Limiter.GetStatus(ctx, key)
-		if err == nil {
-			statuses = append(statuses, status)
-		}
-	}
-
 	c.HTML(http.StatusOK, "partials/keys.html", gin.H{
 		"keys": statuses,
 	})
@@ -188,23 +167,7 @@ func (h *Handler) ListKeys(c *gin.Context) {
 
 // ListKeysJSON mendapatkan daftar keys dalam format JSON
 func (h *Handler) ListKeysJSON(c *gin.Context) {
-	ctx := c.Request.Context()
-
-	// Get key pattern based on current algorithm
-	var keyPattern string
-	var prefixLen, suffixLen int
-	currentAlgo := h.Manager.GetCurrentAlgorithm()
-	if currentAlgo == "token_bucket" {
-		keyPattern = "token:*:tokens"
-		prefixLen = 6 // "token:"
-		suffixLen = 7 // ":tokens"
-	} else {
-		keyPattern = "bucket:*:water"
-		prefixLen = 7 // "bucket:"
-		suffixLen = 6 // ":water"
-	}
-
-	keys, err := storage.RedisClient.Keys(ctx, keyPattern).Result()
+	statuses, err := h.listStatuses(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
@@ -212,25 +175,48 @@ func (h *Handler) ListKeysJSON(c *gin.Context) {
 		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"keys": statuses,
+	})
+}
+
+// listStatuses scan Redis untuk keys milik algoritma aktif dan mengembalikan status masing-masing
+func (h *Handler) listStatuses(ctx context.Context) ([]*limiter.Status, error) {
+	// Pattern key (termasuk namespace) ditentukan oleh algoritma aktif
+	keyPattern, extractKey := h.Manager.KeyPattern()
+	if keyPattern == "" {
+		return nil, nil // Algoritma aktif tidak menyimpan key per client yang bisa di-list
+	}
+
+	keys, err := h.Storage.Keys(ctx, keyPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	// Extract key names dan dapatkan status masing-masing
 	var statuses []*limiter.Status
+	seen := make(map[string]bool)
 	for _, fullKey := range keys {
-		key := fullKey[prefixLen : len(fullKey)-suffixLen]
+		key := extractKey(fullKey)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+
 		status, err := h.Limiter.GetStatus(ctx, key)
 		if err == nil {
 			statuses = append(statuses, status)
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"keys": statuses,
-	})
+	return statuses, nil
 }
 
 // TestRequest melakukan request test untuk demo rate limiting
 func (h *Handler) TestRequest(c *gin.Context) {
 	key := c.ClientIP()
 
-	allowed, remaining, err := h.Limiter.Allow(c.Request.Context(), key)
+	result, err := h.Limiter.Allow(c.Request.Context(), key)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "partials/test_result.html", gin.H{
 			"error": err.Error(),
@@ -239,12 +225,53 @@ func (h *Handler) TestRequest(c *gin.Context) {
 	}
 
 	c.HTML(http.StatusOK, "partials/test_result.html", gin.H{
-		"allowed":   allowed,
-		"remaining": remaining,
+		"allowed":   result.Allowed,
+		"remaining": result.Remaining,
 		"key":       key,
 	})
 }
 
+// GetDenyCacheStats mengembalikan statistik deny cache (hit rate, jumlah key) dalam format JSON
+func (h *Handler) GetDenyCacheStats(c *gin.Context) {
+	if h.DenyCache == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "deny cache is not enabled",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, h.DenyCache.Stats())
+}
+
+// GetInstances mengembalikan versi config yang sudah di-acknowledge tiap instance dalam format JSON
+func (h *Handler) GetInstances(c *gin.Context) {
+	if h.Cluster == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "cluster sync is not enabled",
+		})
+		return
+	}
+
+	instances, version, err := h.Cluster.Instances(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	converged := true
+	for _, instance := range instances {
+		if !instance.UpToDate && !instance.Stale {
+			converged = false
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"version":   version,
+		"converged": converged, // Semua instance yang masih hidup sudah menerapkan versi terakhir
+		"instances": instances,
+	})
+}
+
 // GetAlgorithm returns the current algorithm info as JSON
 func (h *Handler) GetAlgorithm(c *gin.Context) {
 	info := h.Manager.GetAlgorithmInfo() // Get algorithm details from manager
@@ -252,15 +279,19 @@ func (h *Handler) GetAlgorithm(c *gin.Context) {
 }
 
 // SetAlgorithm switches to a different rate limiting algorithm
+// With carry_state=true the usage of every active key is carried over to the new algorithm
 func (h *Handler) SetAlgorithm(c *gin.Context) {
-	algorithm := c.PostForm("algorithm") // Get algorithm name from form
+	algorithm := c.PostForm("algorithm")              // Get algorithm name from form
+	carryState := c.PostForm("carry_state") == "true" // Optional state conversion
 	if algorithm == "" {
 		// Try JSON body as fallback
 		var req struct {
-			Algorithm string `json:"algorithm"`
+			Algorithm  string `json:"algorithm"`
+			CarryState bool   `json:"carry_state"`
 		}
 		if err := c.BindJSON(&req); err == nil {
 			algorithm = req.Algorithm
+			carryState = req.CarryState
 		}
 	}
 
@@ -272,11 +303,24 @@ func (h *Handler) SetAlgorithm(c *gin.Context) {
 		return
 	}
 
-	// Attempt to switch algorithm via manager
-	if !h.Manager.SetAlgorithm(algorithm) {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "invalid algorithm",
-			"valid": []string{"leaky_bucket", "token_bucket"},
+	// Attempt to switch algorithm via cluster sync (all instances) or manager (this instance only)
+	var err error
+	switch {
+	case h.Cluster != nil:
+		err = h.Cluster.SetAlgorithm(c.Request.Context(), algorithm, carryState)
+	case carryState:
+		err = h.Manager.SetAlgorithmWithState(c.Request.Context(), algorithm)
+	default:
+		err = h.Manager.SetAlgorithm(algorithm)
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, limiter.ErrUnknownAlgorithm) || errors.Is(err, limiter.ErrStateNotConvertible) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+			"valid": h.Manager.Algorithms(),
 		})
 		return
 	}
@@ -287,8 +331,70 @@ func (h *Handler) SetAlgorithm(c *gin.Context) {
 	c.JSON(http.StatusOK, info)
 }
 
+// UpdateConfig mengubah capacity, rate dan TTL algoritma secara live (default: algoritma aktif).
+// Field yang tidak dikirim tetap memakai nilai saat ini; "rate" mengikuti "rate_name" di GetAlgorithm.
+func (h *Handler) UpdateConfig(c *gin.Context) {
+	var req struct {
+		Algorithm  string   `form:"algorithm" json:"algorithm"`
+		Capacity   *float64 `form:"capacity" json:"capacity"`
+		Rate       *float64 `form:"rate" json:"rate"`
+		TTLSeconds *float64 `form:"ttl_seconds" json:"ttl_seconds"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if req.Algorithm == "" {
+		req.Algorithm = h.Manager.GetCurrentAlgorithm()
+	}
+
+	// Mulai dari config saat ini agar update parsial tidak mengubah field lain
+	cfg, err := h.Manager.Config(req.Algorithm)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+			"valid": h.Manager.Algorithms(),
+		})
+		return
+	}
+	if req.Capacity != nil {
+		cfg.Capacity = *req.Capacity
+	}
+	if req.Rate != nil {
+		cfg.Rate = *req.Rate
+	}
+	if req.TTLSeconds != nil {
+		cfg.TTL = time.Duration(*req.TTLSeconds * float64(time.Second))
+	}
+
+	update := h.Manager.UpdateConfig
+	if h.Cluster != nil {
+		update = h.Cluster.UpdateConfig // Juga disebarkan ke instance lain
+	}
+	if err := update(c.Request.Context(), req.Algorithm, cfg); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, limiter.ErrInvalidConfig) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"algorithm":   req.Algorithm,
+		"capacity":    cfg.Capacity,
+		"rate":        cfg.Rate,
+		"ttl_seconds": cfg.TTL.Seconds(),
+		"message":     "Config updated successfully",
+	})
+}
+
 // TestRequestJSON processes a test request and returns detailed JSON for activity logging
-// Returns before/after values, refill/leak amounts, and result for transparency
+// Returns before/after values, refill/leak amounts, retry/reset times and result for transparency
 func (h *Handler) TestRequestJSON(c *gin.Context) {
 	key := c.ClientIP() // Get client IP as the rate limit key
 
@@ -301,53 +407,52 @@ func (h *Handler) TestRequestJSON(c *gin.Context) {
 	beforeValue := beforeStatus.Remaining // Store value before request
 
 	// Process the actual request through rate limiter
-	allowed, remaining, err := h.Limiter.Allow(c.Request.Context(), key)
+	result, err := h.Limiter.Allow(c.Request.Context(), key)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Get current algorithm name
-	algorithm := h.Manager.GetCurrentAlgorithm()
+	// Units consumed by this request (0 when denied - scripts leave state untouched)
+	consumed := 0.0
+	if result.Allowed {
+		consumed = 1
+	}
+
+	// Capacity regained between the status read and the decision:
+	// after = before + regained - consumed, with both values reported by Redis
+	regained := result.Remaining - beforeValue + consumed
+	if regained < 0 {
+		regained = 0 // Another client consumed in between
+	}
 
-	// Calculate refill/leak amount based on algorithm
-	// For Token Bucket: refilled = beforeValue - initialCapacity + consumed + afterValue
-	// For Leaky Bucket: leaked = beforeValue + added - afterValue
 	var refilled, leaked float64
-	if algorithm == "token_bucket" {
-		// Before request, tokens might have refilled since last action
-		// After request, 1 token consumed
-		// refilled ≈ what was gained between last action and now
-		refilled = beforeValue - remaining - 1 // Approximate refill during this cycle
-		if refilled < 0 {
-			refilled = 0
-		}
-	} else {
-		// Leaky bucket: water drains over time
-		// leaked ≈ beforeValue + 1 - remaining (1 added from this request)
-		leaked = beforeValue + 1 - remaining
-		if leaked < 0 {
-			leaked = 0
-		}
+	switch result.Algorithm {
+	case limiter.AlgorithmTokenBucket:
+		refilled = regained // Tokens added by refill
+	case limiter.AlgorithmLeakyBucket:
+		leaked = regained // Water drained from the bucket
 	}
 
 	// Determine result string
-	result := "allowed"
-	if !allowed {
-		result = "denied"
+	resultText := "allowed"
+	if !result.Allowed {
+		resultText = "denied"
 	}
 
 	// Return detailed response for activity log
 	c.JSON(http.StatusOK, gin.H{
-		"allowed":   allowed,
-		"result":    result,
-		"key":       key,
-		"algorithm": algorithm,
-		"before":    beforeValue, // Value before this request
-		"after":     remaining,   // Value after this request
-		"refilled":  refilled,    // Tokens refilled (token bucket)
-		"leaked":    leaked,      // Water leaked (leaky bucket)
-		"capacity":  beforeStatus.Capacity,
-		"time":      time.Now().Format("15:04:05"), // HH:MM:SS format
+		"allowed":     result.Allowed,
+		"result":      resultText,
+		"key":         key,
+		"algorithm":   result.Algorithm,
+		"before":      beforeValue,      // Value before this request
+		"after":       result.Remaining, // Value after this request
+		"refilled":    refilled,         // Tokens refilled (token bucket)
+		"leaked":      leaked,           // Water leaked (leaky bucket)
+		"capacity":    result.Limit,
+		"retry_after": result.RetryAfter.Seconds(), // Seconds until the request would be allowed
+		"reset_at":    result.ResetAt.Format("15:04:05"),
+		"time":        time.Now().Format("15:04:05"), // HH:MM:SS format
 	})
 }
@@ -0,0 +1,100 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/user/Rate-Limiting-API/internal/limiter"
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+// setupConfigRouter membuat router dengan endpoint config di atas manager berbasis memory
+func setupConfigRouter(t *testing.T) (*gin.Engine, *limiter.LimiterManager) {
+	store := storage.NewMemoryStorage(0)
+	t.Cleanup(func() { store.Close() })
+
+	manager := limiter.NewLimiterManager(
+		limiter.NewLeakyBucket(10, 1, time.Hour, limiter.WithStorage(store)),
+		limiter.NewTokenBucket(10, 1, time.Hour, limiter.WithStorage(store)),
+		limiter.AlgorithmLeakyBucket)
+	h := NewHandler(manager, store)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/dashboard/config", h.UpdateConfig)
+	return r, manager
+}
+
+// postConfig mengirim body JSON ke endpoint config dan mengembalikan status dan response
+func postConfig(r *gin.Engine, body string) (int, map[string]interface{}) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/dashboard/config", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	var resp map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func TestUpdateConfig_Valid(t *testing.T) {
+	r, manager := setupConfigRouter(t)
+
+	code, resp := postConfig(r, `{"algorithm": "token_bucket", "capacity": 20, "rate": 5}`)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "token_bucket", resp["algorithm"])
+	assert.Equal(t, 3600.0, resp["ttl_seconds"]) // Field yang tidak dikirim tetap
+
+	cfg, err := manager.Config(limiter.AlgorithmTokenBucket)
+	assert.NoError(t, err)
+	assert.Equal(t, limiter.Config{Capacity: 20, Rate: 5, TTL: time.Hour}, cfg)
+}
+
+func TestUpdateConfig_DefaultsToActiveAlgorithm(t *testing.T) {
+	r, manager := setupConfigRouter(t)
+
+	code, _ := postConfig(r, `{"ttl_seconds": 60}`)
+
+	assert.Equal(t, http.StatusOK, code)
+	cfg, err := manager.Config(limiter.AlgorithmLeakyBucket)
+	assert.NoError(t, err)
+	assert.Equal(t, limiter.Config{Capacity: 10, Rate: 1, TTL: time.Minute}, cfg)
+}
+
+func TestUpdateConfig_Invalid(t *testing.T) {
+	r, manager := setupConfigRouter(t)
+
+	for _, body := range []string{
+		`{"capacity": 0}`,
+		`{"rate": -1}`,
+		`{"ttl_seconds": -5}`,
+		`{"capacity": "banyak"}`,
+		`not json`,
+	} {
+		code, resp := postConfig(r, body)
+		assert.Equal(t, http.StatusBadRequest, code, body)
+		assert.NotEmpty(t, resp["error"], body)
+	}
+
+	// Tidak ada yang berubah
+	cfg, err := manager.Config(limiter.AlgorithmLeakyBucket)
+	assert.NoError(t, err)
+	assert.Equal(t, limiter.Config{Capacity: 10, Rate: 1, TTL: time.Hour}, cfg)
+}
+
+func TestUpdateConfig_UnknownAlgorithm(t *testing.T) {
+	r, _ := setupConfigRouter(t)
+
+	code, resp := postConfig(r, `{"algorithm": "magic", "capacity": 5}`)
+
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, resp["error"], "magic")
+	assert.ElementsMatch(t, []interface{}{"leaky_bucket", "token_bucket"}, resp["valid"])
+}
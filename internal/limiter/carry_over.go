@@ -0,0 +1,177 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+var (
+	// ErrUnknownAlgorithm is returned by SetAlgorithm and SetAlgorithmWithState for a name that is not registered
+	ErrUnknownAlgorithm = errors.New("limiter: unknown algorithm")
+
+	// ErrStateNotConvertible is returned by SetAlgorithmWithState when the state of the active
+	// algorithm cannot be listed or the new algorithm cannot take it over
+	ErrStateNotConvertible = errors.New("limiter: state cannot be carried over")
+)
+
+// usageSetter is implemented by limiters that can take over another algorithm's state.
+// used is the fraction of capacity the client has used (0 = idle, 1 = full, more = queued).
+type usageSetter interface {
+	setUsage(ctx context.Context, key string, used float64) error
+}
+
+var (
+	_ usageSetter = (*LeakyBucket)(nil)
+	_ usageSetter = (*TokenBucket)(nil)
+	_ usageSetter = (*GCRA)(nil)
+)
+
+// leaseReturner is implemented by limiters that hold tokens outside the storage
+type leaseReturner interface {
+	ReturnLeases(ctx context.Context) error
+}
+
+// carryOver copies the usage of every client of from into to.
+// Usage is read with GetStatus as Current / Capacity, so a client that is throttled
+// in from is just as throttled in to, whatever the two capacities are.
+func carryOver(ctx context.Context, from, to RateLimiter) error {
+	lister, ok := from.(KeyLister)
+	if !ok {
+		return fmt.Errorf("%w: active algorithm does not list its keys", ErrStateNotConvertible)
+	}
+	setter, ok := to.(usageSetter)
+	if !ok {
+		return fmt.Errorf("%w: new algorithm cannot take over usage", ErrStateNotConvertible)
+	}
+
+	// Leased tokens must be back in the storage before usage is read (from)
+	// and must not be returned on top of the new state later (to)
+	for _, rl := range []RateLimiter{from, to} {
+		if lr, ok := rl.(leaseReturner); ok {
+			if err := lr.ReturnLeases(ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, extract := lister.KeyPattern()
+	seen := make(map[string]bool)
+	return forEachKey(ctx, keyStore(from), lister, func(storageKey string) error {
+		key := extract(storageKey)
+		if key == "" || seen[key] {
+			return nil
+		}
+		seen[key] = true
+
+		status, err := from.GetStatus(ctx, key)
+		if err != nil {
+			return err
+		}
+		used := 0.0
+		if status.Capacity > 0 {
+			used = status.Current / status.Capacity
+		}
+		return setter.setUsage(ctx, key, used)
+	})
+}
+
+// forEachKey runs fn for the storage key of every client listed by lister.
+// All keys are attempted; the first error is returned.
+func forEachKey(ctx context.Context, store storage.Storage, lister KeyLister, fn func(storageKey string) error) error {
+	pattern, _ := lister.KeyPattern()
+	keys, err := store.Keys(ctx, pattern)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, storageKey := range keys {
+		if err := fn(storageKey); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// keyStore returns the storage holding the keys of a built-in limiter
+func keyStore(rl RateLimiter) storage.Storage {
+	if s, ok := rl.(interface{ store() storage.Storage }); ok {
+		return s.store()
+	}
+	return storage.Default()
+}
+
+// setBucketScript replaces a bucket hash
+// KEYS[1] = bucket key, ARGV[1] = TTL (ms, 0 = no expiry), ARGV[2..] = field, value pairs
+var setBucketScript = storage.NewScript(`
+local ttl = tonumber(ARGV[1])
+redis.call('DEL', KEYS[1])
+for i = 2, #ARGV, 2 do
+  redis.call('HSET', KEYS[1], ARGV[i], ARGV[i + 1])
+end
+if ttl > 0 then
+  redis.call('PEXPIRE', KEYS[1], ttl)
+else
+  redis.call('PERSIST', KEYS[1])
+end
+return {1}
+`).WithLocal(setBucketLocal)
+
+// setBucketLocal is the Go version of setBucketScript for storages without Lua
+func setBucketLocal(tx storage.Tx, keys []string, args []interface{}) ([]interface{}, error) {
+	ttl := time.Duration(argFloat(args[0])) * time.Millisecond
+	fields := make(map[string]string)
+	for i := 1; i+1 < len(args); i += 2 {
+		fields[args[i].(string)] = args[i+1].(string)
+	}
+	tx.Del(keys[0])
+	tx.HSet(keys[0], fields, ttl)
+	return []interface{}{int64(1)}, nil
+}
+
+// setUsage fills the bucket with used * Capacity water
+func (lb *LeakyBucket) setUsage(ctx context.Context, key string, used float64) error {
+	water := math.Max(0, used) * lb.Capacity
+	_, err := lb.store().Eval(ctx, setBucketScript, []string{lb.bucketKey(key)}, lb.TTL.Milliseconds(),
+		"water", formatNumber(water), "time", formatNumber(float64(lb.now().UnixMilli())), "rate", formatNumber(lb.LeakRate))
+	return err
+}
+
+// setUsage leaves (1 - used) * Capacity tokens in the bucket
+func (tb *TokenBucket) setUsage(ctx context.Context, key string, used float64) error {
+	tokens := math.Max(0, 1-used) * tb.Capacity
+	_, err := tb.store().Eval(ctx, setBucketScript, []string{tb.bucketKey(key)}, tb.TTL.Milliseconds(),
+		"tokens", formatNumber(tokens), "time", formatNumber(float64(tb.now().UnixMilli())),
+		"capacity", formatNumber(tb.Capacity), "rate", formatNumber(tb.RefillRate))
+	return err
+}
+
+// setTATScript overwrites a GCRA TAT
+// KEYS[1] = TAT key, ARGV[1] = value (see formatTAT), ARGV[2] = TTL (ms)
+var setTATScript = storage.NewScript(`
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return {1}
+`).WithLocal(setTATLocal)
+
+// setTATLocal is the Go version of setTATScript for storages without Lua
+func setTATLocal(tx storage.Tx, keys []string, args []interface{}) ([]interface{}, error) {
+	tx.Set(keys[0], args[0].(string), time.Duration(argFloat(args[1]))*time.Millisecond)
+	return []interface{}{int64(1)}, nil
+}
+
+// setUsage moves the TAT used * Capacity emission intervals ahead of now
+func (g *GCRA) setUsage(ctx context.Context, key string, used float64) error {
+	backlog := math.Max(0, used) * g.Capacity * g.emissionInterval()
+	if backlog <= 0 {
+		return g.store().Del(ctx, g.tatKey(key)) // Idle = no TAT
+	}
+	now := float64(g.now().UnixMilli())
+	_, err := g.store().Eval(ctx, setTATScript, []string{g.tatKey(key)},
+		formatTAT(now+backlog, g.Rate), int64(math.Ceil(backlog)))
+	return err
+}
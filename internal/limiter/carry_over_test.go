@@ -0,0 +1,137 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+func TestLimiterManager_SetAlgorithmWithState_KeepsClientsThrottled(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	leaky := NewLeakyBucket(10, 1, time.Hour, WithStorage(store))
+	token := NewTokenBucket(20, 1, time.Hour, WithStorage(store))
+	m := NewLimiterManager(leaky, token, AlgorithmLeakyBucket, WithClock(clk))
+
+	_, err := m.AllowN(ctx, "full", 10)
+	assert.NoError(t, err)
+	_, err = m.AllowN(ctx, "half", 5)
+	assert.NoError(t, err)
+
+	assert.NoError(t, m.SetAlgorithmWithState(ctx, AlgorithmTokenBucket))
+	assert.Equal(t, AlgorithmTokenBucket, m.GetCurrentAlgorithm())
+
+	// Usage is scaled to the new capacity: full stays full, half stays half
+	result, err := m.Allow(ctx, "full")
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	status, err := m.GetStatus(ctx, "half")
+	assert.NoError(t, err)
+	assert.Equal(t, 10.0, status.Remaining)
+
+	// And back: 10 of 20 tokens used = half a leaky bucket
+	assert.NoError(t, m.SetAlgorithmWithState(ctx, AlgorithmLeakyBucket))
+	status, err = m.GetStatus(ctx, "half")
+	assert.NoError(t, err)
+	assert.Equal(t, 5.0, status.Current)
+}
+
+func TestLimiterManager_SetAlgorithmWithState_ReturnsLeases(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	leaky := NewLeakyBucket(10, 1, time.Hour, WithStorage(store))
+	token := NewLeasingTokenBucket(10, 1, time.Hour, 5, time.Minute, WithStorage(store))
+	defer token.Close()
+	m := NewLimiterManager(leaky, token, AlgorithmTokenBucket, WithClock(clk))
+
+	// One token spent, four more leased locally
+	_, err := m.Allow(ctx, "k")
+	assert.NoError(t, err)
+
+	assert.NoError(t, m.SetAlgorithmWithState(ctx, AlgorithmLeakyBucket))
+	status, err := m.GetStatus(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, status.Current)
+}
+
+func TestLimiterManager_SetAlgorithmWithState_ToGCRA(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	leaky := NewLeakyBucket(10, 1, time.Hour, WithStorage(store))
+	m := NewLimiterManager(leaky, NewTokenBucket(10, 1, time.Hour), AlgorithmLeakyBucket, WithClock(clk))
+	m.SetGCRA(NewGCRA(4, 2, WithStorage(store)))
+
+	_, err := m.AllowN(ctx, "k", 5)
+	assert.NoError(t, err)
+
+	assert.NoError(t, m.SetAlgorithmWithState(ctx, AlgorithmGCRA))
+	assert.Equal(t, AlgorithmGCRA, m.GetCurrentAlgorithm())
+
+	// Half of a burst of 4 at 500ms per request = TAT 1 second ahead
+	tat, err := store.Get(ctx, "gcra:{k}")
+	assert.NoError(t, err)
+	assert.Equal(t, formatTAT(float64(testEpoch.UnixMilli()+1000), 2), tat)
+}
+
+// blockingKeysStorage holds Keys until release is closed
+type blockingKeysStorage struct {
+	storage.Storage
+	listing chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingKeysStorage) Keys(ctx context.Context, pattern string) ([]string, error) {
+	close(s.listing)
+	<-s.release
+	return s.Storage.Keys(ctx, pattern)
+}
+
+func TestLimiterManager_SetAlgorithmWithState_ServesWhileCopying(t *testing.T) {
+	mem := storage.NewMemoryStorage(0)
+	defer mem.Close()
+	store := &blockingKeysStorage{Storage: mem, listing: make(chan struct{}), release: make(chan struct{})}
+	clk := NewManualClock(testEpoch)
+	leaky := NewLeakyBucket(10, 1, time.Hour, WithStorage(store))
+	token := NewTokenBucket(10, 1, time.Hour, WithStorage(store))
+	m := NewLimiterManager(leaky, token, AlgorithmLeakyBucket, WithClock(clk))
+
+	_, err := m.AllowN(ctx, "k", 10)
+	assert.NoError(t, err)
+
+	done := make(chan error)
+	go func() { done <- m.SetAlgorithmWithState(ctx, AlgorithmTokenBucket) }()
+	<-store.listing
+
+	// The old algorithm keeps answering while keys are listed
+	result, err := m.Allow(ctx, "other")
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, AlgorithmLeakyBucket, result.Algorithm)
+
+	close(store.release)
+	assert.NoError(t, <-done)
+	assert.Equal(t, AlgorithmTokenBucket, m.GetCurrentAlgorithm())
+	status, err := m.GetStatus(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, status.Remaining)
+}
+
+func TestLimiterManager_SetAlgorithmWithState_Rejected(t *testing.T) {
+	m := NewLimiterManager(NewLeakyBucket(10, 1, time.Hour), NewTokenBucket(10, 1, time.Hour), AlgorithmLeakyBucket)
+	m.Register(Algorithm{Name: "custom", Limiter: &scriptedLimiter{}})
+
+	assert.ErrorIs(t, m.SetAlgorithmWithState(ctx, "unknown"), ErrUnknownAlgorithm)
+	assert.ErrorIs(t, m.SetAlgorithmWithState(ctx, "custom"), ErrStateNotConvertible)
+	assert.Equal(t, AlgorithmLeakyBucket, m.GetCurrentAlgorithm())
+
+	// The custom limiter cannot list its keys either
+	assert.NoError(t, m.SetAlgorithm("custom"))
+	assert.ErrorIs(t, m.SetAlgorithmWithState(ctx, AlgorithmLeakyBucket), ErrStateNotConvertible)
+	assert.Equal(t, "custom", m.GetCurrentAlgorithm())
+}
@@ -0,0 +1,150 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by CircuitBreaker while the backend is considered down
+var ErrCircuitOpen = errors.New("limiter: circuit breaker open")
+
+// Circuit breaker states reported by CircuitBreaker.State
+const (
+	CircuitClosed   = "closed"    // Calls go to the wrapped limiter
+	CircuitOpen     = "open"      // Calls fail fast with ErrCircuitOpen
+	CircuitHalfOpen = "half_open" // One probe call is in flight to test recovery
+)
+
+// Ensure CircuitBreaker implements RateLimiter interface
+var _ RateLimiter = (*CircuitBreaker)(nil)
+
+// CircuitBreaker wraps a RateLimiter and stops calling it after repeated backend errors.
+// After Threshold consecutive failures the circuit opens and every call returns ErrCircuitOpen
+// without touching Redis. Once Cooldown has passed a single probe call is let through:
+// success closes the circuit, failure re-opens it for another Cooldown.
+// Only backend errors count: denied requests, ErrInvalidCost and context.Canceled are not failures.
+type CircuitBreaker struct {
+	Limiter   RateLimiter   // Wrapped limiter (usually Redis-backed)
+	Threshold int           // Consecutive failures that open the circuit
+	Cooldown  time.Duration // How long the circuit stays open before probing
+	Clock     Clock
+
+	mu       sync.Mutex
+	state    string
+	failures int       // Consecutive failures while closed
+	openedAt time.Time // When the circuit last opened
+}
+
+// NewCircuitBreaker wraps rl with a circuit breaker
+func NewCircuitBreaker(rl RateLimiter, threshold int, cooldown time.Duration, opts ...Option) *CircuitBreaker {
+	o := applyOptions(opts)
+	return &CircuitBreaker{
+		Limiter:   rl,
+		Threshold: threshold,
+		Cooldown:  cooldown,
+		Clock:     o.clock,
+		state:     CircuitClosed,
+	}
+}
+
+// now returns the current time from the configured clock
+func (cb *CircuitBreaker) now() time.Time {
+	return nowFrom(cb.Clock)
+}
+
+// State returns the current circuit state (CircuitClosed, CircuitOpen or CircuitHalfOpen)
+func (cb *CircuitBreaker) State() string {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+// before decides whether a call may reach the wrapped limiter
+func (cb *CircuitBreaker) before() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		if cb.now().Sub(cb.openedAt) < cb.Cooldown {
+			return ErrCircuitOpen
+		}
+		cb.state = CircuitHalfOpen // This call is the probe
+		return nil
+	case CircuitHalfOpen:
+		return ErrCircuitOpen // Only one probe at a time
+	default:
+		return nil
+	}
+}
+
+// after records the outcome of a call that reached the wrapped limiter
+func (cb *CircuitBreaker) after(err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if err == nil {
+		cb.state = CircuitClosed
+		cb.failures = 0
+		return
+	}
+	if !isBackendFailure(err) {
+		// The call never proved anything about the backend; let the next call probe again
+		if cb.state == CircuitHalfOpen {
+			cb.state = CircuitOpen
+		}
+		return
+	}
+
+	cb.failures++
+	if cb.state == CircuitHalfOpen || cb.failures >= cb.Threshold {
+		cb.state = CircuitOpen
+		cb.openedAt = cb.now()
+		cb.failures = 0
+	}
+}
+
+// isBackendFailure reports whether err means the backend is unhealthy.
+// Invalid input and callers giving up are not the backend's fault.
+func isBackendFailure(err error) bool {
+	return err != nil &&
+		!errors.Is(err, ErrInvalidCost) &&
+		!errors.Is(err, context.Canceled)
+}
+
+// Allow checks a single request through the breaker
+func (cb *CircuitBreaker) Allow(ctx context.Context, key string) (*Result, error) {
+	return cb.AllowN(ctx, key, 1)
+}
+
+// AllowN checks a request of cost n through the breaker
+func (cb *CircuitBreaker) AllowN(ctx context.Context, key string, n int64) (*Result, error) {
+	if err := cb.before(); err != nil {
+		return nil, err
+	}
+	result, err := cb.Limiter.AllowN(ctx, key, n)
+	cb.after(err)
+	return result, err
+}
+
+// Reset clears the key's state through the breaker
+func (cb *CircuitBreaker) Reset(ctx context.Context, key string) error {
+	if err := cb.before(); err != nil {
+		return err
+	}
+	err := cb.Limiter.Reset(ctx, key)
+	cb.after(err)
+	return err
+}
+
+// GetStatus reads the key's status through the breaker
+func (cb *CircuitBreaker) GetStatus(ctx context.Context, key string) (*Status, error) {
+	if err := cb.before(); err != nil {
+		return nil, err
+	}
+	status, err := cb.Limiter.GetStatus(ctx, key)
+	cb.after(err)
+	return status, err
+}
@@ -0,0 +1,123 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyLimiter is a RateLimiter stub that fails while err is set and counts calls
+type flakyLimiter struct {
+	err   error
+	calls int
+}
+
+func (f *flakyLimiter) Allow(ctx context.Context, key string) (*Result, error) {
+	return f.AllowN(ctx, key, 1)
+}
+
+func (f *flakyLimiter) AllowN(ctx context.Context, key string, n int64) (*Result, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &Result{Allowed: true}, nil
+}
+
+func (f *flakyLimiter) Reset(ctx context.Context, key string) error {
+	f.calls++
+	return f.err
+}
+
+func (f *flakyLimiter) GetStatus(ctx context.Context, key string) (*Status, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &Status{Key: key}, nil
+}
+
+func TestCircuitBreaker_OpensAfterThreshold(t *testing.T) {
+	backend := &flakyLimiter{err: errors.New("connection refused")}
+	cb := NewCircuitBreaker(backend, 3, time.Second, WithClock(NewManualClock(testEpoch)))
+
+	for i := 0; i < 3; i++ {
+		_, err := cb.Allow(ctx, "k")
+		assert.EqualError(t, err, "connection refused")
+	}
+	assert.Equal(t, CircuitOpen, cb.State())
+
+	// Open circuit fails fast without calling the backend
+	_, err := cb.Allow(ctx, "k")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.ErrorIs(t, cb.Reset(ctx, "k"), ErrCircuitOpen)
+	assert.Equal(t, 3, backend.calls)
+}
+
+func TestCircuitBreaker_SuccessResetsFailureCount(t *testing.T) {
+	backend := &flakyLimiter{err: errors.New("connection refused")}
+	cb := NewCircuitBreaker(backend, 2, time.Second)
+
+	_, _ = cb.Allow(ctx, "k")
+	backend.err = nil
+	_, _ = cb.Allow(ctx, "k")
+	backend.err = errors.New("connection refused")
+	_, _ = cb.Allow(ctx, "k")
+
+	// Failures were not consecutive
+	assert.Equal(t, CircuitClosed, cb.State())
+}
+
+func TestCircuitBreaker_ProbeClosesOnRecovery(t *testing.T) {
+	clk := NewManualClock(testEpoch)
+	backend := &flakyLimiter{err: errors.New("connection refused")}
+	cb := NewCircuitBreaker(backend, 1, time.Second, WithClock(clk))
+
+	_, _ = cb.Allow(ctx, "k")
+	assert.Equal(t, CircuitOpen, cb.State())
+
+	clk.Advance(time.Second)
+	backend.err = nil
+
+	result, err := cb.Allow(ctx, "k")
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, CircuitClosed, cb.State())
+}
+
+func TestCircuitBreaker_FailedProbeReopens(t *testing.T) {
+	clk := NewManualClock(testEpoch)
+	backend := &flakyLimiter{err: errors.New("connection refused")}
+	cb := NewCircuitBreaker(backend, 1, time.Second, WithClock(clk))
+
+	_, _ = cb.Allow(ctx, "k")
+	clk.Advance(time.Second)
+
+	_, err := cb.GetStatus(ctx, "k")
+	assert.EqualError(t, err, "connection refused")
+	assert.Equal(t, CircuitOpen, cb.State())
+	assert.Equal(t, 2, backend.calls)
+
+	// Cooldown starts again from the failed probe
+	clk.Advance(500 * time.Millisecond)
+	_, err = cb.Allow(ctx, "k")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, 2, backend.calls)
+}
+
+func TestCircuitBreaker_IgnoresNonBackendErrors(t *testing.T) {
+	backend := &flakyLimiter{err: ErrInvalidCost}
+	cb := NewCircuitBreaker(backend, 1, time.Second)
+
+	_, err := cb.AllowN(ctx, "k", 0)
+	assert.ErrorIs(t, err, ErrInvalidCost)
+
+	backend.err = context.Canceled
+	_, err = cb.Allow(ctx, "k")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	assert.Equal(t, CircuitClosed, cb.State())
+}
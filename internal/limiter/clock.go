@@ -0,0 +1,134 @@
+package limiter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+// Clock adalah sumber waktu untuk semua perhitungan limiter.
+// Default-nya waktu sistem; gunakan ManualClock di test atau RedisClock
+// agar semua instance API memakai jam yang sama.
+type Clock interface {
+	Now() time.Time
+}
+
+// Pastikan semua implementasi memenuhi Clock interface
+var (
+	_ Clock = SystemClock{}
+	_ Clock = (*ManualClock)(nil)
+	_ Clock = (*RedisClock)(nil)
+)
+
+// nowFrom mengembalikan waktu dari clock, atau waktu sistem jika clock nil
+func nowFrom(c Clock) time.Time {
+	if c == nil {
+		return time.Now()
+	}
+	return c.Now()
+}
+
+// SystemClock memakai waktu lokal mesin (time.Now)
+type SystemClock struct{}
+
+// Now mengembalikan waktu sistem
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ManualClock adalah clock yang hanya bergerak jika dimajukan secara manual.
+// Berguna untuk test refill/leak tanpa sleep.
+type ManualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewManualClock membuat ManualClock yang dimulai pada waktu t
+func NewManualClock(t time.Time) *ManualClock {
+	return &ManualClock{now: t}
+}
+
+// Now mengembalikan waktu saat ini dari clock
+func (mc *ManualClock) Now() time.Time {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.now
+}
+
+// Advance memajukan clock sebanyak d
+func (mc *ManualClock) Advance(d time.Duration) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.now = mc.now.Add(d)
+}
+
+// Set mengubah waktu clock menjadi t
+func (mc *ManualClock) Set(t time.Time) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.now = t
+}
+
+// redisClockTimeout membatasi durasi sinkronisasi TIME yang dipicu oleh Now
+const redisClockTimeout = time.Second
+
+// RedisClock memakai jam server Redis (perintah TIME) sebagai sumber waktu,
+// sehingga instance API dengan jam lokal yang berbeda tetap menghitung leak/refill yang sama.
+// Agar tidak menambah round trip di setiap request, RedisClock menyimpan selisih
+// jam Redis dengan jam lokal dan hanya sinkron ulang setiap SyncInterval.
+type RedisClock struct {
+	SyncInterval time.Duration   // Interval sinkronisasi ulang (0 = TIME di setiap panggilan Now)
+	Storage      storage.Storage // Backend yang jamnya dipakai (nil = Redis lewat storage.RedisClient)
+
+	mu       sync.Mutex
+	offset   time.Duration // Jam Redis dikurangi jam lokal
+	syncedAt time.Time     // Waktu lokal percobaan sinkronisasi terakhir
+}
+
+// NewRedisClock membuat RedisClock yang sinkron ulang setiap syncInterval
+// (hanya WithStorage yang dipakai dari opts)
+func NewRedisClock(syncInterval time.Duration, opts ...Option) *RedisClock {
+	o := applyOptions(opts)
+	return &RedisClock{SyncInterval: syncInterval, Storage: o.storage}
+}
+
+// Sync membaca TIME dari Redis dan memperbarui selisih jam.
+// Round trip dibagi dua untuk memperkirakan kapan Redis membaca jamnya.
+func (rc *RedisClock) Sync(ctx context.Context) error {
+	start := time.Now()
+	serverTime, err := storeFrom(rc.Storage).Time(ctx)
+	if err != nil {
+		return err
+	}
+	end := time.Now()
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.offset = serverTime.Sub(start.Add(end.Sub(start) / 2))
+	rc.syncedAt = end
+	return nil
+}
+
+// Now mengembalikan waktu lokal yang dikoreksi dengan selisih jam Redis.
+// Jika sinkronisasi gagal, selisih terakhir tetap dipakai (awalnya 0 = jam lokal)
+// dan percobaan berikutnya menunggu SyncInterval agar Redis yang down tidak dibanjiri TIME.
+func (rc *RedisClock) Now() time.Time {
+	rc.mu.Lock()
+	stale := rc.syncedAt.IsZero() || time.Since(rc.syncedAt) >= rc.SyncInterval
+	if stale {
+		rc.syncedAt = time.Now() // Tandai percobaan, juga jika gagal
+	}
+	rc.mu.Unlock()
+
+	if stale {
+		ctx, cancel := context.WithTimeout(context.Background(), redisClockTimeout)
+		_ = rc.Sync(ctx)
+		cancel()
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return time.Now().Add(rc.offset)
+}
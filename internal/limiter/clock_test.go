@@ -0,0 +1,77 @@
+package limiter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+// testEpoch adalah waktu awal ManualClock di test (detik bulat agar timestamp lama dalam detik tetap presisi)
+var testEpoch = time.Unix(1_700_000_000, 0)
+
+func TestManualClock_Advance(t *testing.T) {
+	clk := NewManualClock(testEpoch)
+	assert.Equal(t, testEpoch, clk.Now())
+
+	clk.Advance(1500 * time.Millisecond)
+	assert.Equal(t, testEpoch.Add(1500*time.Millisecond), clk.Now())
+
+	clk.Set(testEpoch)
+	assert.Equal(t, testEpoch, clk.Now())
+}
+
+func TestNowFrom_DefaultsToSystemClock(t *testing.T) {
+	assert.WithinDuration(t, time.Now(), nowFrom(nil), time.Second)
+	assert.Equal(t, testEpoch, nowFrom(NewManualClock(testEpoch)))
+}
+
+func TestRedisClock_UsesServerTimeOffset(t *testing.T) {
+	mock := setupMockRedis()
+
+	// Jam Redis 10 detik di depan jam lokal
+	mock.ExpectTime().SetVal(time.Now().Add(10 * time.Second))
+
+	rc := NewRedisClock(time.Minute)
+	assert.WithinDuration(t, time.Now().Add(10*time.Second), rc.Now(), 100*time.Millisecond)
+
+	// Masih dalam SyncInterval - tidak ada TIME lagi, offset tetap dipakai
+	assert.WithinDuration(t, time.Now().Add(10*time.Second), rc.Now(), 100*time.Millisecond)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRedisClock_SyncErrorFallsBackToLocal(t *testing.T) {
+	mock := setupMockRedis()
+
+	mock.ExpectTime().SetErr(fmt.Errorf("connection refused"))
+
+	rc := NewRedisClock(time.Minute)
+	assert.WithinDuration(t, time.Now(), rc.Now(), 100*time.Millisecond)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRedisClock_WithMemoryStorageUsesLocalTime(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+
+	rc := NewRedisClock(time.Minute, WithStorage(store))
+	assert.WithinDuration(t, time.Now(), rc.Now(), 100*time.Millisecond)
+}
+
+func TestLimiterManager_WithClockAppliesToAllAlgorithms(t *testing.T) {
+	clk := NewManualClock(testEpoch)
+	leaky := NewLeakyBucket(10, 2, time.Hour)
+	token := NewTokenBucket(10, 2, time.Hour)
+	fw := NewFixedWindow(10, time.Minute)
+
+	m := NewLimiterManager(leaky, token, AlgorithmLeakyBucket, WithClock(clk))
+	m.SetFixedWindow(fw)
+
+	assert.Same(t, clk, leaky.Clock)
+	assert.Same(t, clk, token.Clock)
+	assert.Same(t, clk, fw.Clock)
+}
@@ -0,0 +1,377 @@
+package limiter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+// DefaultSyncInterval is how often ClusterSync re-reads the shared state and refreshes its ack
+const DefaultSyncInterval = 30 * time.Second
+
+// ackTTLIntervals is how many intervals an ack is kept without a refresh
+// (an instance shows as stale after 3, see InstanceAck.Stale)
+const ackTTLIntervals = 10
+
+// configFieldPrefix prefixes the per-algorithm parameter fields of the shared state hash
+const configFieldPrefix = "config:"
+
+// ClusterSync keeps a LimiterManager in step with every other instance sharing the same Redis.
+// The active algorithm and the parameters set through it are stored in one Redis hash; each
+// change bumps a version and is broadcast over pub/sub. Every instance applies the stored state
+// and acknowledges the version it reached, which Instances reports for the dashboard. An ack
+// expires after ackTTLIntervals intervals without a refresh, so instances that are gone drop out.
+//
+// State carry-over is applied to stored keys once, by the instance making the change; the others
+// only adopt the result. Parameters are published with the time of the change, so every instance
+// settles keys alike. Missed messages are caught up every Interval.
+//
+// A local change whose publish fails is kept: it stays queued and is published again by the
+// next Sync before the shared state is adopted, so the failed publish never reverts it.
+type ClusterSync struct {
+	Manager    *LimiterManager
+	InstanceID string          // Unique name of this instance in the ack list
+	Interval   time.Duration   // Resync and ack refresh period
+	Clock      Clock           // Time source for ack timestamps (nil = system time)
+	Storage    storage.Storage // State backend (nil = Redis via storage.RedisClient); pub/sub if it is a storage.Subscriber
+	Namespace  string
+
+	mu      sync.Mutex        // Serializes Sync and local changes
+	version int64             // Last state version applied by this instance
+	pending map[string]string // Fields changed here that are not published yet (field -> value)
+}
+
+// publishedConfig is the value of a config field: the parameters and when they changed
+type publishedConfig struct {
+	Config
+	ChangedAt int64 `json:"changed_at"` // Unix ms (0 in fields written by older versions = when adopted)
+}
+
+// InstanceAck is one instance's acknowledgement of the shared state
+type InstanceAck struct {
+	Instance  string    `json:"instance"`
+	Version   int64     `json:"version"`         // Last state version the instance applied
+	Algorithm string    `json:"algorithm"`       // Algorithm active on the instance after applying it
+	Error     string    `json:"error,omitempty"` // Why the state could not be fully applied
+	SeenAt    time.Time `json:"seen_at"`         // Last ack or heartbeat
+	UpToDate  bool      `json:"up_to_date"`      // Applied the current version without error
+	Stale     bool      `json:"stale"`           // No heartbeat for 3 intervals (instance probably gone)
+}
+
+// NewClusterSync creates a ClusterSync for manager; instanceID must be unique across instances
+func NewClusterSync(manager *LimiterManager, instanceID string, opts ...Option) *ClusterSync {
+	o := applyOptions(opts)
+	return &ClusterSync{
+		Manager:    manager,
+		InstanceID: instanceID,
+		Interval:   DefaultSyncInterval,
+		Clock:      o.clock,
+		Storage:    o.storage,
+		Namespace:  o.namespace,
+	}
+}
+
+// now returns the current time from Clock
+func (cs *ClusterSync) now() time.Time {
+	return nowFrom(cs.Clock)
+}
+
+// store returns the state backend
+func (cs *ClusterSync) store() storage.Storage {
+	return storeFrom(cs.Storage)
+}
+
+// stateKey is the hash holding the version, the active algorithm and the parameters
+func (cs *ClusterSync) stateKey() string {
+	return namespacedKey(cs.Namespace, "ratelimit:{config}")
+}
+
+// ackKey holds the ack of one instance (same slot as stateKey)
+func (cs *ClusterSync) ackKey(instance string) string {
+	return namespacedKey(cs.Namespace, "ratelimit:{config}:ack:"+instance)
+}
+
+// channel is the pub/sub channel announcing new versions
+func (cs *ClusterSync) channel() string {
+	return namespacedKey(cs.Namespace, "ratelimit:config")
+}
+
+// publishStateScript stores changed fields, bumps the version and announces it
+// KEYS[1] = state hash, ARGV[1] = channel, ARGV[2..] = field, value pairs
+// Returns: {new version}
+var publishStateScript = storage.NewScript(`
+for i = 2, #ARGV, 2 do
+  redis.call('HSET', KEYS[1], ARGV[i], ARGV[i + 1])
+end
+local version = redis.call('HINCRBY', KEYS[1], 'version', 1)
+redis.call('PUBLISH', ARGV[1], version)
+return {version}
+`).WithLocal(publishStateLocal)
+
+// publishStateLocal is the Go version of publishStateScript for storages without Lua (no pub/sub)
+func publishStateLocal(tx storage.Tx, keys []string, args []interface{}) ([]interface{}, error) {
+	fields := make(map[string]string)
+	for i := 1; i+1 < len(args); i += 2 {
+		fields[args[i].(string)] = args[i+1].(string)
+	}
+	version := int64(1)
+	if val, ok := tx.HGet(keys[0], "version"); ok {
+		current, _ := strconv.ParseInt(val, 10, 64)
+		version = current + 1
+	}
+	fields["version"] = strconv.FormatInt(version, 10)
+	tx.HSet(keys[0], fields, 0)
+	return []interface{}{version}, nil
+}
+
+// ackScript stores one instance's ack
+// KEYS[1] = ack key, ARGV[1] = ack (JSON), ARGV[2] = TTL (ms)
+var ackScript = storage.NewScript(`
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return {1}
+`).WithLocal(ackLocal)
+
+// ackLocal is the Go version of ackScript for storages without Lua
+func ackLocal(tx storage.Tx, keys []string, args []interface{}) ([]interface{}, error) {
+	tx.Set(keys[0], args[0].(string), time.Duration(argFloat(args[1]))*time.Millisecond)
+	return []interface{}{int64(1)}, nil
+}
+
+// SetAlgorithm switches this instance (see LimiterManager.SetAlgorithm and SetAlgorithmWithState)
+// and publishes the new algorithm to every other instance. State is carried over only once, here.
+// If publishing fails the error is returned, but the switch stays in effect and is published by the next Sync.
+func (cs *ClusterSync) SetAlgorithm(ctx context.Context, algorithm string, carryState bool) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	var err error
+	if carryState {
+		err = cs.Manager.SetAlgorithmWithState(ctx, algorithm)
+	} else {
+		err = cs.Manager.SetAlgorithm(algorithm)
+	}
+	if err != nil {
+		return err
+	}
+	return cs.publish(ctx, "algorithm", algorithm)
+}
+
+// UpdateConfig changes the parameters on this instance (see LimiterManager.UpdateConfig) and
+// publishes them, with the time of the change, to every other instance.
+// If publishing fails the error is returned, but the change stays in effect and is published by the next Sync.
+func (cs *ClusterSync) UpdateConfig(ctx context.Context, algorithm string, cfg Config) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	changedAt := cs.now().UnixMilli()
+	if err := cs.Manager.updateConfig(algorithm, cfg, changedAt); err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(publishedConfig{Config: cfg, ChangedAt: changedAt})
+	if err != nil {
+		return err
+	}
+	return cs.publish(ctx, configFieldPrefix+algorithm, string(encoded))
+}
+
+// publish queues one changed field and publishes every queued field; the caller holds cs.mu
+func (cs *ClusterSync) publish(ctx context.Context, field, value string) error {
+	if cs.pending == nil {
+		cs.pending = make(map[string]string)
+	}
+	cs.pending[field] = value
+	return cs.flush(ctx)
+}
+
+// flush stores the queued fields, announces the new version and acks it; the caller holds cs.mu.
+// On error the fields stay queued for the next flush.
+func (cs *ClusterSync) flush(ctx context.Context) error {
+	args := []interface{}{cs.channel()}
+	for field, value := range cs.pending {
+		args = append(args, field, value)
+	}
+	res, err := cs.store().Eval(ctx, publishStateScript, []string{cs.stateKey()}, args...)
+	if err != nil {
+		return err
+	}
+	version, ok := res[0].(int64)
+	if !ok {
+		return fmt.Errorf("unexpected script reply: %v", res)
+	}
+	cs.pending = nil
+	cs.version = version
+	return cs.ack(ctx, nil)
+}
+
+// Sync applies the shared state to this instance and acks the version it reached.
+// Algorithms unknown here are skipped and reported in the ack; the first error is returned.
+// Local changes that failed to publish are published first; while that fails nothing is applied.
+func (cs *ClusterSync) Sync(ctx context.Context) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if len(cs.pending) > 0 {
+		if err := cs.flush(ctx); err != nil {
+			return err
+		}
+	}
+
+	state, err := cs.store().HGetAll(ctx, cs.stateKey())
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	fail := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	// Parameters first, so a new algorithm starts with its published parameters
+	for field, value := range state {
+		name, ok := strings.CutPrefix(field, configFieldPrefix)
+		if !ok {
+			continue
+		}
+		var cfg publishedConfig
+		if err := json.Unmarshal([]byte(value), &cfg); err != nil {
+			fail(fmt.Errorf("%s: %w", field, err))
+			continue
+		}
+		current, err := cs.Manager.Config(name)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		if current != cfg.Config {
+			if err := cs.Manager.updateConfig(name, cfg.Config, cfg.ChangedAt); err != nil {
+				fail(err)
+			}
+		}
+	}
+
+	if algorithm, ok := state["algorithm"]; ok && algorithm != cs.Manager.GetCurrentAlgorithm() {
+		if err := cs.Manager.SetAlgorithm(algorithm); err != nil {
+			fail(err)
+		}
+	}
+
+	if val, ok := state["version"]; ok {
+		cs.version, _ = strconv.ParseInt(val, 10, 64)
+	}
+	if err := cs.ack(ctx, firstErr); err != nil {
+		fail(err)
+	}
+	return firstErr
+}
+
+// ack records the version this instance reached; the caller holds cs.mu
+func (cs *ClusterSync) ack(ctx context.Context, applyErr error) error {
+	entry := InstanceAck{
+		Instance:  cs.InstanceID,
+		Version:   cs.version,
+		Algorithm: cs.Manager.GetCurrentAlgorithm(),
+		SeenAt:    cs.now(),
+	}
+	if applyErr != nil {
+		entry.Error = applyErr.Error()
+	}
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	ttl := ackTTLIntervals * cs.Interval
+	_, err = cs.store().Eval(ctx, ackScript, []string{cs.ackKey(cs.InstanceID)}, string(encoded), ttl.Milliseconds())
+	return err
+}
+
+// Instances returns every instance's ack sorted by name, and the current state version
+func (cs *ClusterSync) Instances(ctx context.Context) ([]InstanceAck, int64, error) {
+	state, err := cs.store().HGetAll(ctx, cs.stateKey())
+	if err != nil {
+		return nil, 0, err
+	}
+	version, _ := strconv.ParseInt(state["version"], 10, 64)
+
+	keys, err := cs.store().Keys(ctx, cs.ackKey("*"))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	now := cs.now()
+	seen := make(map[string]bool)
+	instances := make([]InstanceAck, 0, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		value, err := cs.store().Get(ctx, key)
+		if err == storage.ErrNotFound {
+			continue // Expired since it was listed
+		} else if err != nil {
+			return nil, 0, err
+		}
+		var entry InstanceAck
+		if err := json.Unmarshal([]byte(value), &entry); err != nil {
+			continue // Written by an incompatible version
+		}
+		entry.UpToDate = entry.Version == version && entry.Error == ""
+		entry.Stale = now.Sub(entry.SeenAt) > 3*cs.Interval
+		instances = append(instances, entry)
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Instance < instances[j].Instance
+	})
+	return instances, version, nil
+}
+
+// Run syncs once, then applies every announced change until ctx is done.
+// If the storage is a storage.Subscriber (Redis) changes arrive over pub/sub; the subscription is
+// confirmed before the first Sync, so no change published in between is missed. Every Interval
+// the state is re-read anyway (catching up on messages missed while disconnected) and the ack refreshed.
+// Sync errors are reported in the ack and retried on the next change or tick.
+func (cs *ClusterSync) Run(ctx context.Context) {
+	var messages <-chan struct{}
+	if sub, ok := cs.store().(storage.Subscriber); ok {
+		payloads, err := sub.Subscribe(ctx, cs.channel())
+		if err != nil {
+			return // ctx is done
+		}
+
+		notify := make(chan struct{}, 1)
+		go func() {
+			for range payloads {
+				select {
+				case notify <- struct{}{}: // Coalesce bursts: one pending Sync covers them all
+				default:
+				}
+			}
+		}()
+		messages = notify
+	}
+
+	_ = cs.Sync(ctx)
+
+	ticker := time.NewTicker(cs.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-messages:
+			_ = cs.Sync(ctx)
+		case <-ticker.C:
+			_ = cs.Sync(ctx)
+		}
+	}
+}
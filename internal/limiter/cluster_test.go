@@ -0,0 +1,212 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+// newClusterInstance creates one instance's manager and cluster sync on a shared store
+func newClusterInstance(store storage.Storage, clk Clock, id string) *ClusterSync {
+	m := NewLimiterManager(
+		NewLeakyBucket(10, 1, time.Hour, WithStorage(store)),
+		NewTokenBucket(10, 1, time.Hour, WithStorage(store)),
+		AlgorithmLeakyBucket, WithClock(clk))
+	return NewClusterSync(m, id, WithStorage(store), WithClock(clk))
+}
+
+func TestClusterSync_SetAlgorithmReachesOtherInstances(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	a := newClusterInstance(store, clk, "a")
+	b := newClusterInstance(store, clk, "b")
+	assert.NoError(t, b.Sync(ctx))
+
+	changes := 0
+	b.Manager.OnChange(func() { changes++ })
+
+	assert.NoError(t, a.SetAlgorithm(ctx, AlgorithmTokenBucket, false))
+	assert.Equal(t, AlgorithmTokenBucket, a.Manager.GetCurrentAlgorithm())
+	assert.Equal(t, AlgorithmLeakyBucket, b.Manager.GetCurrentAlgorithm())
+
+	// b has not applied version 1 yet
+	instances, version, err := a.Instances(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+	assert.Len(t, instances, 2)
+	assert.True(t, instances[0].UpToDate)
+	assert.False(t, instances[1].UpToDate)
+
+	assert.NoError(t, b.Sync(ctx))
+	assert.Equal(t, AlgorithmTokenBucket, b.Manager.GetCurrentAlgorithm())
+	assert.Equal(t, 1, changes)
+
+	instances, _, err = a.Instances(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "b", instances[1].Instance)
+	assert.Equal(t, AlgorithmTokenBucket, instances[1].Algorithm)
+	assert.True(t, instances[1].UpToDate)
+
+	// Nothing changed: a second Sync only refreshes the ack
+	assert.NoError(t, b.Sync(ctx))
+	assert.Equal(t, 1, changes)
+}
+
+func TestClusterSync_UpdateConfigSharesChangeTime(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	a := newClusterInstance(store, clk, "a")
+	b := newClusterInstance(store, clk, "b")
+
+	_, err := a.Manager.AllowN(ctx, "k", 8)
+	assert.NoError(t, err)
+	clk.Advance(2 * time.Second)
+
+	cfg := Config{Capacity: 20, Rate: 4, TTL: time.Minute}
+	assert.NoError(t, a.UpdateConfig(ctx, AlgorithmLeakyBucket, cfg))
+	clk.Advance(500 * time.Millisecond)
+	assert.NoError(t, b.Sync(ctx))
+
+	got, err := b.Manager.Config(AlgorithmLeakyBucket)
+	assert.NoError(t, err)
+	assert.Equal(t, cfg, got)
+
+	// b syncs later but settles from a's change time: 2 seconds at the old rate, then the new one
+	clk.Advance(500 * time.Millisecond)
+	status, err := b.Manager.GetStatus(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, status.Current)
+	assert.Equal(t, 20.0, status.Capacity)
+}
+
+func TestClusterSync_ReportsErrorsAndStaleInstances(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	a := newClusterInstance(store, clk, "a")
+	b := newClusterInstance(store, clk, "b")
+	a.Manager.Register(Algorithm{Name: "custom", Limiter: &scriptedLimiter{}})
+
+	assert.ErrorIs(t, a.SetAlgorithm(ctx, "unknown", false), ErrUnknownAlgorithm)
+	assert.NoError(t, a.SetAlgorithm(ctx, "custom", false))
+
+	// b does not know the algorithm: it keeps its own and says so in the ack
+	assert.ErrorIs(t, b.Sync(ctx), ErrUnknownAlgorithm)
+	assert.Equal(t, AlgorithmLeakyBucket, b.Manager.GetCurrentAlgorithm())
+
+	instances, _, err := a.Instances(ctx)
+	assert.NoError(t, err)
+	assert.False(t, instances[1].UpToDate)
+	assert.Contains(t, instances[1].Error, "custom")
+
+	// Without heartbeats for 3 intervals an instance is reported as stale
+	clk.Advance(3*DefaultSyncInterval + time.Second)
+	assert.NoError(t, a.Sync(ctx))
+	instances, _, err = a.Instances(ctx)
+	assert.NoError(t, err)
+	assert.False(t, instances[0].Stale)
+	assert.True(t, instances[1].Stale)
+}
+
+func TestClusterSync_AcksOfGoneInstancesExpire(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	store := storage.NewRedisStorage(client)
+	clk := NewManualClock(testEpoch)
+	a := newClusterInstance(store, clk, "a")
+	b := newClusterInstance(store, clk, "b")
+	b.Interval = time.Second // Ack kept for 10 seconds without a refresh
+
+	assert.NoError(t, a.Sync(ctx))
+	assert.NoError(t, b.Sync(ctx))
+	instances, _, err := a.Instances(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, instances, 2)
+
+	// b stops refreshing its ack
+	server.FastForward(11 * time.Second)
+	instances, _, err = a.Instances(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, instances, 1) {
+		assert.Equal(t, "a", instances[0].Instance)
+	}
+}
+
+func TestClusterSync_RunAppliesPublishedChanges(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	store := storage.NewRedisStorage(client)
+
+	newInstance := func(id string) *ClusterSync {
+		m := NewLimiterManager(NewLeakyBucket(10, 1, time.Hour, WithStorage(store)),
+			NewTokenBucket(10, 1, time.Hour, WithStorage(store)), AlgorithmLeakyBucket)
+		cs := NewClusterSync(m, id, WithStorage(store))
+		cs.Interval = time.Hour // Only pub/sub can deliver the change in time
+		return cs
+	}
+	a, b := newInstance("a"), newInstance("b")
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go b.Run(runCtx)
+
+	// b acks after its first Sync, which only runs once the subscription is confirmed
+	assert.Eventually(t, func() bool {
+		instances, _, err := a.Instances(ctx)
+		return err == nil && len(instances) == 1
+	}, 2*time.Second, 5*time.Millisecond)
+
+	assert.NoError(t, a.SetAlgorithm(ctx, AlgorithmTokenBucket, false))
+	assert.Eventually(t, func() bool {
+		return b.Manager.GetCurrentAlgorithm() == AlgorithmTokenBucket
+	}, 2*time.Second, 5*time.Millisecond)
+}
+
+// failingEvalStorage fails every Eval while fail is set
+type failingEvalStorage struct {
+	storage.Storage
+	fail bool
+}
+
+func (s *failingEvalStorage) Eval(ctx context.Context, script *storage.Script, keys []string, args ...interface{}) ([]interface{}, error) {
+	if s.fail {
+		return nil, errors.New("connection refused")
+	}
+	return s.Storage.Eval(ctx, script, keys, args...)
+}
+
+func TestClusterSync_FailedPublishIsRetriedNotReverted(t *testing.T) {
+	mem := storage.NewMemoryStorage(0)
+	defer mem.Close()
+	clk := NewManualClock(testEpoch)
+	store := &failingEvalStorage{Storage: mem}
+	a := newClusterInstance(store, clk, "a")
+	b := newClusterInstance(mem, clk, "b")
+
+	assert.NoError(t, a.SetAlgorithm(ctx, AlgorithmLeakyBucket, false)) // Shared state: leaky_bucket
+
+	store.fail = true
+	assert.Error(t, a.SetAlgorithm(ctx, AlgorithmTokenBucket, false))
+	assert.Equal(t, AlgorithmTokenBucket, a.Manager.GetCurrentAlgorithm())
+
+	// While the storage fails, Sync adopts nothing
+	assert.Error(t, a.Sync(ctx))
+	assert.Equal(t, AlgorithmTokenBucket, a.Manager.GetCurrentAlgorithm())
+
+	// Once it is back, the next Sync publishes the switch instead of reverting it
+	store.fail = false
+	assert.NoError(t, a.Sync(ctx))
+	assert.Equal(t, AlgorithmTokenBucket, a.Manager.GetCurrentAlgorithm())
+	assert.NoError(t, b.Sync(ctx))
+	assert.Equal(t, AlgorithmTokenBucket, b.Manager.GetCurrentAlgorithm())
+}
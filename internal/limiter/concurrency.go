@@ -0,0 +1,196 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+// LeaseLimiter adalah interface untuk limiter berbasis slot (acquire/release)
+type LeaseLimiter interface {
+	// Acquire mengambil satu slot; leaseID kosong berarti slot penuh
+	Acquire(ctx context.Context, key string) (string, float64, error)
+
+	// Release mengembalikan slot yang diambil oleh Acquire
+	Release(ctx context.Context, key, leaseID string) error
+}
+
+// AlgorithmConcurrency menandai Status dari ConcurrencyLimiter (bukan pilihan di LimiterManager)
+const AlgorithmConcurrency = "concurrency"
+
+// Pastikan ConcurrencyLimiter implement LeaseLimiter interface
+var _ LeaseLimiter = (*ConcurrencyLimiter)(nil)
+
+// ConcurrencyLimiter limits simultaneous in-flight requests per key instead of request rate.
+// Every acquired slot is a lease stored in a Redis sorted set:
+// - Member = lease ID, score = lease expiry time (ms)
+// - Expired leases are dropped before each decision (crashed instances can't leak slots)
+// - LeaseTTL should be longer than the slowest request it guards
+type ConcurrencyLimiter struct {
+	Limit     int64         // Maximum simultaneous in-flight requests per key
+	LeaseTTL  time.Duration // How long a slot is held if it is never released
+	Clock     Clock
+	Storage   storage.Storage
+	Namespace string
+}
+
+// NewConcurrencyLimiter creates a new ConcurrencyLimiter instance
+// limit: maximum simultaneous in-flight requests per key
+// leaseTTL: how long an unreleased slot is held before it expires
+// Panics if limit is below 1 or leaseTTL is not positive.
+func NewConcurrencyLimiter(limit int64, leaseTTL time.Duration, opts ...Option) *ConcurrencyLimiter {
+	switch {
+	case limit < 1:
+		panic(fmt.Errorf("%w: limit must be at least 1", ErrInvalidConfig))
+	case leaseTTL <= 0:
+		panic(fmt.Errorf("%w: lease ttl must be positive", ErrInvalidConfig))
+	}
+	o := applyOptions(opts)
+	return &ConcurrencyLimiter{
+		Limit:     limit,
+		LeaseTTL:  leaseTTL,
+		Clock:     o.clock,
+		Storage:   o.storage,
+		Namespace: o.namespace,
+	}
+}
+
+// now returns the current time from Clock
+func (cl *ConcurrencyLimiter) now() time.Time {
+	return nowFrom(cl.Clock)
+}
+
+// store returns the state backend
+func (cl *ConcurrencyLimiter) store() storage.Storage {
+	return storeFrom(cl.Storage)
+}
+
+// inflightKey generates Redis key for the lease sorted set
+func (cl *ConcurrencyLimiter) inflightKey(key string) string {
+	return namespacedKey(cl.Namespace, "inflight:"+hashTag(key))
+}
+
+// acquireScript drops expired leases, then adds a new lease if a slot is free, atomically
+// KEYS[1] = in-flight key (sorted set, score = lease expiry in ms)
+// ARGV[1] = limit, ARGV[2] = lease TTL (ms), ARGV[3] = now (ms), ARGV[4] = lease ID
+// Returns: {acquired (0/1), remaining slots (string)}
+var acquireScript = storage.NewScript(`
+local limit = tonumber(ARGV[1])
+local ttl = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+
+local count = redis.call('ZCARD', KEYS[1])
+if count >= limit then
+  return {0, '0'}
+end
+
+redis.call('ZADD', KEYS[1], now + ttl, ARGV[4])
+redis.call('PEXPIRE', KEYS[1], ttl)
+
+return {1, tostring(limit - count - 1)}
+`).WithLocal(acquireLocal)
+
+// acquireLocal is the Go version of acquireScript for storages without Lua
+func acquireLocal(tx storage.Tx, keys []string, args []interface{}) ([]interface{}, error) {
+	limit := argFloat(args[0])
+	ttl := argFloat(args[1])
+	now := argFloat(args[2])
+
+	tx.ZRemRangeByScore(keys[0], now)
+
+	count := float64(len(tx.ZScores(keys[0])))
+	if count >= limit {
+		return []interface{}{int64(0), "0"}, nil
+	}
+
+	tx.ZAdd(keys[0], map[string]float64{args[3].(string): now + ttl}, time.Duration(ttl)*time.Millisecond)
+
+	return []interface{}{int64(1), formatNumber(limit - count - 1)}, nil
+}
+
+// releaseScript drops one lease
+// KEYS[1] = in-flight key, ARGV[1] = lease ID
+var releaseScript = storage.NewScript(`
+redis.call('ZREM', KEYS[1], ARGV[1])
+return {1}
+`).WithLocal(releaseLocal)
+
+// releaseLocal is the Go version of releaseScript for storages without Lua
+func releaseLocal(tx storage.Tx, keys []string, args []interface{}) ([]interface{}, error) {
+	tx.ZRem(keys[0], args[0].(string))
+	return []interface{}{int64(1)}, nil
+}
+
+// Acquire takes one in-flight slot for key.
+// Returns: (lease ID, remaining slots, error); an empty lease ID means no slot was free
+func (cl *ConcurrencyLimiter) Acquire(ctx context.Context, key string) (string, float64, error) {
+	now := cl.now().UnixMilli()
+
+	// Lease ID must be unique so every in-flight request holds its own slot
+	leaseID := strconv.FormatInt(now, 10) + "-" + strconv.FormatUint(rand.Uint64(), 36)
+
+	res, err := cl.store().Eval(ctx, acquireScript,
+		[]string{cl.inflightKey(key)}, cl.Limit, cl.LeaseTTL.Milliseconds(), now, leaseID)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if len(res) != 2 {
+		return "", 0, fmt.Errorf("unexpected script reply: %v", res)
+	}
+	acquired, _ := res[0].(int64)
+	remainingVal, _ := res[1].(string)
+	remaining, err := strconv.ParseFloat(remainingVal, 64)
+	if err != nil {
+		return "", 0, err
+	}
+	if acquired != 1 {
+		return "", remaining, nil
+	}
+
+	return leaseID, remaining, nil
+}
+
+// Release frees the slot held by leaseID (no-op if the lease already expired)
+func (cl *ConcurrencyLimiter) Release(ctx context.Context, key, leaseID string) error {
+	_, err := cl.store().Eval(ctx, releaseScript, []string{cl.inflightKey(key)}, leaseID)
+	return err
+}
+
+// Reset drops all leases for a specific key
+func (cl *ConcurrencyLimiter) Reset(ctx context.Context, key string) error {
+	return cl.store().Del(ctx, cl.inflightKey(key))
+}
+
+// GetStatus counts the unexpired leases for a key
+func (cl *ConcurrencyLimiter) GetStatus(ctx context.Context, key string) (*Status, error) {
+	now := cl.now().UnixMilli()
+
+	// Count only leases expiring after now; expired ones are trimmed by Acquire
+	count, err := cl.store().ZCount(ctx, cl.inflightKey(key), float64(now))
+	if err != nil {
+		return nil, err
+	}
+
+	limit := float64(cl.Limit)
+	current := float64(count)
+	remaining := limit - current
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return &Status{
+		Key:       key,
+		Current:   current,          // Requests currently in flight
+		Capacity:  limit,            // Maximum simultaneous requests
+		Remaining: remaining,        // Free slots
+		IsLimited: current >= limit, // Limited once every slot is taken
+		Algorithm: AlgorithmConcurrency,
+	}, nil
+}
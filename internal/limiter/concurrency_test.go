@@ -0,0 +1,162 @@
+package limiter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+// TestNewConcurrencyLimiter verifies ConcurrencyLimiter constructor
+func TestNewConcurrencyLimiter(t *testing.T) {
+	cl := NewConcurrencyLimiter(3, 30*time.Second)
+
+	assert.Equal(t, int64(3), cl.Limit)          // Max in-flight requests
+	assert.Equal(t, 30*time.Second, cl.LeaseTTL) // Lease expiry
+}
+
+// TestNewConcurrencyLimiter_RejectsInvalidParams verifies that a zero limit or a non-positive lease TTL is rejected
+func TestNewConcurrencyLimiter_RejectsInvalidParams(t *testing.T) {
+	assert.Panics(t, func() { NewConcurrencyLimiter(0, time.Minute) })
+	assert.Panics(t, func() { NewConcurrencyLimiter(-1, time.Minute) })
+	assert.Panics(t, func() { NewConcurrencyLimiter(3, 0) })
+	assert.Panics(t, func() { NewConcurrencyLimiter(3, -time.Second) })
+}
+
+// TestConcurrencyLimiter_Acquire tests taking a free slot
+func TestConcurrencyLimiter_Acquire(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	cl := NewConcurrencyLimiter(3, 30*time.Second, WithClock(NewManualClock(testEpoch)), WithStorage(store))
+
+	leaseID, remaining, err := cl.Acquire(ctx, "test_inflight_key")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, leaseID)
+	assert.Equal(t, 2.0, remaining)
+}
+
+// TestConcurrencyLimiter_Acquire_Full tests that no lease is returned when all slots are taken
+func TestConcurrencyLimiter_Acquire_Full(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	cl := NewConcurrencyLimiter(3, 30*time.Second, WithClock(NewManualClock(testEpoch)), WithStorage(store))
+
+	key := "test_inflight_full"
+
+	for i := 0; i < 3; i++ {
+		leaseID, _, err := cl.Acquire(ctx, key)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, leaseID)
+	}
+
+	leaseID, remaining, err := cl.Acquire(ctx, key)
+	assert.NoError(t, err)
+	assert.Empty(t, leaseID) // No slot
+	assert.Equal(t, 0.0, remaining)
+}
+
+// TestConcurrencyLimiter_Acquire_RedisError tests that script errors are returned
+func TestConcurrencyLimiter_Acquire_RedisError(t *testing.T) {
+	mock := setupMockRedis()
+	cl := NewConcurrencyLimiter(3, 30*time.Second)
+
+	key := "test_inflight_error"
+
+	expectScript(mock, cl, key, 1).SetErr(fmt.Errorf("connection refused"))
+
+	leaseID, _, err := cl.Acquire(ctx, key)
+	assert.Error(t, err)
+	assert.Empty(t, leaseID)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestConcurrencyLimiter_Release tests freeing a held slot
+func TestConcurrencyLimiter_Release(t *testing.T) {
+	mock := setupMockRedis()
+	cl := NewConcurrencyLimiter(3, 30*time.Second)
+
+	key := "release_inflight_test"
+
+	mock.ExpectEvalSha(releaseScript.Hash(), []string{"inflight:{" + key + "}"}, "lease-1").SetVal([]interface{}{int64(1)})
+
+	err := cl.Release(ctx, key, "lease-1")
+	assert.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestConcurrencyLimiter_Reset tests dropping all leases
+func TestConcurrencyLimiter_Reset(t *testing.T) {
+	mock := setupMockRedis()
+	cl := NewConcurrencyLimiter(3, 30*time.Second)
+
+	key := "reset_inflight_test"
+
+	mock.ExpectDel("inflight:{" + key + "}").SetVal(1)
+
+	err := cl.Reset(ctx, key)
+	assert.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestConcurrencyLimiter_GetStatus tests counting unexpired leases
+func TestConcurrencyLimiter_GetStatus(t *testing.T) {
+	mock := setupMockRedis()
+	cl := NewConcurrencyLimiter(3, 30*time.Second)
+
+	key := "status_inflight_test"
+
+	mock.Regexp().ExpectZCount("inflight:{"+key+"}", `^\(\d+$`, `^\+inf$`).SetVal(3)
+
+	status, err := cl.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 3.0, status.Current)
+	assert.Equal(t, 3.0, status.Capacity)
+	assert.Equal(t, 0.0, status.Remaining)
+	assert.True(t, status.IsLimited)
+	assert.Equal(t, AlgorithmConcurrency, status.Algorithm)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestConcurrencyLimiter_MemoryStorage(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	cl := NewConcurrencyLimiter(2, time.Minute, WithClock(clk), WithStorage(store))
+
+	key := "memory_inflight_test"
+
+	first, remaining, err := cl.Acquire(ctx, key)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, first)
+	assert.Equal(t, 1.0, remaining)
+	second, _, err := cl.Acquire(ctx, key)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, second)
+
+	leaseID, _, err := cl.Acquire(ctx, key)
+	assert.NoError(t, err)
+	assert.Empty(t, leaseID)
+
+	// A released slot is free again
+	assert.NoError(t, cl.Release(ctx, key, first))
+	status, err := cl.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, status.Current)
+
+	// An unreleased lease expires after LeaseTTL
+	clk.Advance(time.Minute)
+	status, err = cl.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, status.Current)
+
+	leaseID, remaining, err = cl.Acquire(ctx, key)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, leaseID)
+	assert.Equal(t, 1.0, remaining)
+}
@@ -0,0 +1,202 @@
+package limiter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrInvalidConfig is returned by LimiterManager.UpdateConfig when the new parameters are rejected
+var ErrInvalidConfig = errors.New("limiter: invalid config")
+
+// Config holds the parameters that can be changed at runtime with LimiterManager.UpdateConfig.
+// Rate has the same meaning as "rate" in GetAlgorithmInfo (see "rate_name").
+type Config struct {
+	Capacity float64       `json:"capacity"` // Bucket capacity, burst size or window limit
+	Rate     float64       `json:"rate"`     // Leak/refill rate per second, or window length in seconds for window algorithms
+	TTL      time.Duration `json:"ttl"`      // Key TTL for the bucket algorithms (0 = no expiry, must be 0 elsewhere)
+}
+
+// configurable is implemented by the built-in limiters whose parameters can change at runtime.
+// The manager serializes setConfig with every call it delegates.
+type configurable interface {
+	Config() Config
+	checkConfig(cfg Config) error
+	now() time.Time
+
+	// setConfig switches to cfg, changed at changedAt (Unix ms). Stored keys are not touched:
+	// each key keeps the parameters it was written with, and Allow/GetStatus settle it lazily,
+	// counting the time before changedAt at those parameters and the rest at cfg.
+	setConfig(cfg Config, changedAt int64)
+}
+
+var (
+	_ configurable = (*LeakyBucket)(nil)
+	_ configurable = (*TokenBucket)(nil)
+	_ configurable = (*GCRA)(nil)
+	_ configurable = (*FixedWindow)(nil)
+	_ configurable = (*SlidingWindowLog)(nil)
+	_ configurable = (*SlidingWindowCounter)(nil)
+)
+
+// checkBucketConfig validates parameters shared by the bucket algorithms
+func checkBucketConfig(cfg Config) error {
+	switch {
+	case cfg.Capacity <= 0:
+		return fmt.Errorf("%w: capacity must be positive", ErrInvalidConfig)
+	case cfg.Rate <= 0:
+		return fmt.Errorf("%w: rate must be positive", ErrInvalidConfig)
+	case cfg.TTL < 0:
+		return fmt.Errorf("%w: ttl must not be negative", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// checkWindowConfig validates parameters of the window algorithms; only the limit may change
+// because counters are stored per window length
+func checkWindowConfig(cfg Config, window time.Duration) error {
+	switch {
+	case window < time.Millisecond || window%time.Millisecond != 0:
+		return fmt.Errorf("%w: window must be a whole number of milliseconds, at least 1ms", ErrInvalidConfig)
+	case cfg.Capacity < 1 || cfg.Capacity != math.Trunc(cfg.Capacity):
+		return fmt.Errorf("%w: limit must be a whole number of at least 1", ErrInvalidConfig)
+	case cfg.Rate != window.Seconds():
+		return fmt.Errorf("%w: window length cannot be changed at runtime", ErrInvalidConfig)
+	case cfg.TTL != 0:
+		return fmt.Errorf("%w: ttl is not supported by window algorithms", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// settleSplit returns the moment between last and now from which the current parameters apply:
+// time before changedAt (0 = never changed) is counted at the parameters a key was written with
+func settleSplit(last, now, changedAt float64) float64 {
+	return math.Min(now, math.Max(last, changedAt))
+}
+
+// leak drains water stored at last: at storedRate until the last config change, then at rate
+func leak(water, last, now, changedAt, storedRate, rate float64) float64 {
+	split := settleSplit(last, now, changedAt)
+	return math.Max(0, water-(math.Max(0, split-last)/1000*storedRate+math.Max(0, now-split)/1000*rate))
+}
+
+// refill adds the tokens earned since last: at storedCapacity and storedRate until the last config
+// change, then the bucket moves by the capacity change (used tokens stay used) and refills at rate
+func refill(tokens, last, now, changedAt, storedCapacity, storedRate, capacity, rate float64) float64 {
+	split := settleSplit(last, now, changedAt)
+	tokens = math.Min(storedCapacity, tokens+math.Max(0, split-last)/1000*storedRate)
+	if storedCapacity != capacity {
+		tokens = math.Max(0, math.Min(capacity, tokens+capacity-storedCapacity))
+	}
+	return math.Min(capacity, tokens+math.Max(0, now-split)/1000*rate)
+}
+
+// rescaleTAT moves a TAT stored at storedRate so the backlog left at the last config change
+// (or now, for a key from before a restart) keeps the same number of requests at rate
+func rescaleTAT(tat, now, changedAt, storedRate, rate float64) float64 {
+	at := now
+	if changedAt > 0 && changedAt < now {
+		at = changedAt
+	}
+	if storedRate == rate || tat <= at {
+		return tat
+	}
+	return at + (tat-at)*storedRate/rate
+}
+
+// Config returns the current capacity, leak rate and TTL
+func (lb *LeakyBucket) Config() Config {
+	return Config{Capacity: lb.Capacity, Rate: lb.LeakRate, TTL: lb.TTL}
+}
+
+func (lb *LeakyBucket) checkConfig(cfg Config) error {
+	return checkBucketConfig(cfg)
+}
+
+// setConfig keeps the water of every bucket, so a lower capacity can leave a bucket over full.
+// The new TTL applies from each key's next write.
+func (lb *LeakyBucket) setConfig(cfg Config, changedAt int64) {
+	lb.Capacity, lb.LeakRate, lb.TTL = cfg.Capacity, cfg.Rate, cfg.TTL
+	lb.changedAt = changedAt
+}
+
+// Config returns the current capacity, refill rate and TTL
+func (tb *TokenBucket) Config() Config {
+	return Config{Capacity: tb.Capacity, Rate: tb.RefillRate, TTL: tb.TTL}
+}
+
+func (tb *TokenBucket) checkConfig(cfg Config) error {
+	return checkBucketConfig(cfg)
+}
+
+// setConfig moves every bucket by the capacity change when it is next used, so used tokens stay used.
+// Leases claimed under the old parameters stop serving; their tokens go back with the next claim.
+func (tb *TokenBucket) setConfig(cfg Config, changedAt int64) {
+	tb.paramsMu.Lock()
+	defer tb.paramsMu.Unlock()
+	tb.Capacity, tb.RefillRate, tb.TTL = cfg.Capacity, cfg.Rate, cfg.TTL
+	tb.changedAt = changedAt
+	tb.leaseGen.Add(1)
+}
+
+// Config returns the current burst size and rate
+func (g *GCRA) Config() Config {
+	return Config{Capacity: g.Capacity, Rate: g.Rate}
+}
+
+func (g *GCRA) checkConfig(cfg Config) error {
+	if cfg.TTL != 0 {
+		return fmt.Errorf("%w: ttl is not supported by gcra", ErrInvalidConfig)
+	}
+	return checkBucketConfig(cfg)
+}
+
+// setConfig rescales how far each TAT is ahead (when it is next used) to the new emission
+// interval, so every key keeps the same number of used requests
+func (g *GCRA) setConfig(cfg Config, changedAt int64) {
+	g.Capacity, g.Rate = cfg.Capacity, cfg.Rate
+	g.changedAt = changedAt
+}
+
+// Config returns the current limit; Rate is the window length in seconds and cannot change
+func (fw *FixedWindow) Config() Config {
+	return Config{Capacity: float64(fw.Limit), Rate: fw.Window.Seconds()}
+}
+
+func (fw *FixedWindow) checkConfig(cfg Config) error {
+	return checkWindowConfig(cfg, fw.Window)
+}
+
+// setConfig sets the new limit; stored counts stay valid as they are
+func (fw *FixedWindow) setConfig(cfg Config, changedAt int64) {
+	fw.Limit = int64(cfg.Capacity)
+}
+
+// Config returns the current limit; Rate is the window length in seconds and cannot change
+func (sl *SlidingWindowLog) Config() Config {
+	return Config{Capacity: float64(sl.Limit), Rate: sl.Window.Seconds()}
+}
+
+func (sl *SlidingWindowLog) checkConfig(cfg Config) error {
+	return checkWindowConfig(cfg, sl.Window)
+}
+
+// setConfig sets the new limit; logged timestamps stay valid as they are
+func (sl *SlidingWindowLog) setConfig(cfg Config, changedAt int64) {
+	sl.Limit = int64(cfg.Capacity)
+}
+
+// Config returns the current limit; Rate is the window length in seconds and cannot change
+func (sc *SlidingWindowCounter) Config() Config {
+	return Config{Capacity: float64(sc.Limit), Rate: sc.Window.Seconds()}
+}
+
+func (sc *SlidingWindowCounter) checkConfig(cfg Config) error {
+	return checkWindowConfig(cfg, sc.Window)
+}
+
+// setConfig sets the new limit; stored counts stay valid as they are
+func (sc *SlidingWindowCounter) setConfig(cfg Config, changedAt int64) {
+	sc.Limit = int64(cfg.Capacity)
+}
@@ -0,0 +1,159 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+func TestLimiterManager_UpdateConfig_LeakyBucketSettlesAtOldRate(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	leaky := NewLeakyBucket(10, 1, time.Hour, WithStorage(store))
+	m := NewLimiterManager(leaky, NewTokenBucket(10, 1, time.Hour), AlgorithmLeakyBucket, WithClock(clk))
+
+	_, err := m.AllowN(ctx, "k", 8)
+	assert.NoError(t, err)
+
+	// 2 seconds drain at the old rate (water 6), then 1 second at the new rate (water 2)
+	clk.Advance(2 * time.Second)
+	assert.NoError(t, m.UpdateConfig(ctx, AlgorithmLeakyBucket, Config{Capacity: 20, Rate: 4, TTL: time.Minute}))
+	clk.Advance(time.Second)
+
+	status, err := m.GetStatus(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, status.Current)
+	assert.Equal(t, 18.0, status.Remaining)
+	assert.Equal(t, Config{Capacity: 20, Rate: 4, TTL: time.Minute}, leaky.Config())
+}
+
+func TestLimiterManager_UpdateConfig_TokenBucketKeepsUsedTokens(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	token := NewTokenBucket(10, 1, time.Hour, WithStorage(store))
+	m := NewLimiterManager(NewLeakyBucket(10, 1, time.Hour), token, AlgorithmTokenBucket, WithClock(clk))
+
+	_, err := m.AllowN(ctx, "k", 8)
+	assert.NoError(t, err)
+	clk.Advance(2 * time.Second) // 4 tokens left, 6 used
+
+	// Growing the bucket keeps the 6 used tokens used
+	assert.NoError(t, m.UpdateConfig(ctx, AlgorithmTokenBucket, Config{Capacity: 20, Rate: 1, TTL: time.Hour}))
+	status, err := m.GetStatus(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, 14.0, status.Remaining)
+
+	// Shrinking below the used amount leaves the bucket empty
+	assert.NoError(t, m.UpdateConfig(ctx, AlgorithmTokenBucket, Config{Capacity: 5, Rate: 1, TTL: time.Hour}))
+	status, err = m.GetStatus(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, status.Remaining)
+	assert.Equal(t, 5.0, status.Capacity)
+}
+
+func TestLimiterManager_UpdateConfig_LeasesStopServing(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	token := NewLeasingTokenBucket(10, 1, time.Hour, 5, time.Minute, WithStorage(store))
+	defer token.Close()
+	m := NewLimiterManager(NewLeakyBucket(10, 1, time.Hour), token, AlgorithmTokenBucket, WithClock(clk))
+
+	_, err := m.Allow(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, "5", storedTokens(t, store, token, "k"))
+
+	// The change itself touches nothing; the lease just stops serving
+	assert.NoError(t, m.UpdateConfig(ctx, AlgorithmTokenBucket, Config{Capacity: 10, Rate: 2, TTL: time.Hour}))
+	assert.Equal(t, "5", storedTokens(t, store, token, "k"))
+	leased, usable := token.leasedTokens("k")
+	assert.Equal(t, 4.0, leased)
+	assert.False(t, usable)
+
+	// The next claim returns the 4 unspent tokens and takes a new batch of 5
+	result, err := m.Allow(ctx, "k")
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, "4", storedTokens(t, store, token, "k"))
+	assert.Equal(t, 8.0, result.Remaining)
+}
+
+func TestLimiterManager_UpdateConfig_GCRARescalesBacklog(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	g := NewGCRA(10, 2, WithStorage(store))
+	m := NewLimiterManager(NewLeakyBucket(10, 1, time.Hour), NewTokenBucket(10, 1, time.Hour), AlgorithmLeakyBucket, WithClock(clk))
+	m.SetGCRA(g)
+	assert.NoError(t, m.SetAlgorithm(AlgorithmGCRA))
+
+	_, err := m.AllowN(ctx, "k", 4)
+	assert.NoError(t, err)
+
+	// The stored TAT keeps its old rate; reads rescale it so the 4 used requests stay used
+	assert.NoError(t, m.UpdateConfig(ctx, AlgorithmGCRA, Config{Capacity: 10, Rate: 4}))
+	stored, err := store.Get(ctx, "gcra:{k}")
+	assert.NoError(t, err)
+	assert.Equal(t, formatTAT(float64(testEpoch.UnixMilli()+2000), 2), stored)
+
+	status, err := m.GetStatus(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, 4.0, status.Current)
+
+	// Time after the change drains at the new rate: 2 requests per 500ms
+	clk.Advance(500 * time.Millisecond)
+	status, err = m.GetStatus(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, status.Current)
+
+	result, err := m.AllowN(ctx, "k", 8)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0.0, result.Remaining)
+}
+
+func TestLimiterManager_UpdateConfig_WindowLimitOnly(t *testing.T) {
+	fw := NewFixedWindow(10, time.Minute)
+	m := NewLimiterManager(NewLeakyBucket(10, 1, time.Hour), NewTokenBucket(10, 1, time.Hour), AlgorithmLeakyBucket)
+	m.SetFixedWindow(fw)
+
+	assert.NoError(t, m.UpdateConfig(ctx, AlgorithmFixedWindow, Config{Capacity: 25, Rate: 60}))
+	assert.Equal(t, int64(25), fw.Limit)
+
+	err := m.UpdateConfig(ctx, AlgorithmFixedWindow, Config{Capacity: 25, Rate: 30})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	err = m.UpdateConfig(ctx, AlgorithmFixedWindow, Config{Capacity: 2.5, Rate: 60})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	err = m.UpdateConfig(ctx, AlgorithmFixedWindow, Config{Capacity: 0, Rate: 60})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	assert.Equal(t, time.Minute, fw.Window)
+}
+
+func TestLimiterManager_UpdateConfig_Rejected(t *testing.T) {
+	leaky := NewLeakyBucket(10, 1, time.Hour)
+	m := NewLimiterManager(leaky, NewTokenBucket(10, 1, time.Hour), AlgorithmLeakyBucket)
+	m.Register(Algorithm{Name: "custom", Limiter: &scriptedLimiter{}})
+
+	for _, cfg := range []Config{
+		{Capacity: 0, Rate: 1},
+		{Capacity: 10, Rate: 0},
+		{Capacity: 10, Rate: -1},
+		{Capacity: 10, Rate: 1, TTL: -time.Second},
+	} {
+		assert.ErrorIs(t, m.UpdateConfig(ctx, AlgorithmLeakyBucket, cfg), ErrInvalidConfig)
+	}
+	assert.Equal(t, Config{Capacity: 10, Rate: 1, TTL: time.Hour}, leaky.Config())
+
+	assert.ErrorIs(t, m.UpdateConfig(ctx, "unknown", Config{Capacity: 1, Rate: 1}), ErrInvalidConfig)
+	assert.ErrorIs(t, m.UpdateConfig(ctx, "custom", Config{Capacity: 1, Rate: 1}), ErrInvalidConfig)
+
+	_, err := m.Config("custom")
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	cfg, err := m.Config(AlgorithmLeakyBucket)
+	assert.NoError(t, err)
+	assert.Equal(t, 10.0, cfg.Capacity)
+}
@@ -0,0 +1,195 @@
+package limiter
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Ensure DenyCache implements RateLimiter interface
+var _ RateLimiter = (*DenyCache)(nil)
+
+// DenyCache is an in-process L1 cache in front of a RateLimiter that remembers
+// "key denied until T" (T = now + Result.RetryAfter) and rejects the key locally
+// until then, so clients hammering while limited cost no Redis round trip.
+//
+// A cached denial only answers requests of the same or higher cost; cheaper requests
+// are still checked against the wrapped limiter. Memory is bounded by MaxKeys
+// (least recently denied keys are evicted first). Resets done through the cache drop
+// the entry immediately; resets on other instances take effect when T passes.
+type DenyCache struct {
+	Limiter RateLimiter // Wrapped limiter (usually Redis-backed)
+	MaxKeys int         // Maximum number of cached keys
+	Clock   Clock
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // key -> element holding *denyEntry
+	order   *list.List               // Front = most recently denied
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+// denyEntry is one cached denial
+type denyEntry struct {
+	key        string
+	until      time.Time // Requests are denied locally before this time
+	resetUntil time.Time // now + Result.ResetAfter on the cache's clock
+	cost       int64     // Cost of the denied request
+	result     Result    // Denial returned by the wrapped limiter
+}
+
+// DenyCacheStats is a snapshot of DenyCache counters
+type DenyCacheStats struct {
+	Hits      uint64  `json:"hits"`      // Requests denied from the cache
+	Misses    uint64  `json:"misses"`    // Requests passed to the wrapped limiter
+	Evictions uint64  `json:"evictions"` // Entries dropped because MaxKeys was reached
+	Entries   int     `json:"entries"`   // Keys currently cached
+	HitRate   float64 `json:"hit_rate"`  // Hits / (Hits + Misses), 0 when there was no request
+}
+
+// NewDenyCache wraps rl with a deny cache holding at most maxKeys keys
+func NewDenyCache(rl RateLimiter, maxKeys int, opts ...Option) *DenyCache {
+	o := applyOptions(opts)
+	return &DenyCache{
+		Limiter: rl,
+		MaxKeys: maxKeys,
+		Clock:   o.clock,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// now returns the current time from the configured clock
+func (dc *DenyCache) now() time.Time {
+	return nowFrom(dc.Clock)
+}
+
+// Allow checks a single request, answering from the cache when the key is known to be denied
+func (dc *DenyCache) Allow(ctx context.Context, key string) (*Result, error) {
+	return dc.AllowN(ctx, key, 1)
+}
+
+// AllowN checks a request of cost n, answering from the cache when the key is known to be denied
+func (dc *DenyCache) AllowN(ctx context.Context, key string, n int64) (*Result, error) {
+	if n < 1 {
+		return nil, ErrInvalidCost
+	}
+
+	if result := dc.lookup(key, n, dc.now()); result != nil {
+		dc.hits.Add(1)
+		return result, nil
+	}
+	dc.misses.Add(1)
+
+	result, err := dc.Limiter.AllowN(ctx, key, n)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Allowed && result.RetryAfter > 0 {
+		dc.remember(key, n, result, dc.now())
+	}
+	return result, nil
+}
+
+// Reset drops the cached denial for key and resets the wrapped limiter
+func (dc *DenyCache) Reset(ctx context.Context, key string) error {
+	dc.Forget(key)
+	return dc.Limiter.Reset(ctx, key)
+}
+
+// GetStatus reads the key's status from the wrapped limiter (never from the cache)
+func (dc *DenyCache) GetStatus(ctx context.Context, key string) (*Status, error) {
+	return dc.Limiter.GetStatus(ctx, key)
+}
+
+// Forget drops the cached denial for key, if any
+func (dc *DenyCache) Forget(key string) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if el, ok := dc.entries[key]; ok {
+		dc.removeElement(el)
+	}
+}
+
+// Clear drops every cached denial, e.g. after the wrapped limiter was reconfigured
+func (dc *DenyCache) Clear() {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	dc.entries = make(map[string]*list.Element)
+	dc.order.Init()
+}
+
+// Stats returns a snapshot of the cache counters
+func (dc *DenyCache) Stats() DenyCacheStats {
+	dc.mu.Lock()
+	entries := len(dc.entries)
+	dc.mu.Unlock()
+
+	stats := DenyCacheStats{
+		Hits:      dc.hits.Load(),
+		Misses:    dc.misses.Load(),
+		Evictions: dc.evictions.Load(),
+		Entries:   entries,
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+// lookup returns a copy of the cached denial for key, or nil if the request must be checked
+func (dc *DenyCache) lookup(key string, n int64, now time.Time) *Result {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	el, ok := dc.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := el.Value.(*denyEntry)
+	if !now.Before(entry.until) {
+		dc.removeElement(el) // Expired
+		return nil
+	}
+	if n < entry.cost {
+		return nil // A cheaper request may fit before the cached retry time
+	}
+
+	result := entry.result
+	result.RetryAfter = entry.until.Sub(now)
+	result.ResetAfter = max(0, entry.resetUntil.Sub(now)) // ResetAt is on the wrapped limiter's clock, which may differ
+	return &result
+}
+
+// remember caches a denial for key until now + result.RetryAfter
+func (dc *DenyCache) remember(key string, n int64, result *Result, now time.Time) {
+	if dc.MaxKeys <= 0 {
+		return
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	entry := &denyEntry{key: key, until: now.Add(result.RetryAfter), resetUntil: now.Add(result.ResetAfter), cost: n, result: *result}
+	if el, ok := dc.entries[key]; ok {
+		el.Value = entry
+		dc.order.MoveToFront(el)
+		return
+	}
+
+	for len(dc.entries) >= dc.MaxKeys {
+		dc.removeElement(dc.order.Back())
+		dc.evictions.Add(1)
+	}
+	dc.entries[key] = dc.order.PushFront(entry)
+}
+
+// removeElement deletes one entry; the caller holds dc.mu
+func (dc *DenyCache) removeElement(el *list.Element) {
+	dc.order.Remove(el)
+	delete(dc.entries, el.Value.(*denyEntry).key)
+}
@@ -0,0 +1,173 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// scriptedLimiter is a RateLimiter stub that returns result for every call and counts calls
+type scriptedLimiter struct {
+	result Result
+	calls  int
+	resets int
+}
+
+func (s *scriptedLimiter) Allow(ctx context.Context, key string) (*Result, error) {
+	return s.AllowN(ctx, key, 1)
+}
+
+func (s *scriptedLimiter) AllowN(ctx context.Context, key string, n int64) (*Result, error) {
+	s.calls++
+	result := s.result
+	return &result, nil
+}
+
+func (s *scriptedLimiter) Reset(ctx context.Context, key string) error {
+	s.resets++
+	return nil
+}
+
+func (s *scriptedLimiter) GetStatus(ctx context.Context, key string) (*Status, error) {
+	return &Status{Key: key}, nil
+}
+
+func TestDenyCache_DeniesLocallyUntilRetryTime(t *testing.T) {
+	clk := NewManualClock(testEpoch)
+	backend := &scriptedLimiter{result: Result{Allowed: false, RetryAfter: 2 * time.Second, Limit: 10,
+		ResetAt: testEpoch.Add(5 * time.Second), ResetAfter: 5 * time.Second}}
+	dc := NewDenyCache(backend, 100, WithClock(clk))
+
+	result, err := dc.Allow(ctx, "abuser")
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+
+	// Answered from the cache with the remaining wait
+	clk.Advance(500 * time.Millisecond)
+	result, err = dc.Allow(ctx, "abuser")
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 1500*time.Millisecond, result.RetryAfter)
+	assert.Equal(t, 4500*time.Millisecond, result.ResetAfter)
+	assert.Equal(t, 10.0, result.Limit)
+	assert.Equal(t, 1, backend.calls)
+
+	// Retry time passed - checked against the backend again
+	clk.Advance(1500 * time.Millisecond)
+	backend.result = Result{Allowed: true}
+	result, err = dc.Allow(ctx, "abuser")
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 2, backend.calls)
+
+	stats := dc.Stats()
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+	assert.InDelta(t, 1.0/3, stats.HitRate, 1e-9)
+	assert.Equal(t, 0, stats.Entries)
+}
+
+func TestDenyCache_ResetAfterIndependentOfLimiterClock(t *testing.T) {
+	// The wrapped limiter runs on a clock an hour ahead of the cache's clock
+	limiterClk := NewManualClock(testEpoch.Add(time.Hour))
+	cacheClk := NewManualClock(testEpoch)
+	backend := &scriptedLimiter{result: Result{Allowed: false, RetryAfter: 2 * time.Second,
+		ResetAt: limiterClk.Now().Add(5 * time.Second), ResetAfter: 5 * time.Second}}
+	dc := NewDenyCache(backend, 100, WithClock(cacheClk))
+
+	_, err := dc.Allow(ctx, "k")
+	assert.NoError(t, err)
+
+	cacheClk.Advance(time.Second)
+	result, err := dc.Allow(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, backend.calls)
+	assert.Equal(t, time.Second, result.RetryAfter)
+	assert.Equal(t, 4*time.Second, result.ResetAfter)
+	assert.Equal(t, limiterClk.Now().Add(5*time.Second), result.ResetAt)
+}
+
+func TestDenyCache_CheaperRequestGoesToBackend(t *testing.T) {
+	backend := &scriptedLimiter{result: Result{Allowed: false, RetryAfter: time.Second}}
+	dc := NewDenyCache(backend, 100, WithClock(NewManualClock(testEpoch)))
+
+	_, err := dc.AllowN(ctx, "k", 5)
+	assert.NoError(t, err)
+
+	// Cost 2 might fit even though cost 5 did not
+	_, err = dc.AllowN(ctx, "k", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, backend.calls)
+
+	// Cost 5 or more is answered locally
+	_, err = dc.AllowN(ctx, "k", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, backend.calls)
+}
+
+func TestDenyCache_AllowedAndZeroRetryNotCached(t *testing.T) {
+	backend := &scriptedLimiter{result: Result{Allowed: true}}
+	dc := NewDenyCache(backend, 100)
+
+	_, _ = dc.Allow(ctx, "k")
+	backend.result = Result{Allowed: false} // No retry hint
+	_, _ = dc.Allow(ctx, "k")
+	_, _ = dc.Allow(ctx, "k")
+
+	assert.Equal(t, 3, backend.calls)
+	assert.Equal(t, 0, dc.Stats().Entries)
+}
+
+func TestDenyCache_BoundedByMaxKeys(t *testing.T) {
+	backend := &scriptedLimiter{result: Result{Allowed: false, RetryAfter: time.Minute}}
+	dc := NewDenyCache(backend, 2, WithClock(NewManualClock(testEpoch)))
+
+	for _, key := range []string{"a", "b", "c"} {
+		_, _ = dc.Allow(ctx, key)
+	}
+
+	// "a" was least recently denied and got evicted
+	stats := dc.Stats()
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, uint64(1), stats.Evictions)
+
+	_, _ = dc.Allow(ctx, "a")
+	_, _ = dc.Allow(ctx, "c")
+	assert.Equal(t, 4, backend.calls) // "a" went to the backend, "c" did not
+}
+
+func TestDenyCache_ResetDropsEntry(t *testing.T) {
+	backend := &scriptedLimiter{result: Result{Allowed: false, RetryAfter: time.Minute}}
+	dc := NewDenyCache(backend, 100, WithClock(NewManualClock(testEpoch)))
+
+	_, _ = dc.Allow(ctx, "k")
+	assert.NoError(t, dc.Reset(ctx, "k"))
+	assert.Equal(t, 1, backend.resets)
+
+	backend.result = Result{Allowed: true}
+	result, err := dc.Allow(ctx, "k")
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+}
+
+func TestDenyCache_ClearDropsAllEntries(t *testing.T) {
+	backend := &scriptedLimiter{result: Result{Allowed: false, RetryAfter: time.Minute}}
+	dc := NewDenyCache(backend, 100, WithClock(NewManualClock(testEpoch)))
+
+	_, _ = dc.Allow(ctx, "a")
+	_, _ = dc.Allow(ctx, "b")
+	dc.Clear()
+	assert.Equal(t, 0, dc.Stats().Entries)
+
+	_, _ = dc.Allow(ctx, "a")
+	assert.Equal(t, 3, backend.calls) // Not answered from the cache
+}
+
+func TestDenyCache_InvalidCost(t *testing.T) {
+	dc := NewDenyCache(&scriptedLimiter{}, 100)
+
+	_, err := dc.AllowN(ctx, "k", 0)
+	assert.ErrorIs(t, err, ErrInvalidCost)
+}
@@ -0,0 +1,197 @@
+package limiter
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+// Pastikan FixedWindow implement RateLimiter interface
+var _ RateLimiter = (*FixedWindow)(nil)
+var _ KeyLister = (*FixedWindow)(nil)
+
+// FixedWindow implements the Fixed Window Counter rate limiting algorithm.
+// - Time is divided into windows of equal length aligned to the Unix epoch
+// - Each request increments the counter of the current window
+// - Once the counter reaches Limit, requests are denied until the next window
+// - The counter key expires when its window ends
+type FixedWindow struct {
+	Limit     int64         // Maximum requests per window
+	Window    time.Duration // Window length (e.g. time.Hour for "1000 per hour")
+	Clock     Clock
+	Storage   storage.Storage
+	Namespace string
+}
+
+// NewFixedWindow creates a new FixedWindow instance
+// limit: maximum requests allowed per window
+// window: length of each window
+// Panics if limit is below 1 or window is not a whole number of milliseconds (at least 1ms).
+func NewFixedWindow(limit int64, window time.Duration, opts ...Option) *FixedWindow {
+	if err := checkWindowConfig(Config{Capacity: float64(limit), Rate: window.Seconds()}, window); err != nil {
+		panic(err)
+	}
+	o := applyOptions(opts)
+	return &FixedWindow{
+		Limit:     limit,
+		Window:    window,
+		Clock:     o.clock,
+		Storage:   o.storage,
+		Namespace: o.namespace,
+	}
+}
+
+// now returns the current time from Clock
+func (fw *FixedWindow) now() time.Time {
+	return nowFrom(fw.Clock)
+}
+
+// store returns the state backend
+func (fw *FixedWindow) store() storage.Storage {
+	return storeFrom(fw.Storage)
+}
+
+// windowStart returns the start of the window containing now (Unix milliseconds)
+func (fw *FixedWindow) windowStart(now time.Time) int64 {
+	windowMs := fw.Window.Milliseconds()
+	nowMs := now.UnixMilli()
+	return nowMs - nowMs%windowMs
+}
+
+// counterKey generates Redis key for the counter of a specific window
+func (fw *FixedWindow) counterKey(key string, windowStart int64) string {
+	return namespacedKey(fw.Namespace, "window:"+hashTag(key)+":"+strconv.FormatInt(windowStart, 10))
+}
+
+// KeyPattern returns the Redis key pattern of the window counters and how to extract the client key (used by the dashboard)
+func (fw *FixedWindow) KeyPattern() (string, func(string) string) {
+	prefix := namespacedKey(fw.Namespace, "window:{")
+	extract := clientKeyBetween(prefix, "}")
+	return prefix + "*}:*", func(storageKey string) string {
+		end := strings.LastIndex(storageKey, "}:") // "window:{" ... "}:<window start>"
+		if end < 0 {
+			return ""
+		}
+		return extract(storageKey[:end+1])
+	}
+}
+
+// fixedWindowScript checks and increments the window counter atomically
+// KEYS[1] = counter key of the current window
+// ARGV[1] = limit, ARGV[2] = milliseconds until the window ends, ARGV[3] = cost
+// Returns: {allowed (0/1), remaining requests, retry after (ms), reset after (ms)} (numbers as strings)
+var fixedWindowScript = storage.NewScript(`
+local limit = tonumber(ARGV[1])
+local expire_ms = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+
+local count = tonumber(redis.call('GET', KEYS[1])) or 0
+if count + cost > limit then
+  return {0, tostring(math.max(0, limit - count)), tostring(expire_ms), tostring(expire_ms)}
+end
+
+count = redis.call('INCRBY', KEYS[1], cost)
+if count == cost then
+  redis.call('PEXPIRE', KEYS[1], expire_ms)
+end
+
+return {1, tostring(limit - count), '0', tostring(expire_ms)}
+`).WithLocal(fixedWindowLocal)
+
+// fixedWindowLocal is the Go version of fixedWindowScript for storages without Lua
+func fixedWindowLocal(tx storage.Tx, keys []string, args []interface{}) ([]interface{}, error) {
+	limit := argFloat(args[0])
+	expireMs := argFloat(args[1])
+	cost := argFloat(args[2])
+
+	count := 0.0
+	if val, ok := tx.Get(keys[0]); ok {
+		count, _ = strconv.ParseFloat(val, 64)
+	}
+	if count+cost > limit {
+		return scriptReply(false, math.Max(0, limit-count), expireMs, expireMs), nil
+	}
+
+	// expireMs always points at the end of the window, so rewriting the TTL keeps it unchanged
+	count += cost
+	tx.Set(keys[0], formatNumber(count), time.Duration(expireMs)*time.Millisecond)
+
+	return scriptReply(true, limit-count, 0, expireMs), nil
+}
+
+// Allow checks whether a request fits in the current window and counts it if so.
+// Result.Remaining = requests left in window, Result.ResetAt = end of the current window
+func (fw *FixedWindow) Allow(ctx context.Context, key string) (*Result, error) {
+	return fw.AllowN(ctx, key, 1)
+}
+
+// AllowN is like Allow but counts n requests at once (all or nothing).
+// A cost above Limit can never fit and returns ErrCostExceedsLimit.
+func (fw *FixedWindow) AllowN(ctx context.Context, key string, n int64) (*Result, error) {
+	if n < 1 {
+		return nil, ErrInvalidCost
+	}
+	if n > fw.Limit {
+		return nil, ErrCostExceedsLimit
+	}
+
+	now := fw.now()
+	start := fw.windowStart(now)
+	expireMs := start + fw.Window.Milliseconds() - now.UnixMilli() // Counter lives until window end
+
+	res, err := fw.store().Eval(ctx, fixedWindowScript,
+		[]string{fw.counterKey(key, start)}, fw.Limit, expireMs, n)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := parseScriptResult(res, now)
+	if err != nil {
+		return nil, err
+	}
+	result.Limit = float64(fw.Limit)
+	result.Window = fw.Window
+	result.Algorithm = AlgorithmFixedWindow
+	return result, nil
+}
+
+// Reset clears the counter of the current window for a specific key
+func (fw *FixedWindow) Reset(ctx context.Context, key string) error {
+	return fw.store().Del(ctx, fw.counterKey(key, fw.windowStart(fw.now())))
+}
+
+// GetStatus retrieves the counter of the current window for a key
+func (fw *FixedWindow) GetStatus(ctx context.Context, key string) (*Status, error) {
+	counterKey := fw.counterKey(key, fw.windowStart(fw.now()))
+
+	// Retrieve current window counter
+	countVal, err := fw.store().Get(ctx, counterKey)
+	var count float64
+	if err == storage.ErrNotFound {
+		count = 0
+	} else if err != nil {
+		return nil, err
+	} else {
+		count, _ = strconv.ParseFloat(countVal, 64)
+	}
+
+	limit := float64(fw.Limit)
+	remaining := limit - count
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return &Status{
+		Key:       key,
+		Current:   count,                       // Requests counted in current window
+		Capacity:  limit,                       // Maximum requests per window
+		Remaining: remaining,                   // Requests left in current window
+		LeakRate:  limit / fw.Window.Seconds(), // Average allowed rate per second
+		IsLimited: count >= limit,              // Limited once window is full
+		Algorithm: AlgorithmFixedWindow,
+	}, nil
+}
@@ -0,0 +1,215 @@
+package limiter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+// TestNewFixedWindow verifies FixedWindow constructor
+func TestNewFixedWindow(t *testing.T) {
+	fw := NewFixedWindow(1000, time.Hour)
+
+	assert.Equal(t, int64(1000), fw.Limit) // Max requests per window
+	assert.Equal(t, time.Hour, fw.Window)  // Window length
+}
+
+// TestNewFixedWindow_RejectsInvalidParams verifies that a window without whole milliseconds or a zero limit is rejected
+func TestNewFixedWindow_RejectsInvalidParams(t *testing.T) {
+	assert.Panics(t, func() { NewFixedWindow(10, 0) })
+	assert.Panics(t, func() { NewFixedWindow(10, time.Microsecond) })
+	assert.Panics(t, func() { NewFixedWindow(10, 1500*time.Microsecond) })
+	assert.Panics(t, func() { NewFixedWindow(0, time.Minute) })
+}
+
+// TestFixedWindow_ImplementsInterface ensures FixedWindow implements RateLimiter
+func TestFixedWindow_ImplementsInterface(t *testing.T) {
+	var _ RateLimiter = (*FixedWindow)(nil)
+}
+
+// TestFixedWindow_WindowStart tests that windows are aligned to the window length
+func TestFixedWindow_WindowStart(t *testing.T) {
+	fw := NewFixedWindow(10, time.Minute)
+
+	now := time.UnixMilli(1_700_000_123_456)
+	assert.Equal(t, int64(1_700_000_100_000), fw.windowStart(now))
+	assert.Equal(t, "window:{client}:1700000100000", fw.counterKey("client", fw.windowStart(now)))
+}
+
+// TestFixedWindow_Allow_FirstRequest tests first request in a window
+func TestFixedWindow_Allow_FirstRequest(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	fw := NewFixedWindow(5, time.Hour, WithClock(NewManualClock(testEpoch)), WithStorage(store))
+
+	// First request - counter becomes 1, 4 requests left
+	result, err := fw.Allow(ctx, "test_window_key")
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 4.0, result.Remaining)
+}
+
+// TestFixedWindow_Allow_LimitReached tests denial once the window is full
+func TestFixedWindow_Allow_LimitReached(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch.Add(6 * time.Second)) // 4 seconds before the window ends
+	fw := NewFixedWindow(5, 10*time.Second, WithClock(clk), WithStorage(store))
+
+	key := "test_window_full"
+
+	_, err := fw.AllowN(ctx, key, 5)
+	assert.NoError(t, err)
+
+	result, err := fw.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed) // Should be denied
+	assert.Equal(t, 0.0, result.Remaining)
+	assert.Equal(t, float64(fw.Limit), result.Limit)
+	assert.Equal(t, 4*time.Second, result.RetryAfter) // Next window
+	assert.Equal(t, testEpoch.Add(10*time.Second), result.ResetAt)
+	assert.Equal(t, AlgorithmFixedWindow, result.Algorithm)
+}
+
+// TestFixedWindow_AllowN_Batch tests counting several requests in one call
+func TestFixedWindow_AllowN_Batch(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	fw := NewFixedWindow(100, time.Hour, WithClock(NewManualClock(testEpoch)), WithStorage(store))
+
+	result, err := fw.AllowN(ctx, "test_window_batch", 25)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 75.0, result.Remaining)
+}
+
+// TestFixedWindow_Allow_RedisError tests that script errors are returned
+func TestFixedWindow_Allow_RedisError(t *testing.T) {
+	mock := setupMockRedis()
+	fw := NewFixedWindow(5, time.Hour)
+
+	key := "test_window_error"
+
+	expectScript(mock, fw, key, 1).SetErr(fmt.Errorf("connection refused"))
+
+	result, err := fw.Allow(ctx, key)
+	assert.Error(t, err)
+	assert.Nil(t, result)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestFixedWindow_Reset tests resetting the current window counter
+func TestFixedWindow_Reset(t *testing.T) {
+	mock := setupMockRedis()
+	fw := NewFixedWindow(5, time.Hour)
+
+	key := "reset_window_test"
+	counterKey := fw.counterKey(key, fw.windowStart(time.Now()))
+
+	mock.ExpectDel(counterKey).SetVal(1)
+
+	err := fw.Reset(ctx, key)
+	assert.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestFixedWindow_GetStatus tests retrieving current window status
+func TestFixedWindow_GetStatus(t *testing.T) {
+	mock := setupMockRedis()
+	fw := NewFixedWindow(10, 10*time.Second)
+
+	key := "status_window_test"
+	counterKey := fw.counterKey(key, fw.windowStart(time.Now()))
+
+	mock.ExpectGet(counterKey).SetVal("7")
+
+	status, err := fw.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, key, status.Key)
+	assert.Equal(t, 7.0, status.Current)   // 7 requests counted
+	assert.Equal(t, 10.0, status.Capacity) // Limit per window
+	assert.Equal(t, 3.0, status.Remaining) // 10 - 7 = 3
+	assert.Equal(t, 1.0, status.LeakRate)  // 10 per 10 seconds
+	assert.False(t, status.IsLimited)
+	assert.Equal(t, AlgorithmFixedWindow, status.Algorithm)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestFixedWindow_GetStatus_Limited tests status when the window is full
+func TestFixedWindow_GetStatus_Limited(t *testing.T) {
+	mock := setupMockRedis()
+	fw := NewFixedWindow(5, time.Hour)
+
+	key := "limited_window_test"
+	counterKey := fw.counterKey(key, fw.windowStart(time.Now()))
+
+	mock.ExpectGet(counterKey).SetVal("5")
+
+	status, err := fw.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, status.Remaining)
+	assert.True(t, status.IsLimited)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestFixedWindow_GetStatus_Empty tests status of a window without requests
+func TestFixedWindow_GetStatus_Empty(t *testing.T) {
+	mock := setupMockRedis()
+	fw := NewFixedWindow(5, time.Hour)
+
+	key := "empty_window_test"
+	counterKey := fw.counterKey(key, fw.windowStart(time.Now()))
+
+	mock.ExpectGet(counterKey).RedisNil()
+
+	status, err := fw.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, status.Current)
+	assert.Equal(t, 5.0, status.Remaining)
+	assert.False(t, status.IsLimited)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFixedWindow_MemoryStorage(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch.Add(4 * time.Second))
+	fw := NewFixedWindow(3, 10*time.Second, WithClock(clk), WithStorage(store))
+
+	key := "memory_window_test"
+
+	result, err := fw.AllowN(ctx, key, 3)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0.0, result.Remaining)
+
+	// Window full until it ends 6 seconds later
+	result, err = fw.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 6*time.Second, result.RetryAfter)
+
+	status, err := fw.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 3.0, status.Current)
+	assert.True(t, status.IsLimited)
+
+	clk.Advance(6 * time.Second)
+	result, err = fw.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 2.0, result.Remaining)
+
+	assert.NoError(t, fw.Reset(ctx, key))
+	status, err = fw.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, status.Current)
+}
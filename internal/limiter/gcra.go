@@ -0,0 +1,261 @@
+package limiter
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+// Pastikan GCRA implement RateLimiter interface
+var _ RateLimiter = (*GCRA)(nil)
+var _ KeyLister = (*GCRA)(nil)
+
+// GCRA implements the Generic Cell Rate Algorithm.
+// It behaves like a Token Bucket with the same Capacity and Rate, but stores a
+// single value per key: the theoretical arrival time (TAT) of the next request.
+// - Each request pushes TAT forward by one emission interval (1/Rate seconds)
+// - A request is allowed if TAT - now stays within Capacity emission intervals
+// - Remaining and retry-after are derived exactly from TAT
+type GCRA struct {
+	Capacity  float64 // Maximum burst size
+	Rate      float64 // Sustained requests per second
+	Clock     Clock
+	Storage   storage.Storage
+	Namespace string
+
+	changedAt int64 // Unix ms of the last config change (0 = never); see setConfig
+}
+
+// NewGCRA creates a new GCRA instance
+// capacity: maximum burst size
+// rate: sustained requests per second
+// Panics if capacity or rate is not positive.
+func NewGCRA(capacity, rate float64, opts ...Option) *GCRA {
+	if err := checkBucketConfig(Config{Capacity: capacity, Rate: rate}); err != nil {
+		panic(err)
+	}
+	o := applyOptions(opts)
+	return &GCRA{
+		Capacity:  capacity,
+		Rate:      rate,
+		Clock:     o.clock,
+		Storage:   o.storage,
+		Namespace: o.namespace,
+	}
+}
+
+// now returns the current time from Clock
+func (g *GCRA) now() time.Time {
+	return nowFrom(g.Clock)
+}
+
+// store returns the state backend
+func (g *GCRA) store() storage.Storage {
+	return storeFrom(g.Storage)
+}
+
+// tatKey generates Redis key for the theoretical arrival time, stored as "<tat> <rate>"
+func (g *GCRA) tatKey(key string) string {
+	return namespacedKey(g.Namespace, "gcra:"+hashTag(key))
+}
+
+// KeyPattern returns the Redis key pattern of the TAT keys and how to extract the client key (used by the dashboard)
+func (g *GCRA) KeyPattern() (string, func(string) string) {
+	prefix := namespacedKey(g.Namespace, "gcra:{")
+	return prefix + "*}", clientKeyBetween(prefix, "}")
+}
+
+// emissionInterval returns the time between requests at the sustained rate (ms)
+func (g *GCRA) emissionInterval() float64 {
+	return 1000 / g.Rate
+}
+
+// gcraScript checks and advances the theoretical arrival time atomically
+// KEYS[1] = TAT key ("<tat> <rate it was written with>"; older keys hold only the TAT)
+// ARGV[1] = capacity, ARGV[2] = emission interval (ms), ARGV[3] = now (ms), ARGV[4] = cost,
+// ARGV[5] = rate, ARGV[6] = last config change (unix ms, 0 = never)
+// Returns: {allowed (0/1), remaining burst, retry after (ms), reset after (ms)} (numbers as strings)
+var gcraScript = storage.NewScript(`
+local capacity = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+local rate = tonumber(ARGV[5])
+local changed_at = tonumber(ARGV[6])
+
+local tat = now
+local value = redis.call('GET', KEYS[1])
+if value then
+  local stored_tat, stored_rate = string.match(value, '^(%S+)%s*(%S*)$')
+  tat = tonumber(stored_tat) or now
+  stored_rate = tonumber(stored_rate) or rate
+
+  -- Same steps as rescaleTAT in config.go
+  local at = now
+  if changed_at > 0 and changed_at < now then
+    at = changed_at
+  end
+  if stored_rate ~= rate and tat > at then
+    tat = at + (tat - at) * stored_rate / rate
+  end
+end
+tat = math.max(tat, now)
+
+local new_tat = tat + interval * cost
+local allow_at = new_tat - capacity * interval
+if now < allow_at then
+  local remaining = math.max(0, (capacity * interval - (tat - now)) / interval)
+  return {0, tostring(remaining), tostring(allow_at - now), tostring(tat - now)}
+end
+
+redis.call('SET', KEYS[1], tostring(new_tat) .. ' ' .. ARGV[5], 'PX', math.ceil(new_tat - now))
+
+return {1, tostring((capacity * interval - (new_tat - now)) / interval), '0', tostring(new_tat - now)}
+`).WithLocal(gcraLocal)
+
+// gcraLocal is the Go version of gcraScript for storages without Lua
+func gcraLocal(tx storage.Tx, keys []string, args []interface{}) ([]interface{}, error) {
+	capacity := argFloat(args[0])
+	interval := argFloat(args[1])
+	now := argFloat(args[2])
+	cost := argFloat(args[3])
+	rate := argFloat(args[4])
+	changedAt := argFloat(args[5])
+
+	tat := now
+	if val, ok := tx.Get(keys[0]); ok {
+		tat = parseTAT(val, now, changedAt, rate)
+	}
+	tat = math.Max(tat, now)
+
+	newTat := tat + interval*cost
+	allowAt := newTat - capacity*interval
+	if now < allowAt {
+		remaining := math.Max(0, (capacity*interval-(tat-now))/interval)
+		return scriptReply(false, remaining, allowAt-now, tat-now), nil
+	}
+
+	tx.Set(keys[0], formatTAT(newTat, rate), time.Duration(math.Ceil(newTat-now))*time.Millisecond)
+
+	return scriptReply(true, (capacity*interval-(newTat-now))/interval, 0, newTat-now), nil
+}
+
+// parseTAT reads a stored "<tat> <rate>" value and rescales it to rate (see rescaleTAT).
+// A value without a rate was written before rates were stored and is taken as is.
+func parseTAT(val string, now, changedAt, rate float64) float64 {
+	tatVal, rateVal, _ := strings.Cut(val, " ")
+	tat, err := strconv.ParseFloat(tatVal, 64)
+	if err != nil {
+		return now
+	}
+	storedRate, err := strconv.ParseFloat(rateVal, 64)
+	if err != nil {
+		storedRate = rate
+	}
+	return rescaleTAT(tat, now, changedAt, storedRate, rate)
+}
+
+// formatTAT formats a TAT with the rate it was computed at, as parseTAT reads it
+func formatTAT(tat, rate float64) string {
+	return formatNumber(tat) + " " + formatNumber(rate)
+}
+
+// Allow checks whether the request conforms and advances the TAT if so.
+// Result.Remaining = burst left, Result.ResetAt = when the TAT catches up with real time
+func (g *GCRA) Allow(ctx context.Context, key string) (*Result, error) {
+	return g.AllowN(ctx, key, 1)
+}
+
+// AllowN is like Allow but advances the TAT by n emission intervals (all or nothing).
+// A cost above Capacity can never conform and returns ErrCostExceedsLimit.
+func (g *GCRA) AllowN(ctx context.Context, key string, n int64) (*Result, error) {
+	if n < 1 {
+		return nil, ErrInvalidCost
+	}
+	if float64(n) > g.Capacity {
+		return nil, ErrCostExceedsLimit
+	}
+
+	now := g.now()
+
+	res, err := g.store().Eval(ctx, gcraScript,
+		[]string{g.tatKey(key)}, g.Capacity, g.emissionInterval(), now.UnixMilli(), n, g.Rate, g.changedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := parseScriptResult(res, now)
+	if err != nil {
+		return nil, err
+	}
+	result.Limit = g.Capacity
+	result.Window = rateWindow(g.Capacity, g.Rate)
+	result.Algorithm = AlgorithmGCRA
+	return result, nil
+}
+
+// Reset clears the theoretical arrival time for a specific key
+func (g *GCRA) Reset(ctx context.Context, key string) error {
+	return g.store().Del(ctx, g.tatKey(key))
+}
+
+// state reads the TAT and returns (remaining burst, time until next request is allowed)
+func (g *GCRA) state(ctx context.Context, key string) (float64, time.Duration, error) {
+	now := float64(g.now().UnixMilli())
+
+	// Retrieve theoretical arrival time
+	tatVal, err := g.store().Get(ctx, g.tatKey(key))
+	tat := now
+	if err == storage.ErrNotFound {
+		// Key doesn't exist - full burst available
+	} else if err != nil {
+		return 0, 0, err
+	} else {
+		tat = parseTAT(tatVal, now, float64(g.changedAt), g.Rate)
+	}
+
+	interval := g.emissionInterval()
+	backlog := math.Max(tat-now, 0) // How far TAT is ahead of now (ms)
+
+	remaining := (g.Capacity*interval - backlog) / interval
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	// Next request is allowed once TAT + interval - capacity*interval <= now
+	retryAfter := backlog + interval - g.Capacity*interval
+	if retryAfter < 0 {
+		retryAfter = 0
+	}
+
+	return remaining, time.Duration(retryAfter * float64(time.Millisecond)), nil
+}
+
+// RetryAfter returns how long until the next request for key would be allowed (0 = now)
+func (g *GCRA) RetryAfter(ctx context.Context, key string) (time.Duration, error) {
+	_, retryAfter, err := g.state(ctx, key)
+	return retryAfter, err
+}
+
+// GetStatus retrieves current GCRA status for a key
+func (g *GCRA) GetStatus(ctx context.Context, key string) (*Status, error) {
+	remaining, retryAfter, err := g.state(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Same shape as Token Bucket so dashboard gauges work unchanged
+	return &Status{
+		Key:       key,
+		Current:   g.Capacity - remaining, // Used burst
+		Capacity:  g.Capacity,             // Maximum burst size
+		Remaining: remaining,              // Burst still available
+		LeakRate:  g.Rate,                 // Sustained rate (reusing LeakRate field)
+		IsLimited: retryAfter > 0,         // Limited if next request must wait
+		Algorithm: AlgorithmGCRA,
+	}, nil
+}
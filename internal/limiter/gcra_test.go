@@ -0,0 +1,207 @@
+package limiter
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+// TestNewGCRA verifies GCRA constructor
+func TestNewGCRA(t *testing.T) {
+	g := NewGCRA(10, 2)
+
+	assert.Equal(t, 10.0, g.Capacity)            // Burst size
+	assert.Equal(t, 2.0, g.Rate)                 // Requests per second
+	assert.Equal(t, 500.0, g.emissionInterval()) // 1 request every 500ms
+}
+
+// TestNewGCRA_RejectsInvalidParams verifies that a zero rate (infinite emission interval) is rejected
+func TestNewGCRA_RejectsInvalidParams(t *testing.T) {
+	assert.Panics(t, func() { NewGCRA(0, 2) })
+	assert.Panics(t, func() { NewGCRA(10, 0) })
+}
+
+// TestGCRA_ImplementsInterface ensures GCRA implements RateLimiter
+func TestGCRA_ImplementsInterface(t *testing.T) {
+	var _ RateLimiter = (*GCRA)(nil)
+}
+
+// TestGCRA_Allow_FirstRequest tests first request with no stored TAT
+func TestGCRA_Allow_FirstRequest(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	g := NewGCRA(5, 1, WithClock(NewManualClock(testEpoch)), WithStorage(store))
+
+	result, err := g.Allow(ctx, "test_gcra_key")
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 4.0, result.Remaining)
+}
+
+// TestGCRA_Allow_Denied tests denial when TAT is too far ahead
+func TestGCRA_Allow_Denied(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	g := NewGCRA(5, 1, WithClock(NewManualClock(testEpoch)), WithStorage(store))
+
+	key := "test_gcra_denied"
+
+	_, err := g.AllowN(ctx, key, 5) // TAT 5 seconds ahead
+	assert.NoError(t, err)
+
+	result, err := g.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0.0, result.Remaining)
+	assert.Equal(t, g.Capacity, result.Limit)
+	assert.Equal(t, time.Second, result.RetryAfter) // One emission interval
+	assert.Equal(t, testEpoch.Add(5*time.Second), result.ResetAt)
+	assert.Equal(t, AlgorithmGCRA, result.Algorithm)
+}
+
+// TestGCRA_Reset tests resetting the TAT
+func TestGCRA_Reset(t *testing.T) {
+	mock := setupMockRedis()
+	g := NewGCRA(5, 1)
+
+	key := "reset_gcra_test"
+
+	mock.ExpectDel("gcra:{" + key + "}").SetVal(1)
+
+	err := g.Reset(ctx, key)
+	assert.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestGCRA_GetStatus_Empty tests status when no TAT is stored
+func TestGCRA_GetStatus_Empty(t *testing.T) {
+	mock := setupMockRedis()
+	g := NewGCRA(10, 2)
+
+	key := "empty_gcra_test"
+
+	mock.ExpectGet("gcra:{" + key + "}").RedisNil()
+
+	status, err := g.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, key, status.Key)
+	assert.Equal(t, 0.0, status.Current)
+	assert.Equal(t, 10.0, status.Capacity)
+	assert.Equal(t, 10.0, status.Remaining)
+	assert.Equal(t, 2.0, status.LeakRate)
+	assert.False(t, status.IsLimited)
+	assert.Equal(t, AlgorithmGCRA, status.Algorithm)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestGCRA_GetStatus_PartialBurst tests remaining burst derived from TAT
+func TestGCRA_GetStatus_PartialBurst(t *testing.T) {
+	mock := setupMockRedis()
+	g := NewGCRA(10, 1) // 1000ms emission interval
+
+	key := "partial_gcra_test"
+
+	// TAT is 3 intervals ahead of now: 3 requests of burst used
+	tat := time.Now().UnixMilli() + 3000
+	mock.ExpectGet("gcra:{" + key + "}").SetVal(strconv.FormatInt(tat, 10))
+
+	status, err := g.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.InDelta(t, 3.0, status.Current, 0.05)
+	assert.InDelta(t, 7.0, status.Remaining, 0.05)
+	assert.False(t, status.IsLimited)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestGCRA_RetryAfter tests exact retry-after when the burst is exhausted
+func TestGCRA_RetryAfter(t *testing.T) {
+	mock := setupMockRedis()
+	g := NewGCRA(5, 1) // 1000ms emission interval
+
+	key := "retry_gcra_test"
+
+	// TAT is 5.5 intervals ahead: next request allowed in 1.5s (5.5 + 1 - 5)
+	tat := time.Now().UnixMilli() + 5500
+	mock.ExpectGet("gcra:{" + key + "}").SetVal(strconv.FormatInt(tat, 10))
+
+	retryAfter, err := g.RetryAfter(ctx, key)
+	assert.NoError(t, err)
+	assert.InDelta(t, float64(1500*time.Millisecond), float64(retryAfter), float64(50*time.Millisecond))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestGCRA_GetStatus_Limited tests status when the next request must wait
+func TestGCRA_GetStatus_Limited(t *testing.T) {
+	mock := setupMockRedis()
+	g := NewGCRA(5, 1)
+
+	key := "limited_gcra_test"
+
+	tat := time.Now().UnixMilli() + 5000
+	mock.ExpectGet("gcra:{" + key + "}").SetVal(strconv.FormatInt(tat, 10))
+
+	status, err := g.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.0, status.Remaining, 0.05)
+	assert.True(t, status.IsLimited)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestGCRA_Allow_RedisError tests that script errors are returned
+func TestGCRA_Allow_RedisError(t *testing.T) {
+	mock := setupMockRedis()
+	g := NewGCRA(5, 1)
+
+	key := "test_gcra_error"
+
+	expectScript(mock, g, key, 1).SetErr(fmt.Errorf("connection refused"))
+
+	result, err := g.Allow(ctx, key)
+	assert.Error(t, err)
+	assert.Nil(t, result)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGCRA_MemoryStorage(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	g := NewGCRA(2, 2, WithClock(clk), WithStorage(store))
+
+	key := "memory_gcra_test"
+
+	result, err := g.AllowN(ctx, key, 2)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0.0, result.Remaining)
+
+	// Burst used up: the next request conforms one emission interval (500ms) later
+	result, err = g.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+
+	retryAfter, err := g.RetryAfter(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+
+	clk.Advance(500 * time.Millisecond)
+	result, err = g.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	assert.NoError(t, g.Reset(ctx, key))
+	status, err := g.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, status.Current)
+}
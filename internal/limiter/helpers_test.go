@@ -0,0 +1,45 @@
+package limiter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+// expectScript mendaftarkan ekspektasi EVALSHA untuk satu request (cost n) ke Lua script limiter rl.
+// Semua argumen dicocokkan sebagai regexp: now, window start dan ID member random berubah setiap run,
+// jadi dicocokkan dengan pola; argumen lain harus sama persis dengan parameter limiter saat ini.
+func expectScript(mock redismock.ClientMock, rl interface{}, key string, n int64) *redismock.ExpectedCmd {
+	var script *storage.Script
+	var storageKey string
+	var args []interface{}
+	switch l := rl.(type) {
+	case *LeakyBucket:
+		script, storageKey = leakyBucketScript, regexp.QuoteMeta(l.bucketKey(key))
+		args = []interface{}{l.Capacity, l.LeakRate, `^\d{13}$`, l.TTL.Milliseconds(), n, l.MaxDelay.Milliseconds(), l.changedAt}
+	case *TokenBucket:
+		script, storageKey = tokenBucketScript, regexp.QuoteMeta(l.bucketKey(key))
+		args = []interface{}{l.Capacity, l.RefillRate, `^\d{13}$`, l.TTL.Milliseconds(), n, l.changedAt}
+	case *GCRA:
+		script, storageKey = gcraScript, regexp.QuoteMeta(l.tatKey(key))
+		args = []interface{}{l.Capacity, l.emissionInterval(), `\d+`, n, l.Rate, l.changedAt}
+	case *FixedWindow:
+		script, storageKey = fixedWindowScript, regexp.QuoteMeta(strings.TrimSuffix(l.counterKey(key, 0), "0"))+`\d+`
+		args = []interface{}{l.Limit, `\d+`, n}
+	case *SlidingWindowLog:
+		script, storageKey = slidingWindowLogScript, regexp.QuoteMeta(l.logKey(key))
+		args = []interface{}{l.Limit, l.Window.Milliseconds(), `\d+`, `^\d+-[0-9a-z]+$`, n}
+	case *SlidingWindowCounter:
+		script, storageKey = slidingWindowCounterScript, regexp.QuoteMeta(l.counterKey(key))
+		args = []interface{}{l.Limit, l.Window.Milliseconds(), `\d+`, n}
+	case *ConcurrencyLimiter: // Acquire selalu mengambil satu slot, n diabaikan
+		script, storageKey = acquireScript, regexp.QuoteMeta(l.inflightKey(key))
+		args = []interface{}{l.Limit, l.LeaseTTL.Milliseconds(), `\d+`, `^\d+-[0-9a-z]+$`}
+	default:
+		panic(fmt.Sprintf("expectScript: unsupported limiter %T", rl))
+	}
+	return mock.Regexp().ExpectEvalSha(script.Hash(), []string{storageKey}, args...)
+}
@@ -2,163 +2,268 @@ package limiter
 
 import (
 	"context"
+	"math"
 	"strconv"
 	"time"
 
-	"github.com/redis/go-redis/v9"
 	"github.com/user/Rate-Limiting-API/internal/storage"
 )
 
-// Pastikan LeakyBucket implement RateLimiter interface
-var _ RateLimiter = (*LeakyBucket)(nil)
+// Pastikan LeakyBucket implement RateLimiter dan Waiter interface
+var (
+	_ RateLimiter = (*LeakyBucket)(nil)
+	_ Waiter      = (*LeakyBucket)(nil)
+)
 
+// LeakyBucket secara default bekerja sebagai meter: request ditolak saat bucket penuh.
+// Dengan MaxDelay > 0 bucket bekerja sebagai antrian (traffic shaping):
+// - Request yang membuat bucket overflow tetap diterima dengan Result.Delay > 0
+// - Result.Delay = waktu tunggu sampai gilirannya keluar dengan kecepatan LeakRate
+// - Request ditolak hanya jika waktu tunggu tersebut melebihi MaxDelay
 type LeakyBucket struct {
-	Capacity float64       // Kapasitas maksimum bucket
-	LeakRate float64       // Jumlah request yang "bocor" per detik
-	TTL      time.Duration // TTL untuk Redis keys (0 = no expiry)
+	Capacity  float64       // Kapasitas maksimum bucket
+	LeakRate  float64       // Jumlah request yang "bocor" per detik
+	TTL       time.Duration // TTL untuk Redis keys (0 = no expiry)
+	MaxDelay  time.Duration // Delay antrian maksimum pada shaping mode (0 = meter, tolak saat penuh)
+	Clock     Clock
+	Storage   storage.Storage
+	Namespace string
+
+	changedAt int64 // Unix ms perubahan config terakhir (0 = belum pernah); lihat setConfig
 }
 
-// NewLeakyBucket membuat instance baru LeakyBucket
-func NewLeakyBucket(capacity, leakRate float64, ttl time.Duration) *LeakyBucket {
+// NewLeakyBucket membuat instance baru LeakyBucket.
+// Panic jika capacity atau leakRate tidak positif, atau ttl negatif.
+func NewLeakyBucket(capacity, leakRate float64, ttl time.Duration, opts ...Option) *LeakyBucket {
+	if err := checkBucketConfig(Config{Capacity: capacity, Rate: leakRate, TTL: ttl}); err != nil {
+		panic(err)
+	}
+	o := applyOptions(opts)
 	return &LeakyBucket{
-		Capacity: capacity,
-		LeakRate: leakRate,
-		TTL:      ttl,
+		Capacity:  capacity,
+		LeakRate:  leakRate,
+		TTL:       ttl,
+		Clock:     o.clock,
+		Storage:   o.storage,
+		Namespace: o.namespace,
 	}
 }
 
-// waterKey dan timeKey helper untuk generate Redis keys
-func (lb *LeakyBucket) waterKey(key string) string {
-	return "bucket:" + key + ":water"
+// NewShapingLeakyBucket membuat LeakyBucket dalam shaping mode:
+// request yang overflow ditahan maksimal maxDelay, bukan langsung ditolak
+func NewShapingLeakyBucket(capacity, leakRate float64, maxDelay, ttl time.Duration, opts ...Option) *LeakyBucket {
+	lb := NewLeakyBucket(capacity, leakRate, ttl, opts...)
+	lb.MaxDelay = maxDelay
+	return lb
 }
 
-func (lb *LeakyBucket) timeKey(key string) string {
-	return "bucket:" + key + ":time"
+// now mengembalikan waktu saat ini dari Clock
+func (lb *LeakyBucket) now() time.Time {
+	return nowFrom(lb.Clock)
 }
 
-// Allow mengecek apakah request diizinkan dan mengupdate status di Redis
-// Returns: (allowed, remaining capacity, error)
-func (lb *LeakyBucket) Allow(ctx context.Context, key string) (bool, float64, error) {
-	waterKey := lb.waterKey(key)
-	timeKey := lb.timeKey(key)
+// store mengembalikan backend penyimpanan state
+func (lb *LeakyBucket) store() storage.Storage {
+	return storeFrom(lb.Storage)
+}
+
+// bucketKey helper untuk generate Redis key; state disimpan sebagai HASH dengan field water, time dan rate
+func (lb *LeakyBucket) bucketKey(key string) string {
+	return namespacedKey(lb.Namespace, "bucket:"+hashTag(key))
+}
 
-	now := time.Now().Unix()
+// KeyPattern mengembalikan pattern Redis key bucket dan fungsi untuk mengambil key client (dipakai dashboard)
+func (lb *LeakyBucket) KeyPattern() (string, func(string) string) {
+	prefix := namespacedKey(lb.Namespace, "bucket:{")
+	return prefix + "*}", clientKeyBetween(prefix, "}")
+}
 
-	// Ambil nilai water level dari Redis
-	waterVal, err := storage.RedisClient.Get(ctx, waterKey).Result()
-	var waterLevel float64
-	if err == redis.Nil {
-		waterLevel = 0
-	} else if err != nil {
-		return false, 0, err
-	} else {
-		waterLevel, _ = strconv.ParseFloat(waterVal, 64)
-	}
+// leakyBucketScript menjalankan read-compute-write Leaky Bucket secara atomik di Redis
+// KEYS[1] = bucket key (HASH dengan field water, time dan rate = leak rate saat ditulis)
+// ARGV[1] = capacity, ARGV[2] = leak rate, ARGV[3] = now (unix ms), ARGV[4] = TTL (ms, 0 = no expiry),
+// ARGV[5] = cost, ARGV[6] = max queue delay (ms, 0 = meter mode), ARGV[7] = perubahan config terakhir (unix ms, 0 = belum pernah)
+// Returns: {allowed (0/1), remaining capacity, retry after (ms), reset after (ms), delay (ms)} (angka sebagai string)
+var leakyBucketScript = storage.NewScript(`
+local capacity = tonumber(ARGV[1])
+local leak_rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+local cost = tonumber(ARGV[5])
+local max_delay = tonumber(ARGV[6])
+local changed_at = tonumber(ARGV[7])
+
+local state = redis.call('HMGET', KEYS[1], 'water', 'time', 'rate')
+local water = tonumber(state[1]) or 0
+local last = tonumber(state[2]) or now
+local stored_rate = tonumber(state[3]) or leak_rate
 
-	// Ambil last update time dari Redis
-	timeVal, err := storage.RedisClient.Get(ctx, timeKey).Result()
-	var lastTime int64
-	if err == redis.Nil {
-		lastTime = now
-	} else if err != nil {
-		return false, 0, err
-	} else {
-		lastTime, _ = strconv.ParseInt(timeVal, 10, 64)
+if last < 1e11 then
+  last = last * 1000 -- Timestamp lama (sebelum upgrade) masih dalam detik
+end
+
+-- Sebelum perubahan config terakhir air bocor dengan rate saat ditulis, sesudahnya dengan rate sekarang (lihat leak)
+local split = math.min(now, math.max(last, changed_at))
+water = math.max(0, water - (math.max(0, split - last) / 1000 * stored_rate + math.max(0, now - split) / 1000 * leak_rate))
+
+-- Waktu sampai air yang berada di atas capacity (termasuk request ini) sudah bocor.
+-- Request harus muat seluruhnya (water + cost <= capacity): dengan water 9.5 dari 10, request cost 1 ditunggu/ditolak
+local delay = math.max(0, (water + cost - capacity) / leak_rate * 1000)
+if delay > max_delay then
+  local retry_after = delay - max_delay
+  return {0, tostring(math.max(0, capacity - water)), tostring(retry_after), tostring(water / leak_rate * 1000), '0'}
+end
+
+water = water + cost
+
+redis.call('HSET', KEYS[1], 'water', tostring(water), 'time', tostring(now), 'rate', ARGV[2])
+if ttl > 0 then
+  redis.call('PEXPIRE', KEYS[1], ttl)
+else
+  redis.call('PERSIST', KEYS[1])
+end
+
+return {1, tostring(math.max(0, capacity - water)), '0', tostring(water / leak_rate * 1000), tostring(delay)}
+`).WithLocal(leakyBucketLocal)
+
+// leakyBucketLocal adalah versi Go dari leakyBucketScript untuk storage tanpa Lua (MemoryStorage).
+// Keys, args dan format reply sama persis dengan script.
+func leakyBucketLocal(tx storage.Tx, keys []string, args []interface{}) ([]interface{}, error) {
+	capacity := argFloat(args[0])
+	leakRate := argFloat(args[1])
+	now := argFloat(args[2])
+	ttl := time.Duration(argFloat(args[3])) * time.Millisecond
+	cost := argFloat(args[4])
+	maxDelay := argFloat(args[5])
+	changedAt := argFloat(args[6])
+
+	water := 0.0
+	if val, ok := tx.HGet(keys[0], "water"); ok {
+		water, _ = strconv.ParseFloat(val, 64)
+	}
+	last := now
+	if val, ok := tx.HGet(keys[0], "time"); ok {
+		if ts, err := parseTimestampMs(val); err == nil {
+			last = ts
+		}
+	}
+	storedRate := leakRate
+	if val, ok := tx.HGet(keys[0], "rate"); ok {
+		if rate, err := strconv.ParseFloat(val, 64); err == nil {
+			storedRate = rate
+		}
 	}
 
-	// Hitung jumlah air yang sudah "bocor" berdasarkan waktu berlalu
-	elapsed := float64(now - lastTime)
-	leaked := elapsed * lb.LeakRate
-	waterLevel = waterLevel - leaked
-	if waterLevel < 0 {
-		waterLevel = 0
+	water = leak(water, last, now, changedAt, storedRate, leakRate)
+
+	// Waktu sampai air yang berada di atas capacity (termasuk request ini) sudah bocor.
+	// Request harus muat seluruhnya (water + cost <= capacity): dengan water 9.5 dari 10, request cost 1 ditunggu/ditolak
+	delay := math.Max(0, (water+cost-capacity)/leakRate*1000)
+	if delay > maxDelay {
+		return scriptReply(false, math.Max(0, capacity-water), delay-maxDelay, water/leakRate*1000, 0), nil
 	}
 
-	// Cek apakah masih ada ruang di bucket
-	if waterLevel >= lb.Capacity {
-		// Bucket penuh, tolak request
-		return false, 0, nil
+	water += cost
+	tx.HSet(keys[0], map[string]string{"water": formatNumber(water), "time": formatNumber(now), "rate": formatNumber(leakRate)}, ttl)
+
+	return scriptReply(true, math.Max(0, capacity-water), 0, water/leakRate*1000, delay), nil
+}
+
+// Allow mengecek apakah request diizinkan dan mengupdate status di Redis
+// Seluruh proses dijalankan dalam satu Lua script (EVALSHA dengan fallback EVAL),
+// sehingga aman dari race condition antar instance API dan hanya butuh satu round trip.
+// Result.Remaining = sisa kapasitas, Result.ResetAt = waktu bucket kosong kembali
+func (lb *LeakyBucket) Allow(ctx context.Context, key string) (*Result, error) {
+	return lb.AllowN(ctx, key, 1)
+}
+
+// AllowN seperti Allow, tapi menambahkan n unit air sekaligus.
+// Request ditolak (tanpa mengubah state) jika n unit tidak muat di bucket.
+// Cost di atas Capacity (ditambah antrian MaxDelay) tidak akan pernah muat: ErrCostExceedsLimit.
+func (lb *LeakyBucket) AllowN(ctx context.Context, key string, n int64) (*Result, error) {
+	if n < 1 {
+		return nil, ErrInvalidCost
+	}
+	if float64(n) > lb.Capacity+lb.MaxDelay.Seconds()*lb.LeakRate {
+		return nil, ErrCostExceedsLimit
 	}
 
-	// Tambahkan 1 "air" (request) ke bucket
-	waterLevel = waterLevel + 1
+	keys := []string{lb.bucketKey(key)}
+	now := lb.now()
 
-	// Simpan level air terbaru ke Redis dengan TTL
-	err = storage.RedisClient.Set(ctx, waterKey, strconv.FormatFloat(waterLevel, 'f', -1, 64), lb.TTL).Err()
+	res, err := lb.store().Eval(ctx, leakyBucketScript, keys,
+		lb.Capacity, lb.LeakRate, now.UnixMilli(), lb.TTL.Milliseconds(), n, lb.MaxDelay.Milliseconds(), lb.changedAt)
 	if err != nil {
-		return false, 0, err
+		return nil, err
 	}
 
-	// Simpan waktu update terbaru ke Redis dengan TTL
-	err = storage.RedisClient.Set(ctx, timeKey, strconv.FormatInt(now, 10), lb.TTL).Err()
+	result, err := parseScriptResult(res, now)
 	if err != nil {
-		return false, 0, err
+		return nil, err
 	}
-
-	remaining := lb.Capacity - waterLevel
-	return true, remaining, nil
+	result.Limit = lb.Capacity
+	result.Window = rateWindow(lb.Capacity, lb.LeakRate)
+	result.Algorithm = AlgorithmLeakyBucket
+	return result, nil
 }
 
 // Reset menghapus semua state untuk key tertentu
 func (lb *LeakyBucket) Reset(ctx context.Context, key string) error {
-	waterKey := lb.waterKey(key)
-	timeKey := lb.timeKey(key)
-
-	pipe := storage.RedisClient.Pipeline()
-	pipe.Del(ctx, waterKey)
-	pipe.Del(ctx, timeKey)
-	_, err := pipe.Exec(ctx)
-	return err
+	return lb.store().Del(ctx, lb.bucketKey(key))
+}
+
+// Reserve menghitung berapa lama sampai bucket punya ruang untuk satu request lagi.
+// Di shaping mode request sudah diterima saat antriannya muat dalam MaxDelay.
+// Tidak mengubah state; gunakan Wait untuk benar-benar mengambil slot.
+func (lb *LeakyBucket) Reserve(ctx context.Context, key string) (time.Duration, error) {
+	status, err := lb.GetStatus(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	// Air harus bocor sampai water + 1 - capacity <= MaxDelay * LeakRate (aturan yang sama dengan script)
+	excess := status.Current + 1 - lb.Capacity - lb.MaxDelay.Seconds()*lb.LeakRate
+	if excess <= 0 {
+		return 0, nil
+	}
+	return time.Duration(excess / lb.LeakRate * float64(time.Second)), nil
+}
+
+// Wait memblok sampai request diizinkan, atau mengembalikan error jika context
+// selesai / slot baru tersedia setelah deadline context (ErrWaitExceedsDeadline).
+func (lb *LeakyBucket) Wait(ctx context.Context, key string) error {
+	return waitFor(ctx, lb, key)
 }
 
 // GetStatus mendapatkan status rate limiter untuk key tertentu
 func (lb *LeakyBucket) GetStatus(ctx context.Context, key string) (*Status, error) {
-	waterKey := lb.waterKey(key)
-	timeKey := lb.timeKey(key)
+	now := float64(lb.now().UnixMilli())
 
-	now := time.Now().Unix()
+	// Ambil water level dan last update time dari hash (map kosong jika key belum ada)
+	state, err := lb.store().HGetAll(ctx, lb.bucketKey(key))
+	if err != nil {
+		return nil, err
+	}
 
-	// Ambil nilai water level dari Redis
-	waterVal, err := storage.RedisClient.Get(ctx, waterKey).Result()
 	var waterLevel float64
-	var keyExists bool
-	if err == redis.Nil {
-		waterLevel = 0
-		keyExists = false
-	} else if err != nil {
-		return nil, err
-	} else {
+	if waterVal, ok := state["water"]; ok {
 		waterLevel, _ = strconv.ParseFloat(waterVal, 64)
-		keyExists = true
 	}
 
-	// Ambil last update time dari Redis
-	timeVal, err := storage.RedisClient.Get(ctx, timeKey).Result()
-	var lastTime int64
-	if err == redis.Nil {
-		lastTime = now
-	} else if err != nil {
-		return nil, err
-	} else {
-		lastTime, _ = strconv.ParseInt(timeVal, 10, 64)
+	lastTime := now
+	if timeVal, ok := state["time"]; ok {
+		lastTime, _ = parseTimestampMs(timeVal) // Nilai lama dalam detik dikonversi ke ms
 	}
 
-	// Hitung leakage
-	elapsed := float64(now - lastTime)
-	leaked := elapsed * lb.LeakRate
-	waterLevel = waterLevel - leaked
-	if waterLevel < 0 {
-		waterLevel = 0
+	storedRate := lb.LeakRate // Key dari sebelum field rate ada
+	if rateVal, ok := state["rate"]; ok {
+		storedRate, _ = strconv.ParseFloat(rateVal, 64)
 	}
 
-	// IMPORTANT: Save the updated state to Redis to ensure consistency
-	// Only save if the key already exists (has been used before)
-	if keyExists && elapsed > 0 {
-		// Save updated water level
-		storage.RedisClient.Set(ctx, waterKey, strconv.FormatFloat(waterLevel, 'f', -1, 64), lb.TTL)
-		// Save current time as last update time
-		storage.RedisClient.Set(ctx, timeKey, strconv.FormatInt(now, 10), lb.TTL)
-	}
+	// Hitung leakage (timestamp dalam milidetik), dengan rate lama sampai perubahan config terakhir
+	waterLevel = leak(waterLevel, lastTime, now, float64(lb.changedAt), storedRate, lb.LeakRate)
+
+	// GetStatus hanya membaca state; leakage dihitung dari waktu yang tersimpan.
+	// State tidak ditulis ulang agar tidak menimpa update atomik dari Allow.
 
 	remaining := lb.Capacity - waterLevel
 	if remaining < 0 {
@@ -171,7 +276,7 @@ func (lb *LeakyBucket) GetStatus(ctx context.Context, key string) (*Status, erro
 		Capacity:  lb.Capacity,
 		Remaining: remaining,
 		LeakRate:  lb.LeakRate,
-		IsLimited: waterLevel >= lb.Capacity,
-		Algorithm: "leaky_bucket",
+		IsLimited: waterLevel+1 > lb.Capacity+lb.MaxDelay.Seconds()*lb.LeakRate, // Request cost 1 tidak muat, termasuk antrian shaping
+		Algorithm: AlgorithmLeakyBucket,
 	}, nil
 }
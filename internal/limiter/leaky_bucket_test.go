@@ -13,6 +13,13 @@ import (
 
 var ctx = context.TODO()
 
+// redisError mensimulasikan error reply dari server Redis (misalnya NOSCRIPT)
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+func (e redisError) RedisError() {}
+
 func setupMockRedis() redismock.ClientMock {
 	db, mock := redismock.NewClientMock()
 	storage.RedisClient = db
@@ -27,128 +34,261 @@ func TestNewLeakyBucket(t *testing.T) {
 	assert.Equal(t, time.Hour, lb.TTL)
 }
 
+func TestNewLeakyBucket_RejectsInvalidParams(t *testing.T) {
+	assert.Panics(t, func() { NewLeakyBucket(0, 2, time.Hour) })
+	assert.Panics(t, func() { NewLeakyBucket(10, 0, time.Hour) })
+	assert.Panics(t, func() { NewShapingLeakyBucket(10, -1, time.Second, time.Hour) })
+	assert.Panics(t, func() { NewLeakyBucket(10, 2, -time.Hour) })
+}
+
 func TestLeakyBucket_ImplementsInterface(t *testing.T) {
 	var _ RateLimiter = (*LeakyBucket)(nil)
 }
 
-func TestLeakyBucket_Allow_FirstRequest(t *testing.T) {
-	mock := setupMockRedis()
-	lb := NewLeakyBucket(5, 1, time.Hour)
+func TestLeakyBucket_KeyUsesHashTag(t *testing.T) {
+	lb := NewLeakyBucket(10, 2, time.Hour)
 
-	key := "test_key"
-	waterKey := fmt.Sprintf("bucket:%s:water", key)
-	timeKey := fmt.Sprintf("bucket:%s:time", key)
+	// Redis Cluster hanya meng-hash bagian {...}, jadi key lain untuk client yang sama ada di slot yang sama
+	assert.Equal(t, "bucket:{1.2.3.4}", lb.bucketKey("1.2.3.4"))
+}
 
-	// First request - keys don't exist yet
-	mock.ExpectGet(waterKey).RedisNil()
-	mock.ExpectGet(timeKey).RedisNil()
-	mock.ExpectSet(waterKey, "1", time.Hour).SetVal("OK")
-	mock.Regexp().ExpectSet(timeKey, `\d+`, time.Hour).SetVal("OK")
+func TestLeakyBucket_WithNamespace(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	billing := NewLeakyBucket(1, 1, time.Hour, WithStorage(store), WithNamespace("billing"))
+	search := NewLeakyBucket(1, 1, time.Hour, WithStorage(store), WithNamespace("search"))
 
-	allowed, remaining, err := lb.Allow(ctx, key)
+	assert.Equal(t, "billing:bucket:{1.2.3.4}", billing.bucketKey("1.2.3.4"))
+
+	// Key client yang sama di dua service tidak saling memengaruhi
+	result, err := billing.Allow(ctx, "1.2.3.4")
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	result, err = search.Allow(ctx, "1.2.3.4")
 	assert.NoError(t, err)
-	assert.True(t, allowed)
-	assert.Equal(t, 4.0, remaining)
+	assert.True(t, result.Allowed)
 
-	assert.NoError(t, mock.ExpectationsWereMet())
+	keys, err := store.Keys(ctx, "*")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"billing:bucket:{1.2.3.4}", "search:bucket:{1.2.3.4}"}, keys)
 }
 
-func TestLeakyBucket_Allow_ExceedCapacity(t *testing.T) {
-	mock := setupMockRedis()
-	lb := NewLeakyBucket(5, 1, time.Hour)
+func TestLeakyBucket_WithStorage(t *testing.T) {
+	// Dua limiter di dua database Redis berbeda, tanpa menyentuh storage.RedisClient global
+	dbA, mockA := redismock.NewClientMock()
+	dbB, mockB := redismock.NewClientMock()
+	lbA := NewLeakyBucket(5, 1, time.Hour, WithStorage(storage.NewRedisStorage(dbA)))
+	lbB := NewLeakyBucket(5, 1, time.Hour, WithStorage(storage.NewRedisStorage(dbB)))
 
-	key := "test_key"
-	waterKey := fmt.Sprintf("bucket:%s:water", key)
-	timeKey := fmt.Sprintf("bucket:%s:time", key)
-	now := fmt.Sprintf("%d", time.Now().Unix())
+	key := "storage_test"
 
-	// Bucket sudah penuh (water level = 5)
-	mock.ExpectGet(waterKey).SetVal("5")
-	mock.ExpectGet(timeKey).SetVal(now)
+	expectScript(mockA, lbA, key, 1).SetVal([]interface{}{int64(1), "4", "0", "1000"})
+	expectScript(mockB, lbB, key, 1).SetVal([]interface{}{int64(0), "0", "1000", "5000"})
 
-	allowed, remaining, err := lb.Allow(ctx, key)
+	resultA, err := lbA.Allow(ctx, key)
 	assert.NoError(t, err)
-	assert.False(t, allowed) // Should be denied
-	assert.Equal(t, 0.0, remaining)
+	assert.True(t, resultA.Allowed)
 
-	assert.NoError(t, mock.ExpectationsWereMet())
+	resultB, err := lbB.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.False(t, resultB.Allowed)
+
+	assert.NoError(t, mockA.ExpectationsWereMet())
+	assert.NoError(t, mockB.ExpectationsWereMet())
 }
 
-func TestLeakyBucket_Allow_LeakOverTime(t *testing.T) {
-	mock := setupMockRedis()
-	lb := NewLeakyBucket(5, 1, time.Hour)
+func TestLeakyBucket_MemoryStorage(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	lb := NewLeakyBucket(3, 2, time.Hour, WithClock(clk), WithStorage(store))
+
+	key := "memory_test"
+
+	for i := 0; i < 3; i++ {
+		result, err := lb.Allow(ctx, key)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+	}
+
+	// Bucket penuh - 1 unit bocor setelah 500ms
+	result, err := lb.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+
+	clk.Advance(500 * time.Millisecond)
+
+	result, err = lb.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	status, err := lb.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 3.0, status.Current)
+
+	assert.NoError(t, lb.Reset(ctx, key))
+	status, err = lb.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, status.Current)
+}
+
+func TestLeakyBucket_Allow_FirstRequest(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	lb := NewLeakyBucket(5, 1, time.Hour, WithClock(NewManualClock(testEpoch)), WithStorage(store))
+
+	// First request - 1 water masuk ke bucket kosong
+	result, err := lb.Allow(ctx, "test_key")
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 4.0, result.Remaining)
+}
+
+func TestLeakyBucket_Allow_ExceedCapacity(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	lb := NewLeakyBucket(5, 1, time.Hour, WithClock(NewManualClock(testEpoch)), WithStorage(store))
 
 	key := "test_key"
-	waterKey := fmt.Sprintf("bucket:%s:water", key)
-	timeKey := fmt.Sprintf("bucket:%s:time", key)
 
-	// Bucket was full (5) but 3 seconds have passed, so leaked 3
-	// Effective water level = 5 - 3 = 2
-	pastTime := fmt.Sprintf("%d", time.Now().Unix()-3)
+	_, err := lb.AllowN(ctx, key, 5)
+	assert.NoError(t, err)
+
+	// Bucket sudah penuh, request ditolak
+	result, err := lb.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed) // Should be denied
+	assert.Equal(t, 0.0, result.Remaining)
+	assert.Equal(t, lb.Capacity, result.Limit)
+	assert.Equal(t, time.Second, result.RetryAfter) // 1 unit bocor per detik
+	assert.Equal(t, testEpoch.Add(5*time.Second), result.ResetAt)
+	assert.Equal(t, AlgorithmLeakyBucket, result.Algorithm)
+}
+
+func TestLeakyBucket_AllowN_Batch(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	lb := NewLeakyBucket(10, 1, time.Hour, WithClock(NewManualClock(testEpoch)), WithStorage(store))
 
-	mock.ExpectGet(waterKey).SetVal("5")
-	mock.ExpectGet(timeKey).SetVal(pastTime)
-	mock.ExpectSet(waterKey, "3", time.Hour).SetVal("OK") // 2 + 1 new request = 3
-	mock.Regexp().ExpectSet(timeKey, `\d+`, time.Hour).SetVal("OK")
+	key := "test_batch"
 
-	allowed, remaining, err := lb.Allow(ctx, key)
+	_, err := lb.AllowN(ctx, key, 3)
 	assert.NoError(t, err)
-	assert.True(t, allowed)
-	assert.Equal(t, 2.0, remaining) // 5 - 3 = 2
 
-	assert.NoError(t, mock.ExpectationsWereMet())
+	// Batch 4 di bucket yang berisi 3 - water jadi 7, sisa 3
+	result, err := lb.AllowN(ctx, key, 4)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 3.0, result.Remaining)
+}
+
+func TestLeakyBucket_AllowN_DoesNotFit(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	lb := NewLeakyBucket(10, 1, time.Hour, WithClock(NewManualClock(testEpoch)), WithStorage(store))
+
+	key := "test_batch_full"
+
+	_, err := lb.AllowN(ctx, key, 7)
+	assert.NoError(t, err)
+
+	// Sisa 3 tapi batch 5 - ditolak seluruhnya, water tidak berubah
+	result, err := lb.AllowN(ctx, key, 5)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 3.0, result.Remaining)
+
+	status, err := lb.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 7.0, status.Current)
 }
 
-func TestLeakyBucket_Allow_MultipleRequests(t *testing.T) {
+func TestLeakyBucket_AllowN_CostExceedsLimit(t *testing.T) {
 	mock := setupMockRedis()
-	lb := NewLeakyBucket(3, 0, time.Hour)
 
-	key := "multi_test"
-	waterKey := fmt.Sprintf("bucket:%s:water", key)
-	timeKey := fmt.Sprintf("bucket:%s:time", key)
-	now := fmt.Sprintf("%d", time.Now().Unix())
+	// Batch lebih besar dari kapasitas tidak akan pernah muat - error tanpa menyentuh Redis
+	lb := NewLeakyBucket(10, 1, time.Hour)
+	result, err := lb.AllowN(ctx, "test_batch_too_big", 11)
+	assert.ErrorIs(t, err, ErrCostExceedsLimit)
+	assert.Nil(t, result)
 
-	// Request 1 - empty bucket
-	mock.ExpectGet(waterKey).RedisNil()
-	mock.ExpectGet(timeKey).RedisNil()
-	mock.ExpectSet(waterKey, "1", time.Hour).SetVal("OK")
-	mock.Regexp().ExpectSet(timeKey, `\d+`, time.Hour).SetVal("OK")
+	// Di shaping mode antrian MaxDelay ikut dihitung: 10 + 3s * 2/s = 16
+	shaping := NewShapingLeakyBucket(10, 2, 3*time.Second, time.Hour)
+	_, err = shaping.AllowN(ctx, "test_batch_too_big", 17)
+	assert.ErrorIs(t, err, ErrCostExceedsLimit)
 
-	allowed, remaining, err := lb.Allow(ctx, key)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Request harus muat seluruhnya: sisa kapasitas pecahan tidak cukup untuk request cost 1
+// (sebelum AllowN request diterima selama water < capacity, sehingga bucket bisa terisi sampai 10.5)
+func TestLeakyBucket_Allow_PartialRoomIsNotEnough(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	lb := NewLeakyBucket(10, 2, time.Hour, WithClock(clk), WithStorage(store))
+	key := "partial_room_test"
+
+	result, err := lb.AllowN(ctx, key, 10)
 	assert.NoError(t, err)
-	assert.True(t, allowed)
-	assert.Equal(t, 2.0, remaining)
+	assert.True(t, result.Allowed)
 
-	// Request 2
-	mock.ExpectGet(waterKey).SetVal("1")
-	mock.ExpectGet(timeKey).SetVal(now)
-	mock.ExpectSet(waterKey, "2", time.Hour).SetVal("OK")
-	mock.Regexp().ExpectSet(timeKey, `\d+`, time.Hour).SetVal("OK")
+	// 250ms kemudian baru bocor 0.5 - water 9.5
+	clk.Advance(250 * time.Millisecond)
+	result, err = lb.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0.5, result.Remaining)
+	assert.Equal(t, 250*time.Millisecond, result.RetryAfter)
 
-	allowed, remaining, err = lb.Allow(ctx, key)
+	status, err := lb.GetStatus(ctx, key)
 	assert.NoError(t, err)
-	assert.True(t, allowed)
-	assert.Equal(t, 1.0, remaining)
+	assert.True(t, status.IsLimited)
 
-	// Request 3
-	mock.ExpectGet(waterKey).SetVal("2")
-	mock.ExpectGet(timeKey).SetVal(now)
-	mock.ExpectSet(waterKey, "3", time.Hour).SetVal("OK")
-	mock.Regexp().ExpectSet(timeKey, `\d+`, time.Hour).SetVal("OK")
+	clk.Advance(250 * time.Millisecond)
+	result, err = lb.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0.0, result.Remaining)
+}
 
-	allowed, remaining, err = lb.Allow(ctx, key)
+func TestLeakyBucket_Allow_FractionalRemaining(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	lb := NewLeakyBucket(5, 0.5, time.Hour, WithClock(clk), WithStorage(store))
+
+	key := "fraction_test"
+
+	_, err := lb.AllowN(ctx, key, 2)
 	assert.NoError(t, err)
-	assert.True(t, allowed)
-	assert.Equal(t, 0.0, remaining)
 
-	// Request 4 - should be denied (bucket full)
-	mock.ExpectGet(waterKey).SetVal("3")
-	mock.ExpectGet(timeKey).SetVal(now)
+	// 1 detik kemudian baru bocor 0.5 - water 1.5 + 1 = 2.5
+	clk.Advance(time.Second)
+	result, err := lb.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 2.5, result.Remaining)
+}
 
-	allowed, remaining, err = lb.Allow(ctx, key)
+func TestLeakyBucket_Allow_NoScriptFallback(t *testing.T) {
+	mock := setupMockRedis()
+	lb := NewLeakyBucket(5, 1, time.Hour)
+
+	key := "noscript_test"
+	keys := []string{fmt.Sprintf("bucket:{%s}", key)}
+
+	// Script belum di-load di Redis (misalnya setelah restart), fallback ke EVAL
+	expectScript(mock, lb, key, 1).SetErr(redisError("NOSCRIPT No matching script"))
+	mock.Regexp().ExpectEval(`(?s).*`, keys,
+		lb.Capacity, lb.LeakRate, `^\d{13}$`, lb.TTL.Milliseconds(), int64(1), int64(0), int64(0)).
+		SetVal([]interface{}{int64(1), "4", "0", "0"})
+
+	result, err := lb.Allow(ctx, key)
 	assert.NoError(t, err)
-	assert.False(t, allowed)
-	assert.Equal(t, 0.0, remaining)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 4.0, result.Remaining)
 
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -158,15 +298,13 @@ func TestLeakyBucket_Allow_RedisError(t *testing.T) {
 	lb := NewLeakyBucket(5, 1, time.Hour)
 
 	key := "error_test"
-	waterKey := fmt.Sprintf("bucket:%s:water", key)
 
 	// Simulate Redis error
-	mock.ExpectGet(waterKey).SetErr(fmt.Errorf("connection refused"))
+	expectScript(mock, lb, key, 1).SetErr(fmt.Errorf("connection refused"))
 
-	allowed, remaining, err := lb.Allow(ctx, key)
+	result, err := lb.Allow(ctx, key)
 	assert.Error(t, err)
-	assert.False(t, allowed)
-	assert.Equal(t, 0.0, remaining)
+	assert.Nil(t, result)
 
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -176,11 +314,9 @@ func TestLeakyBucket_Reset(t *testing.T) {
 	lb := NewLeakyBucket(5, 1, time.Hour)
 
 	key := "reset_test"
-	waterKey := fmt.Sprintf("bucket:%s:water", key)
-	timeKey := fmt.Sprintf("bucket:%s:time", key)
+	bucketKey := fmt.Sprintf("bucket:{%s}", key)
 
-	mock.ExpectDel(waterKey).SetVal(1)
-	mock.ExpectDel(timeKey).SetVal(1)
+	mock.ExpectDel(bucketKey).SetVal(1)
 
 	err := lb.Reset(ctx, key)
 	assert.NoError(t, err)
@@ -190,15 +326,14 @@ func TestLeakyBucket_Reset(t *testing.T) {
 
 func TestLeakyBucket_GetStatus(t *testing.T) {
 	mock := setupMockRedis()
-	lb := NewLeakyBucket(10, 2, time.Hour)
+	clk := NewManualClock(testEpoch)
+	lb := NewLeakyBucket(10, 2, time.Hour, WithClock(clk))
 
 	key := "status_test"
-	waterKey := fmt.Sprintf("bucket:%s:water", key)
-	timeKey := fmt.Sprintf("bucket:%s:time", key)
-	now := fmt.Sprintf("%d", time.Now().Unix())
+	bucketKey := fmt.Sprintf("bucket:{%s}", key)
+	now := fmt.Sprintf("%d", clk.Now().UnixMilli())
 
-	mock.ExpectGet(waterKey).SetVal("3")
-	mock.ExpectGet(timeKey).SetVal(now)
+	mock.ExpectHGetAll(bucketKey).SetVal(map[string]string{"water": "3", "time": now})
 
 	status, err := lb.GetStatus(ctx, key)
 	assert.NoError(t, err)
@@ -214,15 +349,14 @@ func TestLeakyBucket_GetStatus(t *testing.T) {
 
 func TestLeakyBucket_GetStatus_Limited(t *testing.T) {
 	mock := setupMockRedis()
-	lb := NewLeakyBucket(5, 1, time.Hour)
+	clk := NewManualClock(testEpoch)
+	lb := NewLeakyBucket(5, 1, time.Hour, WithClock(clk))
 
 	key := "limited_test"
-	waterKey := fmt.Sprintf("bucket:%s:water", key)
-	timeKey := fmt.Sprintf("bucket:%s:time", key)
-	now := fmt.Sprintf("%d", time.Now().Unix())
+	bucketKey := fmt.Sprintf("bucket:{%s}", key)
+	now := fmt.Sprintf("%d", clk.Now().UnixMilli())
 
-	mock.ExpectGet(waterKey).SetVal("5")
-	mock.ExpectGet(timeKey).SetVal(now)
+	mock.ExpectHGetAll(bucketKey).SetVal(map[string]string{"water": "5", "time": now})
 
 	status, err := lb.GetStatus(ctx, key)
 	assert.NoError(t, err)
@@ -238,11 +372,9 @@ func TestLeakyBucket_GetStatus_Empty(t *testing.T) {
 	lb := NewLeakyBucket(10, 1, time.Hour)
 
 	key := "empty_test"
-	waterKey := fmt.Sprintf("bucket:%s:water", key)
-	timeKey := fmt.Sprintf("bucket:%s:time", key)
+	bucketKey := fmt.Sprintf("bucket:{%s}", key)
 
-	mock.ExpectGet(waterKey).RedisNil()
-	mock.ExpectGet(timeKey).RedisNil()
+	mock.ExpectHGetAll(bucketKey).SetVal(map[string]string{})
 
 	status, err := lb.GetStatus(ctx, key)
 	assert.NoError(t, err)
@@ -253,27 +385,263 @@ func TestLeakyBucket_GetStatus_Empty(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestLeakyBucket_Allow_AfterLeak(t *testing.T) {
+func TestLeakyBucket_GetStatus_LeakOverTime(t *testing.T) {
 	mock := setupMockRedis()
-	lb := &LeakyBucket{Capacity: 5, LeakRate: 1} // Leak 1 per second
+	clk := NewManualClock(testEpoch)
+	lb := NewLeakyBucket(5, 1, time.Hour, WithClock(clk))
 
 	key := "leak_test"
-	waterKey := fmt.Sprintf("bucket:%s:water", key)
-	timeKey := fmt.Sprintf("bucket:%s:time", key)
+	bucketKey := fmt.Sprintf("bucket:{%s}", key)
+
+	// Bucket was full (5) but 3 seconds have passed, so leaked 3
+	// Effective water level = 5 - 3 = 2
+	pastTime := fmt.Sprintf("%d", clk.Now().UnixMilli()-3000)
+
+	mock.ExpectHGetAll(bucketKey).SetVal(map[string]string{"water": "5", "time": pastTime})
+
+	status, err := lb.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, status.Current)
+	assert.Equal(t, 3.0, status.Remaining) // 5 - 2 = 3
+	assert.False(t, status.IsLimited)
+
+	// GetStatus tidak boleh menulis ulang state
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLeakyBucket_GetStatus_SubSecondLeak(t *testing.T) {
+	mock := setupMockRedis()
+	clk := NewManualClock(testEpoch)
+	lb := NewLeakyBucket(10, 2, time.Hour, WithClock(clk))
+
+	key := "subsecond_test"
+	bucketKey := fmt.Sprintf("bucket:{%s}", key)
+
+	// Baru 250ms sejak update terakhir - dengan LeakRate 2 sudah bocor 0.5
+	// (dengan timestamp detik, burst di dalam satu detik tidak bocor sama sekali)
+	pastTime := fmt.Sprintf("%d", clk.Now().UnixMilli()-250)
+
+	mock.ExpectHGetAll(bucketKey).SetVal(map[string]string{"water": "10", "time": pastTime})
+
+	status, err := lb.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 9.5, status.Current)
+	assert.Equal(t, 0.5, status.Remaining)
+	assert.True(t, status.IsLimited) // Sisa 0.5 tidak cukup untuk satu request utuh
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLeakyBucket_GetStatus_LegacySecondsTimestamp(t *testing.T) {
+	mock := setupMockRedis()
+	clk := NewManualClock(testEpoch)
+	lb := NewLeakyBucket(5, 1, time.Hour, WithClock(clk))
+
+	key := "legacy_time_test"
+	bucketKey := fmt.Sprintf("bucket:{%s}", key)
+
+	// Key dari versi lama masih menyimpan Unix detik - harus dibaca sebagai 2 detik yang lalu,
+	// bukan sebagai milidetik di tahun 1970 (yang akan mengosongkan bucket)
+	legacyTime := fmt.Sprintf("%d", clk.Now().Unix()-2)
+
+	mock.ExpectHGetAll(bucketKey).SetVal(map[string]string{"water": "5", "time": legacyTime})
+
+	status, err := lb.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 3.0, status.Current) // 5 - 2 detik * 1
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLeakyBucket_GetStatus_AfterLeak(t *testing.T) {
+	mock := setupMockRedis()
+	clk := NewManualClock(testEpoch)
+	lb := &LeakyBucket{Capacity: 5, LeakRate: 1, Clock: clk} // Leak 1 per second
+
+	key := "leak_test"
+	bucketKey := fmt.Sprintf("bucket:{%s}", key)
 
 	// Bucket was full (5) but 6 seconds have passed, so leaked 6
-	// Effective water level = 5 - 6 = 0
-	pastTime := fmt.Sprintf("%d", time.Now().Unix()-6)
+	// Effective water level = max(5 - 6, 0) = 0
+	pastTime := fmt.Sprintf("%d", clk.Now().UnixMilli()-6000)
+
+	mock.ExpectHGetAll(bucketKey).SetVal(map[string]string{"water": "5", "time": pastTime})
+
+	status, err := lb.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, status.Current)
+	assert.Equal(t, 5.0, status.Remaining)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLeakyBucket_Reserve_Full(t *testing.T) {
+	mock := setupMockRedis()
+	clk := NewManualClock(testEpoch)
+	lb := NewLeakyBucket(10, 2, time.Hour, WithClock(clk))
+
+	key := "reserve_full_test"
+	now := fmt.Sprintf("%d", clk.Now().UnixMilli())
+
+	// Bucket penuh - perlu bocor 1 unit, 2/detik = 500ms
+	mock.ExpectHGetAll(fmt.Sprintf("bucket:{%s}", key)).SetVal(map[string]string{"water": "10", "time": now})
+
+	wait, err := lb.Reserve(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLeakyBucket_Reserve_HasRoom(t *testing.T) {
+	mock := setupMockRedis()
+	lb := NewLeakyBucket(10, 2, time.Hour)
+
+	key := "reserve_room_test"
+
+	mock.ExpectHGetAll(fmt.Sprintf("bucket:{%s}", key)).SetVal(map[string]string{})
+
+	wait, err := lb.Reserve(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), wait) // Bisa langsung
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLeakyBucket_Reserve_ShapingQueue(t *testing.T) {
+	mock := setupMockRedis()
+	clk := NewManualClock(testEpoch)
+	lb := NewShapingLeakyBucket(5, 2, 3*time.Second, time.Hour, WithClock(clk))
+
+	key := "reserve_shaping_test"
+	now := fmt.Sprintf("%d", clk.Now().UnixMilli())
+
+	// Bucket penuh tapi antrian 3 detik masih muat - Allow menerima dengan delay, jadi tidak perlu menunggu
+	mock.ExpectHGetAll(fmt.Sprintf("bucket:{%s}", key)).SetVal(map[string]string{"water": "8", "time": now})
+	wait, err := lb.Reserve(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), wait)
+
+	// Antrian penuh (5 + 3s * 2/detik = 11) - perlu bocor 1 unit, 2/detik = 500ms
+	mock.ExpectHGetAll(fmt.Sprintf("bucket:{%s}", key)).SetVal(map[string]string{"water": "11", "time": now})
+	wait, err = lb.Reserve(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLeakyBucket_Wait_RetriesUntilAllowed(t *testing.T) {
+	mock := setupMockRedis()
+	lb := NewLeakyBucket(5, 1, time.Hour)
+
+	key := "wait_test"
+
+	// Pertama ditolak dengan retry 20ms, lalu diizinkan
+	expectScript(mock, lb, key, 1).SetVal([]interface{}{int64(0), "0", "20", "5000"})
+	expectScript(mock, lb, key, 1).SetVal([]interface{}{int64(1), "0", "0", "5000"})
+
+	start := time.Now()
+	err := lb.Wait(ctx, key)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLeakyBucket_Wait_ExceedsDeadline(t *testing.T) {
+	mock := setupMockRedis()
+	lb := NewLeakyBucket(5, 1, time.Hour)
+
+	key := "wait_deadline_test"
+
+	// Slot baru tersedia dalam 5 detik, deadline hanya 50ms - langsung gagal tanpa tidur
+	expectScript(mock, lb, key, 1).SetVal([]interface{}{int64(0), "0", "5000", "5000"})
+
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	err := lb.Wait(waitCtx, key)
+	assert.ErrorIs(t, err, ErrWaitExceedsDeadline)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLeakyBucket_Wait_ContextCanceled(t *testing.T) {
+	mock := setupMockRedis()
+	lb := NewLeakyBucket(5, 1, time.Hour)
+
+	key := "wait_cancel_test"
+
+	expectScript(mock, lb, key, 1).SetVal([]interface{}{int64(0), "0", "5000", "5000"})
+
+	// Tanpa deadline, tapi dibatalkan saat sedang tidur
+	waitCtx, cancel := context.WithCancel(ctx)
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	err := lb.Wait(waitCtx, key)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNewShapingLeakyBucket(t *testing.T) {
+	lb := NewShapingLeakyBucket(10, 2, 3*time.Second, time.Hour)
+
+	assert.Equal(t, 10.0, lb.Capacity)
+	assert.Equal(t, 2.0, lb.LeakRate)
+	assert.Equal(t, 3*time.Second, lb.MaxDelay)
+	assert.Equal(t, time.Hour, lb.TTL)
+}
+
+func TestLeakyBucket_Allow_ShapingDelay(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	lb := NewShapingLeakyBucket(5, 2, 3*time.Second, time.Hour, WithClock(NewManualClock(testEpoch)), WithStorage(store))
+
+	key := "shaping_test"
+
+	_, err := lb.AllowN(ctx, key, 5)
+	assert.NoError(t, err)
+
+	// Bucket overflow 1 unit - diterima tapi ditahan 500ms
+	result, err := lb.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.Delay)
+}
+
+func TestLeakyBucket_Allow_ShapingQueueFull(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	lb := NewShapingLeakyBucket(5, 2, 3*time.Second, time.Hour, WithClock(NewManualClock(testEpoch)), WithStorage(store))
+
+	key := "shaping_full_test"
+
+	// Antrian penuh: 5 + 3s * 2/detik = 11
+	_, err := lb.AllowN(ctx, key, 11)
+	assert.NoError(t, err)
+
+	// Delay antrian akan 3.5s > MaxDelay 3s - ditolak, retry setelah 500ms
+	result, err := lb.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Duration(0), result.Delay)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+}
+
+func TestLeakyBucket_Wait_ShapingSleepsDelay(t *testing.T) {
+	mock := setupMockRedis()
+	lb := NewShapingLeakyBucket(5, 2, 3*time.Second, time.Hour)
+
+	key := "shaping_wait_test"
 
-	mock.ExpectGet(waterKey).SetVal("5")
-	mock.ExpectGet(timeKey).SetVal(pastTime)
-	mock.ExpectSet(waterKey, "1", 0).SetVal("OK") // 0 + 1 new request = 1
-	mock.Regexp().ExpectSet(timeKey, `\d+`, 0).SetVal("OK")
+	expectScript(mock, lb, key, 1).SetVal([]interface{}{int64(1), "0", "0", "3000", "30"})
 
-	allowed, remaining, err := lb.Allow(ctx, key)
+	start := time.Now()
+	err := lb.Wait(ctx, key)
 	assert.NoError(t, err)
-	assert.True(t, allowed)
-	assert.Equal(t, 4.0, remaining) // 5 - 1 = 4
+	assert.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond) // Menunggu giliran di antrian
 
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
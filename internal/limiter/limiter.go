@@ -1,11 +1,29 @@
 package limiter
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCost dikembalikan oleh AllowN jika n kurang dari 1
+var ErrInvalidCost = errors.New("limiter: cost must be at least 1")
+
+// ErrCostExceedsLimit dikembalikan oleh AllowN jika n lebih besar dari limit/kapasitas,
+// sehingga request tidak akan pernah bisa diizinkan (tidak ada gunanya retry).
+// Membungkus ErrInvalidCost: middleware menjawab 400 dan circuit breaker tidak menghitungnya.
+var ErrCostExceedsLimit = fmt.Errorf("%w: cost exceeds the limit", ErrInvalidCost)
 
 // RateLimiter adalah interface untuk semua algoritma rate limiting
 type RateLimiter interface {
 	// Allow mengecek apakah request diizinkan
-	Allow(ctx context.Context, key string) (bool, float64, error)
+	Allow(ctx context.Context, key string) (*Result, error)
+
+	// AllowN mengecek apakah request dengan cost n diizinkan (semua atau tidak sama sekali)
+	AllowN(ctx context.Context, key string, n int64) (*Result, error)
 
 	// Reset menghapus semua state untuk key tertentu
 	Reset(ctx context.Context, key string) error
@@ -14,6 +32,26 @@ type RateLimiter interface {
 	GetStatus(ctx context.Context, key string) (*Status, error)
 }
 
+// KeyLister diimplementasikan oleh limiter yang key per client-nya bisa di-list (dipakai dashboard)
+type KeyLister interface {
+	// KeyPattern mengembalikan glob yang cocok dengan satu storage key per client,
+	// dan fungsi untuk mengambil key client dari storage key tersebut ("" = bukan key client)
+	KeyPattern() (pattern string, extract func(storageKey string) string)
+}
+
+// Result menyimpan hasil keputusan rate limiter untuk satu request
+type Result struct {
+	Allowed    bool          `json:"allowed"`
+	Limit      float64       `json:"limit"`       // Kapasitas / limit algoritma
+	Remaining  float64       `json:"remaining"`   // Sisa setelah keputusan ini
+	RetryAfter time.Duration `json:"retry_after"` // Waktu tunggu sampai request yang sama diizinkan (0 jika allowed)
+	ResetAt    time.Time     `json:"reset_at"`    // Waktu state kembali penuh (semua limit tersedia lagi)
+	ResetAfter time.Duration `json:"reset_after"` // Sama dengan ResetAt, relatif terhadap Clock limiter (tidak terpengaruh selisih jam lokal)
+	Window     time.Duration `json:"window"`      // Periode kebijakan: panjang window, atau waktu isi ulang penuh untuk bucket
+	Delay      time.Duration `json:"delay"`       // Waktu request harus ditahan sebelum diteruskan (shaping mode)
+	Algorithm  string        `json:"algorithm"`
+}
+
 // Status menyimpan informasi status rate limiter
 type Status struct {
 	Key       string  `json:"key"`
@@ -24,3 +62,131 @@ type Status struct {
 	IsLimited bool    `json:"is_limited"` 
 	Algorithm string  `json:"algorithm"`  
 }
+
+// parseScriptResult mengubah reply Lua script menjadi Result
+// Format reply: {allowed (0/1), remaining, retry after (ms), reset after (ms)[, delay (ms)]}
+// Limit dan Algorithm diisi oleh pemanggil karena tidak dikirim oleh script.
+func parseScriptResult(res []interface{}, now time.Time) (*Result, error) {
+	if len(res) != 4 && len(res) != 5 {
+		return nil, fmt.Errorf("unexpected script reply: %v", res)
+	}
+
+	allowed, ok := res[0].(int64)
+	if !ok {
+		return nil, fmt.Errorf("unexpected script reply: %v", res)
+	}
+
+	// Sisa nilai dikirim sebagai string karena Lua number -> Redis integer memotong pecahan
+	values := make([]float64, 4)
+	for i, raw := range res[1:] {
+		str, ok := raw.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected script reply: %v", res)
+		}
+		v, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+
+	return &Result{
+		Allowed:    allowed == 1,
+		Remaining:  values[0],
+		RetryAfter: msToDuration(values[1]),
+		ResetAt:    now.Add(msToDuration(values[2])),
+		ResetAfter: msToDuration(values[2]),
+		Delay:      msToDuration(values[3]),
+	}, nil
+}
+
+// legacyTimestampLimit memisahkan timestamp bucket lama (Unix detik) dari timestamp baru (Unix milidetik).
+// 1e11 detik baru tercapai di tahun 5138, sedangkan 1e11 milidetik sudah lewat sejak 1973.
+const legacyTimestampLimit = 1e11
+
+// parseTimestampMs membaca timestamp bucket dari Redis sebagai Unix milidetik.
+// Key yang ditulis sebelum upgrade masih berisi Unix detik dan dikonversi otomatis.
+func parseTimestampMs(val string) (float64, error) {
+	ts, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return 0, err
+	}
+	if ts < legacyTimestampLimit {
+		ts *= 1000
+	}
+	return ts, nil
+}
+
+// hashTag membungkus key client dengan {} (Redis Cluster hash tag).
+// Hanya bagian di dalam {} yang di-hash, sehingga semua key milik satu client
+// (misalnya bucket:{k} dan window:{k}:<start>) berada di slot yang sama dan bisa dipakai bersama dalam satu Lua script.
+func hashTag(key string) string {
+	return "{" + key + "}"
+}
+
+// namespacedKey menambahkan prefix "<namespace>:" ke Redis key (key tidak diubah jika namespace kosong)
+func namespacedKey(namespace, key string) string {
+	if namespace == "" {
+		return key
+	}
+	return namespace + ":" + key
+}
+
+// clientKeyBetween membuat extractor untuk storage key berbentuk "<prefix><key client><suffix>"
+func clientKeyBetween(prefix, suffix string) func(string) string {
+	return func(storageKey string) string {
+		if len(storageKey) < len(prefix)+len(suffix) || !strings.HasPrefix(storageKey, prefix) || !strings.HasSuffix(storageKey, suffix) {
+			return ""
+		}
+		return storageKey[len(prefix) : len(storageKey)-len(suffix)]
+	}
+}
+
+// rateWindow menghitung periode kebijakan bucket: waktu untuk mengisi (atau mengosongkan) kapasitas penuh
+func rateWindow(capacity, rate float64) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	return time.Duration(capacity / rate * float64(time.Second))
+}
+
+// msToDuration mengubah milidetik (float) menjadi time.Duration, nilai negatif dianggap 0
+func msToDuration(ms float64) time.Duration {
+	if ms <= 0 {
+		return 0
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// argFloat mengubah argumen script (seperti yang dikirim ke Eval) menjadi float64 untuk implementasi Go
+func argFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case int64:
+		return float64(n)
+	case int:
+		return float64(n)
+	case string:
+		f, _ := strconv.ParseFloat(n, 64)
+		return f
+	}
+	return 0
+}
+
+// scriptReply membangun reply dengan format yang sama seperti Lua script (lihat parseScriptResult)
+func scriptReply(allowed bool, remaining, retryAfterMs, resetAfterMs float64, delayMs ...float64) []interface{} {
+	reply := []interface{}{int64(0), formatNumber(remaining), formatNumber(retryAfterMs), formatNumber(resetAfterMs)}
+	if allowed {
+		reply[0] = int64(1)
+	}
+	for _, d := range delayMs {
+		reply = append(reply, formatNumber(d))
+	}
+	return reply
+}
+
+// formatNumber memformat angka seperti tostring() di Lua agar bisa dibaca ulang dengan ParseFloat
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
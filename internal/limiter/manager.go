@@ -2,26 +2,134 @@ package limiter
 
 import (
 	"context"
+	"fmt"
 	"sync"
 )
 
+// Nama algoritma yang didukung oleh LimiterManager
+const (
+	AlgorithmLeakyBucket          = "leaky_bucket"
+	AlgorithmTokenBucket          = "token_bucket"
+	AlgorithmFixedWindow          = "fixed_window"
+	AlgorithmSlidingWindowLog     = "sliding_window_log"
+	AlgorithmSlidingWindowCounter = "sliding_window_counter"
+	AlgorithmGCRA                 = "gcra"
+)
+
+// Algorithm is a named RateLimiter that can be registered in LimiterManager.
+type Algorithm struct {
+	Name        string                        // Name used by SetAlgorithm (e.g. "leaky_bucket")
+	Limiter     RateLimiter                   // Implementation; implement KeyLister to show up in the dashboard key list
+	Description string                        // One-line explanation returned by GetAlgorithmInfo
+	Params      func() map[string]interface{} // Current parameters merged into GetAlgorithmInfo (nil = none)
+}
+
 // LimiterManager manages multiple rate limiting algorithms and allows switching between them.
-// It provides a thread-safe way to change the active algorithm at runtime.
+// Algorithms are kept in a registry keyed by name; it provides a thread-safe way
+// to change the active algorithm at runtime.
 type LimiterManager struct {
-	leakyBucket *LeakyBucket // Leaky Bucket algorithm instance
-	tokenBucket *TokenBucket // Token Bucket algorithm instance
-	current     string       // Current active algorithm: "leaky_bucket" or "token_bucket"
-	mu          sync.RWMutex // Mutex for thread-safe access
+	algorithms map[string]Algorithm // Registered algorithms by name
+	names      []string             // Algorithm names in registration order
+	current    string               // Current active algorithm name
+	clock      Clock                // Default time source for built-in algorithms without one (nil = system time)
+	namespace  string               // Default key prefix for built-in algorithms without one ("" = none)
+	listeners  []func()             // Called after the active algorithm or its parameters changed
+	mu         sync.RWMutex         // Mutex for thread-safe access
+	changeMu   sync.Mutex           // Serializes changes, so carry-over can run without holding mu
+}
+
+// NewLimiterManager creates a new LimiterManager with Leaky Bucket and Token Bucket registered.
+// defaultAlgorithm: "leaky_bucket" or "token_bucket" (anything else falls back to "leaky_bucket")
+// WithClock and WithNamespace are defaults for every built-in algorithm (including ones
+// registered later); a limiter created with its own clock or namespace keeps it.
+func NewLimiterManager(leaky *LeakyBucket, token *TokenBucket, defaultAlgorithm string, opts ...Option) *LimiterManager {
+	o := applyOptions(opts)
+	m := &LimiterManager{
+		algorithms: make(map[string]Algorithm),
+		clock:      o.clock,
+		namespace:  o.namespace,
+	}
+	m.Register(LeakyBucketAlgorithm(leaky))
+	m.Register(TokenBucketAlgorithm(token))
+
+	m.current = AlgorithmLeakyBucket
+	if _, ok := m.algorithms[defaultAlgorithm]; ok {
+		m.current = defaultAlgorithm
+	}
+	return m
 }
 
-// NewLimiterManager creates a new LimiterManager with both algorithms initialized.
-// defaultAlgorithm: "leaky_bucket" or "token_bucket"
-func NewLimiterManager(leaky *LeakyBucket, token *TokenBucket, defaultAlgorithm string) *LimiterManager {
-	return &LimiterManager{
-		leakyBucket: leaky,
-		tokenBucket: token,
-		current:     defaultAlgorithm,
+// Register adds an algorithm to the registry, replacing any algorithm with the same name.
+// Built-in limiters without a clock or namespace get the manager's. Panics if Name or Limiter is empty.
+func (m *LimiterManager) Register(alg Algorithm) {
+	if alg.Name == "" || alg.Limiter == nil {
+		panic("Algorithm name and RateLimiter are required")
 	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.share(alg.Limiter)
+	if _, exists := m.algorithms[alg.Name]; !exists {
+		m.names = append(m.names, alg.Name)
+	}
+	m.algorithms[alg.Name] = alg
+}
+
+// share fills in the manager's clock and namespace where a built-in limiter has none
+func (m *LimiterManager) share(rl RateLimiter) {
+	var clock *Clock
+	var namespace *string
+	switch l := rl.(type) {
+	case *LeakyBucket:
+		clock, namespace = &l.Clock, &l.Namespace
+	case *TokenBucket:
+		l.paramsMu.Lock() // The lease janitor may already be running
+		defer l.paramsMu.Unlock()
+		clock, namespace = &l.Clock, &l.Namespace
+	case *FixedWindow:
+		clock, namespace = &l.Clock, &l.Namespace
+	case *SlidingWindowLog:
+		clock, namespace = &l.Clock, &l.Namespace
+	case *SlidingWindowCounter:
+		clock, namespace = &l.Clock, &l.Namespace
+	case *GCRA:
+		clock, namespace = &l.Clock, &l.Namespace
+	default:
+		return // Custom limiters manage their own clock and keys
+	}
+	if *clock == nil {
+		*clock = m.clock
+	}
+	if *namespace == "" {
+		*namespace = m.namespace
+	}
+}
+
+// SetFixedWindow registers a FixedWindow instance so "fixed_window" can be selected.
+func (m *LimiterManager) SetFixedWindow(fw *FixedWindow) {
+	m.Register(FixedWindowAlgorithm(fw))
+}
+
+// SetSlidingWindowLog registers a SlidingWindowLog instance so "sliding_window_log" can be selected.
+func (m *LimiterManager) SetSlidingWindowLog(sl *SlidingWindowLog) {
+	m.Register(SlidingWindowLogAlgorithm(sl))
+}
+
+// SetSlidingWindowCounter registers a SlidingWindowCounter instance so "sliding_window_counter" can be selected.
+func (m *LimiterManager) SetSlidingWindowCounter(sc *SlidingWindowCounter) {
+	m.Register(SlidingWindowCounterAlgorithm(sc))
+}
+
+// SetGCRA registers a GCRA instance so "gcra" can be selected.
+func (m *LimiterManager) SetGCRA(g *GCRA) {
+	m.Register(GCRAAlgorithm(g))
+}
+
+// Algorithms returns the names of all registered algorithms in registration order.
+func (m *LimiterManager) Algorithms() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]string(nil), m.names...)
 }
 
 // GetCurrentAlgorithm returns the name of the currently active algorithm.
@@ -31,67 +139,275 @@ func (m *LimiterManager) GetCurrentAlgorithm() string {
 	return m.current
 }
 
+// OnChange registers fn to be called after every change made through the manager
+// (SetAlgorithm, SetAlgorithmWithState, UpdateConfig, and changes ClusterSync adopts from
+// other instances), e.g. to drop decisions cached under the old settings.
+// fn runs after the manager's lock is released, so it may call back into the manager.
+func (m *LimiterManager) OnChange(fn func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
+
+// mutate runs fn under the write lock, then calls the OnChange listeners if fn reports a change
+func (m *LimiterManager) mutate(fn func() (changed bool, err error)) error {
+	m.changeMu.Lock()
+	defer m.changeMu.Unlock()
+	return m.commit(fn)
+}
+
+// commit does the work of mutate; the caller holds m.changeMu
+func (m *LimiterManager) commit(fn func() (changed bool, err error)) error {
+	m.mu.Lock()
+	changed, err := fn()
+	listeners := m.listeners
+	m.mu.Unlock()
+
+	if changed {
+		for _, listener := range listeners {
+			listener()
+		}
+	}
+	return err
+}
+
 // SetAlgorithm switches to a different rate limiting algorithm.
-// algorithm: "leaky_bucket" or "token_bucket"
-// Returns true if switch was successful, false if algorithm name is invalid.
-func (m *LimiterManager) SetAlgorithm(algorithm string) bool {
-	if algorithm != "leaky_bucket" && algorithm != "token_bucket" {
-		return false // Invalid algorithm name
+// algorithm: any registered name (see Algorithms)
+// Returns ErrUnknownAlgorithm if the name is not registered (e.g. not set up for this storage backend).
+func (m *LimiterManager) SetAlgorithm(algorithm string) error {
+	return m.mutate(func() (bool, error) {
+		if _, ok := m.algorithms[algorithm]; !ok {
+			return false, fmt.Errorf("%w: %q", ErrUnknownAlgorithm, algorithm)
+		}
+		changed := algorithm != m.current
+		m.current = algorithm
+		return changed, nil
+	})
+}
+
+// SetAlgorithmWithState switches like SetAlgorithm, but first carries the usage of every active
+// key over to the new algorithm (water level <-> consumed tokens <-> GCRA backlog), scaled to its
+// capacity, so throttled clients stay throttled. Existing state of the new algorithm for those keys
+// is overwritten. Requests keep using the old algorithm while keys are copied; usage they add to a key
+// that was already copied is not carried over. Other changes wait until the switch is done.
+// Returns ErrUnknownAlgorithm or ErrStateNotConvertible without switching; on a storage error
+// the active algorithm is kept as well.
+func (m *LimiterManager) SetAlgorithmWithState(ctx context.Context, algorithm string) error {
+	m.changeMu.Lock()
+	defer m.changeMu.Unlock()
+
+	// changeMu keeps current and the limiters' parameters fixed; mu is only needed to read them
+	m.mu.RLock()
+	target, ok := m.algorithms[algorithm]
+	source := m.algorithms[m.current]
+	m.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownAlgorithm, algorithm)
+	}
+	if target.Name == source.Name {
+		return nil // Nothing to carry over
 	}
-	m.mu.Lock()         // Acquire write lock
-	defer m.mu.Unlock() // Release on function exit
-	m.current = algorithm
-	return true
+	if err := carryOver(ctx, source.Limiter, target.Limiter); err != nil {
+		return err
+	}
+
+	return m.commit(func() (bool, error) {
+		m.current = algorithm
+		return true, nil
+	})
 }
 
 // GetActiveLimiter returns the currently active RateLimiter instance.
 func (m *LimiterManager) GetActiveLimiter() RateLimiter {
 	m.mu.RLock()         // Acquire read lock
 	defer m.mu.RUnlock() // Release on function exit
-	if m.current == "token_bucket" {
-		return m.tokenBucket
-	}
-	return m.leakyBucket
+	return m.algorithms[m.current].Limiter
 }
 
 // Allow delegates to the active algorithm's Allow method.
-func (m *LimiterManager) Allow(ctx context.Context, key string) (bool, float64, error) {
-	return m.GetActiveLimiter().Allow(ctx, key)
+// The read lock is held during the call so UpdateConfig never changes parameters mid-request.
+func (m *LimiterManager) Allow(ctx context.Context, key string) (*Result, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.algorithms[m.current].Limiter.Allow(ctx, key)
+}
+
+// AllowN delegates to the active algorithm's AllowN method.
+func (m *LimiterManager) AllowN(ctx context.Context, key string, n int64) (*Result, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.algorithms[m.current].Limiter.AllowN(ctx, key, n)
 }
 
 // Reset delegates to the active algorithm's Reset method.
 func (m *LimiterManager) Reset(ctx context.Context, key string) error {
-	return m.GetActiveLimiter().Reset(ctx, key)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.algorithms[m.current].Limiter.Reset(ctx, key)
 }
 
 // GetStatus delegates to the active algorithm's GetStatus method.
 func (m *LimiterManager) GetStatus(ctx context.Context, key string) (*Status, error) {
-	return m.GetActiveLimiter().GetStatus(ctx, key)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.algorithms[m.current].Limiter.GetStatus(ctx, key)
+}
+
+// Config returns the runtime-tunable parameters of a registered algorithm.
+func (m *LimiterManager) Config(algorithm string) (Config, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c, err := m.configurable(algorithm)
+	if err != nil {
+		return Config{}, err
+	}
+	return c.Config(), nil
+}
+
+// UpdateConfig changes the capacity, rate and TTL of a registered built-in algorithm at runtime.
+// Only the parameters are swapped; stored keys are settled lazily on their next use: time before
+// the change is counted at the old parameters and each key keeps the amount it has used.
+// Calls through the manager see the change atomically; calls made directly on the limiter are not synchronized.
+// Invalid parameters return an error wrapping ErrInvalidConfig and change nothing.
+func (m *LimiterManager) UpdateConfig(ctx context.Context, algorithm string, cfg Config) error {
+	return m.updateConfig(algorithm, cfg, 0)
+}
+
+// updateConfig does the work of UpdateConfig with the time of the change in Unix ms
+// (0 = now by the algorithm's clock), so every instance of a cluster settles keys alike
+func (m *LimiterManager) updateConfig(algorithm string, cfg Config, changedAt int64) error {
+	return m.mutate(func() (bool, error) {
+		c, err := m.configurable(algorithm)
+		if err != nil {
+			return false, err
+		}
+		if err := c.checkConfig(cfg); err != nil {
+			return false, err
+		}
+		if changedAt == 0 {
+			changedAt = c.now().UnixMilli()
+		}
+		c.setConfig(cfg, changedAt)
+		return true, nil
+	})
+}
+
+// configurable returns the registered algorithm as a configurable limiter; the caller holds m.mu
+func (m *LimiterManager) configurable(algorithm string) (configurable, error) {
+	alg, ok := m.algorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown algorithm %q", ErrInvalidConfig, algorithm)
+	}
+	c, ok := alg.Limiter.(configurable)
+	if !ok {
+		return nil, fmt.Errorf("%w: algorithm %q cannot be reconfigured", ErrInvalidConfig, algorithm)
+	}
+	return c, nil
+}
+
+// KeyPattern delegates to the active algorithm if it implements KeyLister
+// (empty pattern if its keys cannot be listed).
+func (m *LimiterManager) KeyPattern() (string, func(storageKey string) string) {
+	if lister, ok := m.GetActiveLimiter().(KeyLister); ok {
+		return lister.KeyPattern()
+	}
+	return "", nil
 }
 
-// GetAlgorithmInfo returns information about the current algorithm configuration.
+// GetAlgorithmInfo returns information about the current algorithm configuration:
+// its name, description and parameters, plus the names of all registered algorithms.
 func (m *LimiterManager) GetAlgorithmInfo() map[string]interface{} {
 	m.mu.RLock()         // Acquire read lock
 	defer m.mu.RUnlock() // Release on function exit
 
+	alg := m.algorithms[m.current]
 	info := map[string]interface{}{
-		"current": m.current,
+		"current":     m.current,
+		"description": alg.Description,
+		"algorithms":  append([]string(nil), m.names...),
 	}
+	if alg.Params != nil {
+		for name, value := range alg.Params() {
+			info[name] = value
+		}
+	}
+	return info
+}
 
-	if m.current == "leaky_bucket" {
-		info["capacity"] = m.leakyBucket.Capacity
-		info["rate"] = m.leakyBucket.LeakRate
-		info["rate_name"] = "leak_rate"
-		info["description"] = "Requests add water; water leaks at constant rate. Full bucket = blocked."
-	} else {
-		info["capacity"] = m.tokenBucket.Capacity
-		info["rate"] = m.tokenBucket.RefillRate
-		info["rate_name"] = "refill_rate"
-		info["description"] = "Tokens refill at constant rate; requests consume tokens. No tokens = blocked."
+// LeakyBucketAlgorithm describes a LeakyBucket for the registry.
+func LeakyBucketAlgorithm(lb *LeakyBucket) Algorithm {
+	return Algorithm{
+		Name:        AlgorithmLeakyBucket,
+		Limiter:     lb,
+		Description: "Requests add water; water leaks at constant rate. Full bucket = blocked.",
+		Params: func() map[string]interface{} {
+			return map[string]interface{}{"capacity": lb.Capacity, "rate": lb.LeakRate, "rate_name": "leak_rate", "ttl_seconds": lb.TTL.Seconds()}
+		},
 	}
+}
 
-	return info
+// TokenBucketAlgorithm describes a TokenBucket for the registry.
+func TokenBucketAlgorithm(tb *TokenBucket) Algorithm {
+	return Algorithm{
+		Name:        AlgorithmTokenBucket,
+		Limiter:     tb,
+		Description: "Tokens refill at constant rate; requests consume tokens. No tokens = blocked.",
+		Params: func() map[string]interface{} {
+			return map[string]interface{}{"capacity": tb.Capacity, "rate": tb.RefillRate, "rate_name": "refill_rate", "ttl_seconds": tb.TTL.Seconds()}
+		},
+	}
 }
 
-// Ensure LimiterManager implements RateLimiter interface
-var _ RateLimiter = (*LimiterManager)(nil)
+// FixedWindowAlgorithm describes a FixedWindow for the registry.
+func FixedWindowAlgorithm(fw *FixedWindow) Algorithm {
+	return Algorithm{
+		Name:        AlgorithmFixedWindow,
+		Limiter:     fw,
+		Description: "Requests are counted per fixed time window. Limit reached = blocked until next window.",
+		Params: func() map[string]interface{} {
+			return map[string]interface{}{"capacity": fw.Limit, "rate": fw.Window.Seconds(), "rate_name": "window_seconds"}
+		},
+	}
+}
+
+// SlidingWindowLogAlgorithm describes a SlidingWindowLog for the registry.
+func SlidingWindowLogAlgorithm(sl *SlidingWindowLog) Algorithm {
+	return Algorithm{
+		Name:        AlgorithmSlidingWindowLog,
+		Limiter:     sl,
+		Description: "Every request timestamp is logged; at most N requests in any rolling window.",
+		Params: func() map[string]interface{} {
+			return map[string]interface{}{"capacity": sl.Limit, "rate": sl.Window.Seconds(), "rate_name": "window_seconds"}
+		},
+	}
+}
+
+// SlidingWindowCounterAlgorithm describes a SlidingWindowCounter for the registry.
+func SlidingWindowCounterAlgorithm(sc *SlidingWindowCounter) Algorithm {
+	return Algorithm{
+		Name:        AlgorithmSlidingWindowCounter,
+		Limiter:     sc,
+		Description: "Previous window count is weighted by its overlap with the rolling window; O(1) storage per key.",
+		Params: func() map[string]interface{} {
+			return map[string]interface{}{"capacity": sc.Limit, "rate": sc.Window.Seconds(), "rate_name": "window_seconds"}
+		},
+	}
+}
+
+// GCRAAlgorithm describes a GCRA limiter for the registry.
+func GCRAAlgorithm(g *GCRA) Algorithm {
+	return Algorithm{
+		Name:        AlgorithmGCRA,
+		Limiter:     g,
+		Description: "Stores one theoretical arrival time per key; requests too far ahead of schedule = blocked.",
+		Params: func() map[string]interface{} {
+			return map[string]interface{}{"capacity": g.Capacity, "rate": g.Rate, "rate_name": "rate"}
+		},
+	}
+}
+
+// Ensure LimiterManager implements RateLimiter and KeyLister interfaces
+var (
+	_ RateLimiter = (*LimiterManager)(nil)
+	_ KeyLister   = (*LimiterManager)(nil)
+)
@@ -0,0 +1,152 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+func TestLimiterManager_WithNamespaceAppliesToAllAlgorithms(t *testing.T) {
+	leaky := NewLeakyBucket(10, 2, time.Hour)
+	token := NewTokenBucket(10, 2, time.Hour)
+	gcra := NewGCRA(10, 2)
+
+	m := NewLimiterManager(leaky, token, AlgorithmLeakyBucket, WithNamespace("billing"))
+	m.SetGCRA(gcra)
+
+	assert.Equal(t, "billing:bucket:{k}", leaky.bucketKey("k"))
+	assert.Equal(t, "billing:token:{k}", token.bucketKey("k"))
+	assert.Equal(t, "billing:gcra:{k}", gcra.tatKey("k"))
+}
+
+func TestLimiterManager_WithoutNamespaceKeepsLimiterNamespace(t *testing.T) {
+	leaky := NewLeakyBucket(10, 2, time.Hour, WithNamespace("search"))
+	token := NewTokenBucket(10, 2, time.Hour)
+
+	NewLimiterManager(leaky, token, AlgorithmLeakyBucket)
+
+	assert.Equal(t, "search:bucket:{k}", leaky.bucketKey("k"))
+	assert.Equal(t, "token:{k}", token.bucketKey("k"))
+}
+
+func TestLimiterManager_KeepsLimiterClockAndNamespace(t *testing.T) {
+	own := NewManualClock(testEpoch)
+	leaky := NewLeakyBucket(10, 2, time.Hour, WithClock(own), WithNamespace("search"))
+	token := NewTokenBucket(10, 2, time.Hour)
+
+	shared := NewManualClock(testEpoch.Add(time.Hour))
+	NewLimiterManager(leaky, token, AlgorithmLeakyBucket, WithClock(shared), WithNamespace("billing"))
+
+	assert.Same(t, own, leaky.Clock)
+	assert.Equal(t, "search:bucket:{k}", leaky.bucketKey("k"))
+	assert.Same(t, shared, token.Clock)
+	assert.Equal(t, "billing:token:{k}", token.bucketKey("k"))
+}
+
+func TestLimiterManager_RegisterCustomAlgorithm(t *testing.T) {
+	m := NewLimiterManager(NewLeakyBucket(10, 2, time.Hour), NewTokenBucket(10, 2, time.Hour), AlgorithmLeakyBucket)
+	custom := &scriptedLimiter{result: Result{Allowed: true, Algorithm: "custom"}}
+
+	assert.ErrorIs(t, m.SetAlgorithm("custom"), ErrUnknownAlgorithm)
+
+	m.Register(Algorithm{
+		Name:        "custom",
+		Limiter:     custom,
+		Description: "test limiter",
+		Params: func() map[string]interface{} {
+			return map[string]interface{}{"capacity": 5}
+		},
+	})
+	assert.Equal(t, []string{AlgorithmLeakyBucket, AlgorithmTokenBucket, "custom"}, m.Algorithms())
+
+	assert.NoError(t, m.SetAlgorithm("custom"))
+	result, err := m.Allow(context.Background(), "k")
+	assert.NoError(t, err)
+	assert.Equal(t, "custom", result.Algorithm)
+	assert.Equal(t, 1, custom.calls)
+
+	info := m.GetAlgorithmInfo()
+	assert.Equal(t, "custom", info["current"])
+	assert.Equal(t, "test limiter", info["description"])
+	assert.Equal(t, 5, info["capacity"])
+	assert.Equal(t, []string{AlgorithmLeakyBucket, AlgorithmTokenBucket, "custom"}, info["algorithms"])
+
+	// Custom limiters without KeyLister have no listable keys
+	pattern, _ := m.KeyPattern()
+	assert.Empty(t, pattern)
+}
+
+func TestLimiterManager_RegisterPanicsWithoutNameOrLimiter(t *testing.T) {
+	m := NewLimiterManager(NewLeakyBucket(10, 2, time.Hour), NewTokenBucket(10, 2, time.Hour), AlgorithmLeakyBucket)
+
+	assert.Panics(t, func() { m.Register(Algorithm{Limiter: &scriptedLimiter{}}) })
+	assert.Panics(t, func() { m.Register(Algorithm{Name: "custom"}) })
+}
+
+func TestLimiterManager_UnknownDefaultFallsBackToLeakyBucket(t *testing.T) {
+	m := NewLimiterManager(NewLeakyBucket(10, 2, time.Hour), NewTokenBucket(10, 2, time.Hour), "unknown")
+
+	assert.Equal(t, AlgorithmLeakyBucket, m.GetCurrentAlgorithm())
+}
+
+func TestLimiterManager_KeyPatternFollowsActiveAlgorithm(t *testing.T) {
+	m := NewLimiterManager(NewLeakyBucket(10, 2, time.Hour), NewTokenBucket(10, 2, time.Hour),
+		AlgorithmLeakyBucket, WithNamespace("billing"))
+	m.SetFixedWindow(NewFixedWindow(10, time.Minute))
+
+	pattern, extract := m.KeyPattern()
+	assert.Equal(t, "billing:bucket:{*}", pattern)
+	assert.Equal(t, "1.2.3.4", extract("billing:bucket:{1.2.3.4}"))
+	assert.Equal(t, "", extract("bucket:{1.2.3.4}"))
+
+	assert.NoError(t, m.SetAlgorithm(AlgorithmFixedWindow))
+	pattern, extract = m.KeyPattern()
+	assert.Equal(t, "billing:window:{*}:*", pattern)
+	assert.Equal(t, "a}:b", extract("billing:window:{a}:b}:1700000000000"))
+	assert.Equal(t, "", extract("billing:window:{a"))
+}
+
+func TestLimiterManager_OnChangeCalledAfterEveryChange(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	m := NewLimiterManager(
+		NewLeakyBucket(1, 1, time.Hour, WithStorage(store)),
+		NewTokenBucket(1, 1, time.Hour, WithStorage(store)),
+		AlgorithmLeakyBucket, WithClock(clk))
+	dc := NewDenyCache(m, 10, WithClock(clk))
+	m.OnChange(dc.Clear)
+	changes := 0
+	m.OnChange(func() { changes++ })
+
+	// deny fills the bucket of k and checks the denial is cached
+	deny := func() {
+		_, _ = dc.Allow(ctx, "k")
+		result, err := dc.Allow(ctx, "k")
+		assert.NoError(t, err)
+		assert.False(t, result.Allowed)
+		assert.Equal(t, 1, dc.Stats().Entries)
+	}
+
+	deny()
+	assert.NoError(t, m.SetAlgorithm(AlgorithmTokenBucket))
+	assert.Equal(t, 0, dc.Stats().Entries)
+
+	deny()
+	assert.NoError(t, m.UpdateConfig(ctx, AlgorithmTokenBucket, Config{Capacity: 2, Rate: 1, TTL: time.Hour}))
+	assert.Equal(t, 0, dc.Stats().Entries)
+
+	deny()
+	assert.NoError(t, m.SetAlgorithmWithState(ctx, AlgorithmLeakyBucket))
+	assert.Equal(t, 0, dc.Stats().Entries)
+	assert.Equal(t, 3, changes)
+
+	// Failed or no-op calls change nothing
+	assert.Error(t, m.SetAlgorithm("unknown"))
+	assert.NoError(t, m.SetAlgorithm(AlgorithmLeakyBucket))
+	assert.Error(t, m.UpdateConfig(ctx, AlgorithmLeakyBucket, Config{Capacity: 0, Rate: 1}))
+	assert.Equal(t, 3, changes)
+}
@@ -0,0 +1,87 @@
+package limiter
+
+import (
+	"context"
+	"strings"
+
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+// legacyBucketLayout adalah format key lama (dua STRING per client) untuk satu algoritma bucket
+type legacyBucketLayout struct {
+	prefix     string // "bucket:" / "token:"
+	valueField string // Field hash baru untuk nilai water / tokens
+}
+
+var legacyBucketLayouts = []legacyBucketLayout{
+	{prefix: "bucket:", valueField: "water"},
+	{prefix: "token:", valueField: "tokens"},
+}
+
+// migrateBucketScript memindahkan satu client dari dua key STRING ke satu HASH secara atomik
+// KEYS[1] = key nilai lama, KEYS[2] = key time lama, KEYS[3] = key hash baru
+// ARGV[1] = nama field untuk nilai (water / tokens)
+// Returns: {1} jika state dipindahkan, {0} jika hash baru sudah ada atau key lama sudah hilang
+// Sengaja tanpa implementasi Go (WithLocal): format lama hanya pernah ditulis ke Redis
+var migrateBucketScript = storage.NewScript(`
+local value = redis.call('GET', KEYS[1])
+local last = redis.call('GET', KEYS[2])
+local migrated = 0
+
+-- Hash baru yang sudah ada (sudah ditulis Allow setelah upgrade) lebih baru, jadi tidak ditimpa
+if value and redis.call('EXISTS', KEYS[3]) == 0 then
+  local ttl = redis.call('PTTL', KEYS[1])
+  redis.call('HSET', KEYS[3], ARGV[1], value)
+  if last then
+    redis.call('HSET', KEYS[3], 'time', last)
+  end
+  if ttl > 0 then
+    redis.call('PEXPIRE', KEYS[3], ttl)
+  end
+  migrated = 1
+end
+
+redis.call('DEL', KEYS[1], KEYS[2])
+return {migrated}
+`)
+
+// MigrateBucketKeys memindahkan state Leaky Bucket dan Token Bucket dari format lama
+// (bucket:<key>:water + bucket:<key>:time, token:<key>:tokens + token:<key>:time)
+// ke satu HASH per client (bucket:{<key>}, token:{<key>}) dengan TTL yang tersisa.
+// Key lama dengan dan tanpa hash tag sama-sama dikenali; key lama dihapus setelah dipindahkan.
+// Aman dijalankan berulang kali dan saat API sedang berjalan. Mengembalikan jumlah client yang dipindahkan.
+// Dari opts hanya WithNamespace yang dipakai: key lama dan hash baru sama-sama diberi prefix "<namespace>:".
+//
+// Hanya relevan untuk Redis: MemoryStorage tidak menyimpan state antar restart, jadi tidak pernah berisi key lama
+// dan hasilnya selalu 0.
+// Key tanpa hash tag hanya ada di deployment single node, sehingga aman dari CROSSSLOT di Cluster.
+func MigrateBucketKeys(ctx context.Context, store storage.Storage, opts ...Option) (int, error) {
+	namespace := applyOptions(opts).namespace
+	migrated := 0
+	for _, layout := range legacyBucketLayouts {
+		prefix := namespacedKey(namespace, layout.prefix)
+		valueSuffix := ":" + layout.valueField
+		keys, err := store.Keys(ctx, prefix+"*"+valueSuffix)
+		if err != nil {
+			return migrated, err
+		}
+
+		for _, valueKey := range keys {
+			clientKey := strings.TrimSuffix(strings.TrimPrefix(valueKey, prefix), valueSuffix)
+			if strings.HasPrefix(clientKey, "{") && strings.HasSuffix(clientKey, "}") {
+				clientKey = clientKey[1 : len(clientKey)-1] // Format dengan hash tag (bucket:{<key>}:water)
+			}
+
+			timeKey := strings.TrimSuffix(valueKey, valueSuffix) + ":time"
+			res, err := store.Eval(ctx, migrateBucketScript,
+				[]string{valueKey, timeKey, prefix + hashTag(clientKey)}, layout.valueField)
+			if err != nil {
+				return migrated, err
+			}
+			if len(res) > 0 && res[0] == int64(1) {
+				migrated++
+			}
+		}
+	}
+	return migrated, nil
+}
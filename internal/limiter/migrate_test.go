@@ -0,0 +1,94 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+func TestMigrateBucketKeys(t *testing.T) {
+	mock := setupMockRedis()
+
+	// Format lama tanpa hash tag dan dengan hash tag, dalam dua halaman SCAN
+	mock.ExpectScan(0, "bucket:*:water", 1000).SetVal([]string{"bucket:1.2.3.4:water"}, 7)
+	mock.ExpectScan(7, "bucket:*:water", 1000).SetVal([]string{"bucket:{5.6.7.8}:water"}, 0)
+	mock.ExpectEvalSha(migrateBucketScript.Hash(),
+		[]string{"bucket:1.2.3.4:water", "bucket:1.2.3.4:time", "bucket:{1.2.3.4}"}, "water").
+		SetVal([]interface{}{int64(1)})
+	mock.ExpectEvalSha(migrateBucketScript.Hash(),
+		[]string{"bucket:{5.6.7.8}:water", "bucket:{5.6.7.8}:time", "bucket:{5.6.7.8}"}, "water").
+		SetVal([]interface{}{int64(1)})
+
+	// Hash baru sudah ada - key lama hanya dihapus
+	mock.ExpectScan(0, "token:*:tokens", 1000).SetVal([]string{"token:api-key:tokens"}, 0)
+	mock.ExpectEvalSha(migrateBucketScript.Hash(),
+		[]string{"token:api-key:tokens", "token:api-key:time", "token:{api-key}"}, "tokens").
+		SetVal([]interface{}{int64(0)})
+
+	migrated, err := MigrateBucketKeys(ctx, storage.Default())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, migrated)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrateBucketKeys_Namespace(t *testing.T) {
+	mock := setupMockRedis()
+
+	// Hanya key lama milik namespace ini yang dicari, dan hash baru ikut diberi prefix
+	mock.ExpectScan(0, "billing:bucket:*:water", 1000).SetVal([]string{"billing:bucket:{1.2.3.4}:water"}, 0)
+	mock.ExpectEvalSha(migrateBucketScript.Hash(),
+		[]string{"billing:bucket:{1.2.3.4}:water", "billing:bucket:{1.2.3.4}:time", "billing:bucket:{1.2.3.4}"}, "water").
+		SetVal([]interface{}{int64(1)})
+	mock.ExpectScan(0, "billing:token:*:tokens", 1000).SetVal([]string{"billing:token:api-key:tokens"}, 0)
+	mock.ExpectEvalSha(migrateBucketScript.Hash(),
+		[]string{"billing:token:api-key:tokens", "billing:token:api-key:time", "billing:token:{api-key}"}, "tokens").
+		SetVal([]interface{}{int64(1)})
+
+	migrated, err := MigrateBucketKeys(ctx, storage.Default(), WithNamespace("billing"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, migrated)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrateBucketKeys_Lua(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	store := storage.NewRedisStorage(client)
+
+	assert.NoError(t, server.Set("bucket:1.2.3.4:water", "3.5"))
+	assert.NoError(t, server.Set("bucket:1.2.3.4:time", "1700000000000"))
+	server.SetTTL("bucket:1.2.3.4:water", time.Minute)
+	// Hash baru sudah ditulis setelah upgrade - tidak ditimpa
+	assert.NoError(t, server.Set("token:api-key:tokens", "1"))
+	server.HSet("token:{api-key}", "tokens", "7")
+
+	migrated, err := MigrateBucketKeys(ctx, store)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, migrated)
+
+	assert.Equal(t, "3.5", server.HGet("bucket:{1.2.3.4}", "water"))
+	assert.Equal(t, "1700000000000", server.HGet("bucket:{1.2.3.4}", "time"))
+	assert.Equal(t, time.Minute, server.TTL("bucket:{1.2.3.4}"))
+	assert.Equal(t, "7", server.HGet("token:{api-key}", "tokens"))
+	assert.Equal(t, []string{"bucket:{1.2.3.4}", "token:{api-key}"}, server.Keys())
+}
+
+func TestMigrateBucketKeys_MemoryStorage(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+
+	// Tidak ada key lama di memori, jadi script Redis-only tidak pernah dijalankan
+	_, err := NewLeakyBucket(10, 1, time.Hour, WithStorage(store)).Allow(ctx, "k")
+	assert.NoError(t, err)
+	migrated, err := MigrateBucketKeys(ctx, store)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, migrated)
+
+	_, err = store.Eval(ctx, migrateBucketScript, []string{"bucket:k:water", "bucket:k:time", "bucket:{k}"}, "water")
+	assert.ErrorIs(t, err, storage.ErrScriptNotSupported)
+}
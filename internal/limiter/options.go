@@ -0,0 +1,52 @@
+package limiter
+
+import "github.com/user/Rate-Limiting-API/internal/storage"
+
+// Option mengatur konfigurasi opsional constructor limiter dan LimiterManager
+type Option func(*options)
+
+// options menampung hasil semua Option
+type options struct {
+	clock     Clock
+	storage   storage.Storage
+	namespace string
+}
+
+// WithClock mengganti sumber waktu limiter (default: waktu sistem)
+func WithClock(c Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithStorage mengganti backend penyimpanan state (default: Redis lewat storage.RedisClient)
+func WithStorage(s storage.Storage) Option {
+	return func(o *options) {
+		o.storage = s
+	}
+}
+
+// WithNamespace menambahkan prefix "<namespace>:" ke semua key limiter,
+// agar beberapa service bisa memakai Redis yang sama tanpa bentrok (misalnya "billing:bucket:{<key>}")
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+// applyOptions menjalankan semua Option secara berurutan
+func applyOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// storeFrom mengembalikan s, atau Storage Redis default jika s nil
+func storeFrom(s storage.Storage) storage.Storage {
+	if s == nil {
+		return storage.Default()
+	}
+	return s
+}
@@ -0,0 +1,240 @@
+package limiter
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+// parityCall is one Eval sent to both backends
+type parityCall struct {
+	script *storage.Script
+	keys   []string
+	args   []interface{}
+}
+
+// parityKey is a key whose stored state is compared after every call
+type parityKey struct {
+	name string
+	kind string // "hash", "string" or "zset" (compared by member count)
+}
+
+// parityValue makes replies and stored values comparable: numbers (integer replies and numeric strings)
+// become float64 rounded to 15 significant digits, because Lua and Go may format the same float differently
+func parityValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case int64:
+		return parityNumber(float64(x))
+	case string:
+		if fields := strings.Fields(x); len(fields) > 1 {
+			return parityValue(toInterfaces(fields))
+		}
+		if f, err := strconv.ParseFloat(x, 64); err == nil {
+			return parityNumber(f)
+		}
+		return x
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, item := range x {
+			out[i] = parityValue(item)
+		}
+		return out
+	case map[string]string:
+		out := make(map[string]interface{}, len(x))
+		for field, val := range x {
+			out[field] = parityValue(val)
+		}
+		return out
+	}
+	return v
+}
+
+func parityNumber(f float64) float64 {
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(f, 'g', 15, 64), 64)
+	return rounded
+}
+
+func toInterfaces(ss []string) []interface{} {
+	out := make([]interface{}, len(ss))
+	for i, s := range ss {
+		out[i] = s
+	}
+	return out
+}
+
+// parityState reads a key's stored state from one backend
+func parityState(t *testing.T, store storage.Storage, key parityKey) interface{} {
+	switch key.kind {
+	case "hash":
+		fields, err := store.HGetAll(ctx, key.name)
+		assert.NoError(t, err)
+		return parityValue(fields)
+	case "zset":
+		count, err := store.ZCount(ctx, key.name, 0)
+		assert.NoError(t, err)
+		return count
+	}
+	val, err := store.Get(ctx, key.name)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	assert.NoError(t, err)
+	return parityValue(val)
+}
+
+// TestScripts_LocalMatchesLua runs every Lua script under miniredis and its WithLocal version on MemoryStorage
+// with the same inputs, and checks that both return the same replies and leave the same state behind
+func TestScripts_LocalMatchesLua(t *testing.T) {
+	n := testEpoch.UnixMilli()
+
+	cases := []struct {
+		name  string
+		state []parityKey
+		calls []parityCall
+	}{
+		{
+			name:  "leaky bucket",
+			state: []parityKey{{"bucket:{k}", "hash"}},
+			calls: []parityCall{
+				// capacity, leak rate, now, TTL, cost, max delay, changed at
+				{leakyBucketScript, []string{"bucket:{k}"}, []interface{}{10.0, 2.0, n, int64(60000), int64(4), int64(0), int64(0)}},
+				{leakyBucketScript, []string{"bucket:{k}"}, []interface{}{10.0, 2.0, n + 500, int64(60000), int64(8), int64(0), int64(0)}},
+				{leakyBucketScript, []string{"bucket:{k}"}, []interface{}{10.0, 2.0, n + 500, int64(60000), int64(8), int64(2000), int64(0)}},
+				{leakyBucketScript, []string{"bucket:{k}"}, []interface{}{20.0, 4.0, n + 2000, int64(60000), int64(3), int64(0), n + 1000}},
+				{leakyBucketScript, []string{"bucket:{k}"}, []interface{}{20.0, 4.0, n + 2300, int64(0), int64(1), int64(0), n + 1000}},
+				// Legacy state: timestamp in seconds and no rate field
+				{setBucketScript, []string{"bucket:{k}"}, []interface{}{int64(60000), "water", "5", "time", strconv.FormatInt(testEpoch.Unix(), 10)}},
+				{leakyBucketScript, []string{"bucket:{k}"}, []interface{}{10.0, 2.0, n + 1000, int64(60000), int64(1), int64(0), int64(0)}},
+			},
+		},
+		{
+			name:  "token bucket",
+			state: []parityKey{{"token:{k}", "hash"}},
+			calls: []parityCall{
+				// capacity, refill rate, now, TTL, cost, changed at
+				{tokenBucketScript, []string{"token:{k}"}, []interface{}{10.0, 1.0, n, int64(60000), int64(8), int64(0)}},
+				{tokenBucketScript, []string{"token:{k}"}, []interface{}{10.0, 1.0, n + 1000, int64(60000), int64(5), int64(0)}},
+				{tokenBucketScript, []string{"token:{k}"}, []interface{}{20.0, 2.0, n + 3000, int64(60000), int64(5), n + 2000}},
+				{tokenBucketScript, []string{"token:{k}"}, []interface{}{5.0, 2.0, n + 3000, int64(0), int64(1), n + 3000}},
+				{tokenBucketScript, []string{"token:{k}"}, []interface{}{5.0, 2.0, n + 3100, int64(0), int64(4), n + 3000}},
+				// Legacy state: timestamp in seconds and no capacity or rate fields
+				{setBucketScript, []string{"token:{k}"}, []interface{}{int64(60000), "tokens", "2.5", "time", strconv.FormatInt(testEpoch.Unix(), 10)}},
+				{tokenBucketScript, []string{"token:{k}"}, []interface{}{10.0, 1.0, n + 1500, int64(60000), int64(3), int64(0)}},
+			},
+		},
+		{
+			name:  "token lease",
+			state: []parityKey{{"token:{k}", "hash"}},
+			calls: []parityCall{
+				// capacity, refill rate, now, TTL, minimum claim, maximum claim, returned tokens, changed at
+				{tokenLeaseScript, []string{"token:{k}"}, []interface{}{10.0, 1.0, n, int64(60000), int64(1), int64(5), 0.0, int64(0)}},
+				{tokenLeaseScript, []string{"token:{k}"}, []interface{}{10.0, 1.0, n + 500, int64(60000), int64(1), int64(5), 2.0, int64(0)}},
+				{tokenLeaseScript, []string{"token:{k}"}, []interface{}{10.0, 1.0, n + 500, int64(60000), int64(6), int64(6), 1.0, int64(0)}},
+				{tokenLeaseScript, []string{"token:{k}"}, []interface{}{10.0, 1.0, n + 600, int64(60000), int64(6), int64(6), 0.0, int64(0)}},
+				{tokenLeaseScript, []string{"token:{k}"}, []interface{}{20.0, 2.0, n + 4000, int64(0), int64(3), int64(5), 0.0, n + 3000}},
+			},
+		},
+		{
+			name:  "gcra",
+			state: []parityKey{{"gcra:{k}", "string"}},
+			calls: []parityCall{
+				// capacity, emission interval, now, cost, rate, changed at
+				{gcraScript, []string{"gcra:{k}"}, []interface{}{10.0, 500.0, n, int64(4), 2.0, int64(0)}},
+				{gcraScript, []string{"gcra:{k}"}, []interface{}{10.0, 500.0, n, int64(8), 2.0, int64(0)}},
+				{gcraScript, []string{"gcra:{k}"}, []interface{}{10.0, 250.0, n + 500, int64(2), 4.0, n + 200}},
+				{gcraScript, []string{"gcra:{k}"}, []interface{}{10.0, 250.0, n + 500, int64(9), 4.0, n + 200}},
+				// Legacy state: only the TAT, without the rate it was written with
+				{setTATScript, []string{"gcra:{k}"}, []interface{}{strconv.FormatInt(n+1000, 10), int64(5000)}},
+				{gcraScript, []string{"gcra:{k}"}, []interface{}{10.0, 500.0, n, int64(1), 2.0, int64(0)}},
+			},
+		},
+		{
+			name:  "fixed window",
+			state: []parityKey{{"fw:{k}:1", "string"}},
+			calls: []parityCall{
+				// limit, milliseconds until the window ends, cost
+				{fixedWindowScript, []string{"fw:{k}:1"}, []interface{}{int64(5), int64(30000), int64(3)}},
+				{fixedWindowScript, []string{"fw:{k}:1"}, []interface{}{int64(5), int64(29000), int64(3)}},
+				{fixedWindowScript, []string{"fw:{k}:1"}, []interface{}{int64(5), int64(28000), int64(2)}},
+				{fixedWindowScript, []string{"fw:{k}:1"}, []interface{}{int64(5), int64(27000), int64(1)}},
+			},
+		},
+		{
+			name:  "sliding window log",
+			state: []parityKey{{"swl:{k}", "zset"}},
+			calls: []parityCall{
+				// limit, window, now, member prefix, cost
+				{slidingWindowLogScript, []string{"swl:{k}"}, []interface{}{int64(3), int64(1000), n, "a", int64(2)}},
+				{slidingWindowLogScript, []string{"swl:{k}"}, []interface{}{int64(3), int64(1000), n + 400, "b", int64(2)}},
+				{slidingWindowLogScript, []string{"swl:{k}"}, []interface{}{int64(3), int64(1000), n + 400, "c", int64(1)}},
+				{slidingWindowLogScript, []string{"swl:{k}"}, []interface{}{int64(3), int64(1000), n + 600, "d", int64(1)}},
+				{slidingWindowLogScript, []string{"swl:{k}"}, []interface{}{int64(3), int64(1000), n + 1000, "e", int64(2)}},
+				{slidingWindowLogScript, []string{"swl:{k}"}, []interface{}{int64(3), int64(1000), n + 3000, "f", int64(5)}},
+			},
+		},
+		{
+			name:  "sliding window counter",
+			state: []parityKey{{"swc:{k}", "hash"}},
+			calls: []parityCall{
+				// limit, window, now, cost
+				{slidingWindowCounterScript, []string{"swc:{k}"}, []interface{}{int64(10), int64(1000), n, int64(6)}},
+				{slidingWindowCounterScript, []string{"swc:{k}"}, []interface{}{int64(10), int64(1000), n + 1250, int64(5)}},
+				{slidingWindowCounterScript, []string{"swc:{k}"}, []interface{}{int64(10), int64(1000), n + 1500, int64(3)}},
+				{slidingWindowCounterScript, []string{"swc:{k}"}, []interface{}{int64(10), int64(1000), n + 1500, int64(6)}},
+				{slidingWindowCounterScript, []string{"swc:{k}"}, []interface{}{int64(10), int64(1000), n + 3500, int64(11)}},
+				{slidingWindowCounterScript, []string{"swc:{k}"}, []interface{}{int64(10), int64(1000), n + 3500, int64(1)}},
+			},
+		},
+		{
+			name:  "concurrency",
+			state: []parityKey{{"inflight:{k}", "zset"}},
+			calls: []parityCall{
+				// limit, lease TTL, now, lease ID
+				{acquireScript, []string{"inflight:{k}"}, []interface{}{int64(2), int64(1000), n, "a"}},
+				{acquireScript, []string{"inflight:{k}"}, []interface{}{int64(2), int64(1000), n + 100, "b"}},
+				{acquireScript, []string{"inflight:{k}"}, []interface{}{int64(2), int64(1000), n + 200, "c"}},
+				{releaseScript, []string{"inflight:{k}"}, []interface{}{"a"}},
+				{acquireScript, []string{"inflight:{k}"}, []interface{}{int64(2), int64(1000), n + 300, "c"}},
+				{acquireScript, []string{"inflight:{k}"}, []interface{}{int64(2), int64(1000), n + 1200, "d"}},
+			},
+		},
+		{
+			name:  "cluster state",
+			state: []parityKey{{"ratelimit:{config}", "hash"}, {"ratelimit:{config}:ack:a", "string"}},
+			calls: []parityCall{
+				{publishStateScript, []string{"ratelimit:{config}"}, []interface{}{"ratelimit:config", "algorithm", "token_bucket"}},
+				{publishStateScript, []string{"ratelimit:{config}"}, []interface{}{"ratelimit:config", "config:leaky_bucket", `{"capacity":20}`}},
+				{ackScript, []string{"ratelimit:{config}:ack:a"}, []interface{}{`{"instance":"a","version":2}`, int64(60000)}},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+			defer client.Close()
+			lua := storage.NewRedisStorage(client)
+			local := storage.NewMemoryStorage(0)
+			defer local.Close()
+
+			for i, call := range tc.calls {
+				want, err := lua.Eval(ctx, call.script, call.keys, call.args...)
+				assert.NoError(t, err, "call %d (Lua)", i)
+				got, err := local.Eval(ctx, call.script, call.keys, call.args...)
+				assert.NoError(t, err, "call %d (Go)", i)
+				assert.Equal(t, parityValue(want), parityValue(got), "reply of call %d", i)
+
+				for _, key := range tc.state {
+					assert.Equal(t, parityState(t, lua, key), parityState(t, local, key), "state of %s after call %d", key.name, i)
+				}
+			}
+		})
+	}
+}
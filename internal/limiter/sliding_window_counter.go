@@ -0,0 +1,279 @@
+package limiter
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+// Pastikan SlidingWindowCounter implement RateLimiter interface
+var _ RateLimiter = (*SlidingWindowCounter)(nil)
+var _ KeyLister = (*SlidingWindowCounter)(nil)
+
+// SlidingWindowCounter implements the Sliding Window Counter rate limiting algorithm.
+// It approximates a rolling window using two fixed windows:
+// - Requests are counted in the current fixed window
+// - The previous window's count is weighted by how much of it still overlaps the rolling window
+// - estimate = prev * (1 - elapsed/window) + curr; estimate + 1 > Limit = blocked
+// - Storage is O(1) per key: one hash with the window start and both counters
+type SlidingWindowCounter struct {
+	Limit     int64         // Maximum requests in a rolling window (approximate)
+	Window    time.Duration // Rolling window length
+	Clock     Clock
+	Storage   storage.Storage
+	Namespace string
+}
+
+// NewSlidingWindowCounter creates a new SlidingWindowCounter instance
+// limit: maximum requests allowed in a rolling window
+// window: rolling window length
+// Panics if limit is below 1 or window is not a whole number of milliseconds (at least 1ms).
+func NewSlidingWindowCounter(limit int64, window time.Duration, opts ...Option) *SlidingWindowCounter {
+	if err := checkWindowConfig(Config{Capacity: float64(limit), Rate: window.Seconds()}, window); err != nil {
+		panic(err)
+	}
+	o := applyOptions(opts)
+	return &SlidingWindowCounter{
+		Limit:     limit,
+		Window:    window,
+		Clock:     o.clock,
+		Storage:   o.storage,
+		Namespace: o.namespace,
+	}
+}
+
+// now returns the current time from Clock
+func (sc *SlidingWindowCounter) now() time.Time {
+	return nowFrom(sc.Clock)
+}
+
+// store returns the state backend
+func (sc *SlidingWindowCounter) store() storage.Storage {
+	return storeFrom(sc.Storage)
+}
+
+// counterKey generates Redis key for the counter hash (fields: window, curr, prev)
+func (sc *SlidingWindowCounter) counterKey(key string) string {
+	return namespacedKey(sc.Namespace, "counter:"+hashTag(key))
+}
+
+// KeyPattern returns the Redis key pattern of the counters and how to extract the client key (used by the dashboard)
+func (sc *SlidingWindowCounter) KeyPattern() (string, func(string) string) {
+	prefix := namespacedKey(sc.Namespace, "counter:{")
+	return prefix + "*}", clientKeyBetween(prefix, "}")
+}
+
+// slidingWindowCounterScript rotates, weights and increments the counters atomically
+// KEYS[1] = counter hash key
+// ARGV[1] = limit, ARGV[2] = window (ms), ARGV[3] = now (ms), ARGV[4] = cost
+// Returns: {allowed (0/1), remaining requests, retry after (ms), reset after (ms)} (numbers as strings)
+var slidingWindowCounterScript = storage.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+local start = now - (now % window)
+
+local stored = redis.call('HMGET', KEYS[1], 'window', 'curr', 'prev')
+local stored_start = tonumber(stored[1])
+local curr = tonumber(stored[2]) or 0
+local prev = tonumber(stored[3]) or 0
+
+if stored_start == start - window then
+  prev = curr
+  curr = 0
+elseif stored_start ~= start then
+  prev = 0
+  curr = 0
+end
+
+-- Time until both counters have fully faded out of the rolling window
+local function reset_after()
+  if curr > 0 then
+    return start + 2 * window - now
+  elseif prev > 0 then
+    return start + window - now
+  end
+  return 0
+end
+
+local weight = (window - (now - start)) / window
+local estimate = prev * weight + curr
+if estimate + cost > limit then
+  local budget = limit - cost
+  local retry_after = 0
+  if budget < 0 then
+    retry_after = 0 -- Cost larger than the limit can never be allowed
+  elseif curr <= budget then
+    -- Previous window must fade until prev * weight <= budget - curr
+    retry_after = start + window * (1 - (budget - curr) / prev) - now
+  else
+    -- Current window is already over budget: wait until it becomes the fading previous window
+    retry_after = start + window * (2 - budget / curr) - now
+  end
+  return {0, tostring(math.max(0, limit - estimate)), tostring(retry_after), tostring(reset_after())}
+end
+
+curr = curr + cost
+redis.call('HSET', KEYS[1], 'window', start, 'curr', curr, 'prev', prev)
+redis.call('PEXPIRE', KEYS[1], window * 2)
+
+return {1, tostring(limit - estimate - cost), '0', tostring(reset_after())}
+`).WithLocal(slidingWindowCounterLocal)
+
+// slidingWindowCounterLocal is the Go version of slidingWindowCounterScript for storages without Lua
+func slidingWindowCounterLocal(tx storage.Tx, keys []string, args []interface{}) ([]interface{}, error) {
+	limit := argFloat(args[0])
+	window := argFloat(args[1])
+	now := argFloat(args[2])
+	cost := argFloat(args[3])
+	start := now - math.Mod(now, window)
+
+	storedStart := -1.0
+	if val, ok := tx.HGet(keys[0], "window"); ok {
+		storedStart, _ = strconv.ParseFloat(val, 64)
+	}
+	curr, prev := 0.0, 0.0
+	if val, ok := tx.HGet(keys[0], "curr"); ok {
+		curr, _ = strconv.ParseFloat(val, 64)
+	}
+	if val, ok := tx.HGet(keys[0], "prev"); ok {
+		prev, _ = strconv.ParseFloat(val, 64)
+	}
+	curr, prev = rotateCounters(storedStart, start, window, curr, prev)
+
+	resetAfter := func() float64 {
+		switch {
+		case curr > 0:
+			return start + 2*window - now
+		case prev > 0:
+			return start + window - now
+		}
+		return 0
+	}
+
+	weight := (window - (now - start)) / window
+	estimate := prev*weight + curr
+	if estimate+cost > limit {
+		budget := limit - cost
+		retryAfter := 0.0
+		switch {
+		case budget < 0:
+		case curr <= budget:
+			retryAfter = start + window*(1-(budget-curr)/prev) - now
+		default:
+			retryAfter = start + window*(2-budget/curr) - now
+		}
+		return scriptReply(false, math.Max(0, limit-estimate), retryAfter, resetAfter()), nil
+	}
+
+	curr += cost
+	tx.HSet(keys[0], map[string]string{
+		"window": formatNumber(start),
+		"curr":   formatNumber(curr),
+		"prev":   formatNumber(prev),
+	}, time.Duration(window*2)*time.Millisecond)
+
+	return scriptReply(true, limit-estimate-cost, 0, resetAfter()), nil
+}
+
+// rotateCounters moves the stored counters to the window starting at start:
+// the stored current window becomes the previous one, anything older is dropped
+func rotateCounters(storedStart, start, window, curr, prev float64) (float64, float64) {
+	switch storedStart {
+	case start:
+		return curr, prev
+	case start - window:
+		return 0, curr
+	}
+	return 0, 0
+}
+
+// Allow checks whether the weighted request count allows another request and counts it if so.
+// Result.Remaining = requests left in rolling window, Result.ResetAt = when both counters have faded out
+func (sc *SlidingWindowCounter) Allow(ctx context.Context, key string) (*Result, error) {
+	return sc.AllowN(ctx, key, 1)
+}
+
+// AllowN is like Allow but counts n requests at once (all or nothing).
+// A cost above Limit can never fit and returns ErrCostExceedsLimit.
+func (sc *SlidingWindowCounter) AllowN(ctx context.Context, key string, n int64) (*Result, error) {
+	if n < 1 {
+		return nil, ErrInvalidCost
+	}
+	if n > sc.Limit {
+		return nil, ErrCostExceedsLimit
+	}
+
+	now := sc.now()
+
+	res, err := sc.store().Eval(ctx, slidingWindowCounterScript,
+		[]string{sc.counterKey(key)}, sc.Limit, sc.Window.Milliseconds(), now.UnixMilli(), n)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := parseScriptResult(res, now)
+	if err != nil {
+		return nil, err
+	}
+	result.Limit = float64(sc.Limit)
+	result.Window = sc.Window
+	result.Algorithm = AlgorithmSlidingWindowCounter
+	return result, nil
+}
+
+// Reset clears both window counters for a specific key
+func (sc *SlidingWindowCounter) Reset(ctx context.Context, key string) error {
+	return sc.store().Del(ctx, sc.counterKey(key))
+}
+
+// GetStatus retrieves the weighted request count of the rolling window for a key
+func (sc *SlidingWindowCounter) GetStatus(ctx context.Context, key string) (*Status, error) {
+	now := sc.now().UnixMilli()
+	window := sc.Window.Milliseconds()
+	start := now - now%window
+
+	// Retrieve window start and both counters (empty map if the key doesn't exist)
+	state, err := sc.store().HGetAll(ctx, sc.counterKey(key))
+	if err != nil {
+		return nil, err
+	}
+	storedStart := parseHashFloat(state, "window", -1)
+	curr := parseHashFloat(state, "curr", 0)
+	prev := parseHashFloat(state, "prev", 0)
+
+	// Rotate counters the same way the script does
+	curr, prev = rotateCounters(storedStart, float64(start), float64(window), curr, prev)
+
+	weight := float64(window-(now-start)) / float64(window) // Share of previous window still in rolling window
+	estimate := prev*weight + curr
+
+	limit := float64(sc.Limit)
+	remaining := limit - estimate
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return &Status{
+		Key:       key,
+		Current:   estimate,                    // Weighted requests in rolling window
+		Capacity:  limit,                       // Maximum requests per window
+		Remaining: remaining,                   // Requests left in rolling window
+		LeakRate:  limit / sc.Window.Seconds(), // Average allowed rate per second
+		IsLimited: estimate+1 > limit,          // Limited if next request would exceed limit
+		Algorithm: AlgorithmSlidingWindowCounter,
+	}, nil
+}
+
+// parseHashFloat parses a hash field as float64 (def if the field is missing or invalid)
+func parseHashFloat(state map[string]string, field string, def float64) float64 {
+	f, err := strconv.ParseFloat(state[field], 64)
+	if err != nil {
+		return def
+	}
+	return f
+}
@@ -0,0 +1,189 @@
+package limiter
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+// TestNewSlidingWindowCounter verifies SlidingWindowCounter constructor
+func TestNewSlidingWindowCounter(t *testing.T) {
+	sc := NewSlidingWindowCounter(100, time.Minute)
+
+	assert.Equal(t, int64(100), sc.Limit)   // Max requests per rolling window
+	assert.Equal(t, time.Minute, sc.Window) // Rolling window length
+}
+
+// TestNewSlidingWindowCounter_RejectsInvalidParams verifies that a window without whole milliseconds or a negative limit is rejected
+func TestNewSlidingWindowCounter_RejectsInvalidParams(t *testing.T) {
+	assert.Panics(t, func() { NewSlidingWindowCounter(-1, time.Minute) })
+	assert.Panics(t, func() { NewSlidingWindowCounter(10, 1500*time.Microsecond) })
+	assert.Panics(t, func() { NewSlidingWindowCounter(10, 0) })
+}
+
+// TestSlidingWindowCounter_ImplementsInterface ensures SlidingWindowCounter implements RateLimiter
+func TestSlidingWindowCounter_ImplementsInterface(t *testing.T) {
+	var _ RateLimiter = (*SlidingWindowCounter)(nil)
+}
+
+// TestSlidingWindowCounter_Allow_FirstRequest tests first request with no counters
+func TestSlidingWindowCounter_Allow_FirstRequest(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	sc := NewSlidingWindowCounter(5, time.Minute, WithClock(NewManualClock(testEpoch)), WithStorage(store))
+
+	result, err := sc.Allow(ctx, "test_counter_key")
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 4.0, result.Remaining)
+}
+
+// TestSlidingWindowCounter_Allow_LimitReached tests denial when the weighted count is at the limit
+func TestSlidingWindowCounter_Allow_LimitReached(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	sc := NewSlidingWindowCounter(5, 10*time.Second, WithClock(NewManualClock(testEpoch)), WithStorage(store))
+
+	key := "test_counter_full"
+
+	_, err := sc.AllowN(ctx, key, 5)
+	assert.NoError(t, err)
+
+	result, err := sc.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed) // Should be denied
+	assert.Equal(t, 0.0, result.Remaining)
+	assert.Equal(t, float64(sc.Limit), result.Limit)
+	assert.Equal(t, 12*time.Second, result.RetryAfter) // 5 * weight must fade to 4: 2s into the next window
+	assert.Equal(t, testEpoch.Add(20*time.Second), result.ResetAt)
+	assert.Equal(t, AlgorithmSlidingWindowCounter, result.Algorithm)
+}
+
+// TestSlidingWindowCounter_Reset tests resetting both counters
+func TestSlidingWindowCounter_Reset(t *testing.T) {
+	mock := setupMockRedis()
+	sc := NewSlidingWindowCounter(5, time.Minute)
+
+	key := "reset_counter_test"
+
+	mock.ExpectDel("counter:{" + key + "}").SetVal(1)
+
+	err := sc.Reset(ctx, key)
+	assert.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSlidingWindowCounter_GetStatus_CurrentWindow tests status when only the current window has requests
+func TestSlidingWindowCounter_GetStatus_CurrentWindow(t *testing.T) {
+	mock := setupMockRedis()
+	sc := NewSlidingWindowCounter(10, time.Hour)
+
+	key := "status_counter_test"
+	now := time.Now().UnixMilli()
+	start := now - now%sc.Window.Milliseconds()
+
+	mock.ExpectHGetAll("counter:{" + key + "}").
+		SetVal(map[string]string{"window": strconv.FormatInt(start, 10), "curr": "4", "prev": "0"})
+
+	status, err := sc.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, key, status.Key)
+	assert.Equal(t, 4.0, status.Current)
+	assert.Equal(t, 10.0, status.Capacity)
+	assert.Equal(t, 6.0, status.Remaining)
+	assert.False(t, status.IsLimited)
+	assert.Equal(t, AlgorithmSlidingWindowCounter, status.Algorithm)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSlidingWindowCounter_GetStatus_RotatesPreviousWindow tests that a stored window from the
+// previous period becomes the weighted "prev" counter
+func TestSlidingWindowCounter_GetStatus_RotatesPreviousWindow(t *testing.T) {
+	mock := setupMockRedis()
+	sc := NewSlidingWindowCounter(10, time.Hour)
+
+	key := "rotate_counter_test"
+	window := sc.Window.Milliseconds()
+	now := time.Now().UnixMilli()
+	start := now - now%window
+
+	// 8 requests were counted in the previous window, none yet in the current one
+	mock.ExpectHGetAll("counter:{" + key + "}").
+		SetVal(map[string]string{"window": strconv.FormatInt(start-window, 10), "curr": "8", "prev": "3"})
+
+	status, err := sc.GetStatus(ctx, key)
+	assert.NoError(t, err)
+
+	weight := float64(window-(time.Now().UnixMilli()-start)) / float64(window)
+	assert.InDelta(t, 8*weight, status.Current, 0.01) // Previous "curr" is weighted, old "prev" dropped
+	assert.InDelta(t, 10-8*weight, status.Remaining, 0.01)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSlidingWindowCounter_GetStatus_Expired tests that counters older than two windows are ignored
+func TestSlidingWindowCounter_GetStatus_Expired(t *testing.T) {
+	mock := setupMockRedis()
+	sc := NewSlidingWindowCounter(10, time.Hour)
+
+	key := "expired_counter_test"
+	window := sc.Window.Milliseconds()
+	now := time.Now().UnixMilli()
+	start := now - now%window
+
+	mock.ExpectHGetAll("counter:{" + key + "}").
+		SetVal(map[string]string{"window": strconv.FormatInt(start-2*window, 10), "curr": "10", "prev": "10"})
+
+	status, err := sc.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, status.Current)
+	assert.Equal(t, 10.0, status.Remaining)
+	assert.False(t, status.IsLimited)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSlidingWindowCounter_MemoryStorage(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch) // Start of a 10-second window
+	sc := NewSlidingWindowCounter(4, 10*time.Second, WithClock(clk), WithStorage(store))
+
+	key := "memory_counter_test"
+
+	result, err := sc.AllowN(ctx, key, 4)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	// Next window, a quarter in: the previous 4 still weigh 3
+	clk.Advance(12500 * time.Millisecond)
+	result, err = sc.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	status, err := sc.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 4.0, status.Current)
+	assert.True(t, status.IsLimited)
+
+	// Previous window must fade until 4 * weight <= 2: halfway through the window
+	result, err = sc.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 2500*time.Millisecond, result.RetryAfter)
+
+	clk.Advance(2500 * time.Millisecond)
+	result, err = sc.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	assert.NoError(t, sc.Reset(ctx, key))
+	status, err = sc.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, status.Current)
+}
@@ -0,0 +1,206 @@
+package limiter
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+// Pastikan SlidingWindowLog implement RateLimiter interface
+var _ RateLimiter = (*SlidingWindowLog)(nil)
+var _ KeyLister = (*SlidingWindowLog)(nil)
+
+// SlidingWindowLog implements the Sliding Window Log rate limiting algorithm.
+// Unlike the bucket algorithms, it guarantees exact rolling-window limits:
+// - Every allowed request stores its timestamp in a Redis sorted set
+// - Timestamps older than Window are dropped before each decision
+// - A request is allowed only if fewer than Limit timestamps remain
+// - Memory grows with Limit (one sorted set entry per request in the window)
+type SlidingWindowLog struct {
+	Limit     int64         // Maximum requests in any rolling window
+	Window    time.Duration // Rolling window length
+	Clock     Clock
+	Storage   storage.Storage
+	Namespace string
+}
+
+// NewSlidingWindowLog creates a new SlidingWindowLog instance
+// limit: maximum requests allowed in any rolling window
+// window: rolling window length
+// Panics if limit is below 1 or window is not a whole number of milliseconds (at least 1ms).
+func NewSlidingWindowLog(limit int64, window time.Duration, opts ...Option) *SlidingWindowLog {
+	if err := checkWindowConfig(Config{Capacity: float64(limit), Rate: window.Seconds()}, window); err != nil {
+		panic(err)
+	}
+	o := applyOptions(opts)
+	return &SlidingWindowLog{
+		Limit:     limit,
+		Window:    window,
+		Clock:     o.clock,
+		Storage:   o.storage,
+		Namespace: o.namespace,
+	}
+}
+
+// now returns the current time from Clock
+func (sl *SlidingWindowLog) now() time.Time {
+	return nowFrom(sl.Clock)
+}
+
+// store returns the state backend
+func (sl *SlidingWindowLog) store() storage.Storage {
+	return storeFrom(sl.Storage)
+}
+
+// logKey generates Redis key for the request log sorted set
+func (sl *SlidingWindowLog) logKey(key string) string {
+	return namespacedKey(sl.Namespace, "log:"+hashTag(key))
+}
+
+// KeyPattern returns the Redis key pattern of the logs and how to extract the client key (used by the dashboard)
+func (sl *SlidingWindowLog) KeyPattern() (string, func(string) string) {
+	prefix := namespacedKey(sl.Namespace, "log:{")
+	return prefix + "*}", clientKeyBetween(prefix, "}")
+}
+
+// slidingWindowLogScript trims, counts and appends to the request log atomically
+// KEYS[1] = log key (sorted set, score = request time in ms)
+// ARGV[1] = limit, ARGV[2] = window (ms), ARGV[3] = now (ms), ARGV[4] = unique member prefix for this request,
+// ARGV[5] = cost (one log entry per unit)
+// Returns: {allowed (0/1), remaining requests, retry after (ms), reset after (ms)} (numbers as strings)
+var slidingWindowLogScript = storage.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local cost = tonumber(ARGV[5])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+
+local count = redis.call('ZCARD', KEYS[1])
+if count + cost > limit then
+  if count == 0 then
+    -- Cost larger than the limit can never be allowed
+    return {0, tostring(limit), '0', '0'}
+  end
+
+  -- Retry once enough of the oldest entries have slid out of the window
+  local idx = math.min(count + cost - limit, count) - 1
+  local oldest = redis.call('ZRANGE', KEYS[1], idx, idx, 'WITHSCORES')
+  local newest = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+  local retry_after = tonumber(oldest[2]) + window - now
+  local reset_after = tonumber(newest[2]) + window - now
+  return {0, tostring(math.max(0, limit - count)), tostring(retry_after), tostring(reset_after)}
+end
+
+for i = 1, cost do
+  redis.call('ZADD', KEYS[1], now, ARGV[4] .. ':' .. i)
+end
+redis.call('PEXPIRE', KEYS[1], window)
+
+return {1, tostring(limit - count - cost), '0', tostring(window)}
+`).WithLocal(slidingWindowLogLocal)
+
+// slidingWindowLogLocal is the Go version of slidingWindowLogScript for storages without Lua
+func slidingWindowLogLocal(tx storage.Tx, keys []string, args []interface{}) ([]interface{}, error) {
+	limit := argFloat(args[0])
+	window := argFloat(args[1])
+	now := argFloat(args[2])
+	member := args[3].(string)
+	cost := argFloat(args[4])
+
+	tx.ZRemRangeByScore(keys[0], now-window)
+
+	scores := tx.ZScores(keys[0])
+	count := float64(len(scores))
+	if count+cost > limit {
+		if count == 0 {
+			return scriptReply(false, limit, 0, 0), nil
+		}
+		idx := int(math.Min(count+cost-limit, count)) - 1
+		return scriptReply(false, math.Max(0, limit-count), scores[idx]+window-now, scores[len(scores)-1]+window-now), nil
+	}
+
+	members := make(map[string]float64, int(cost))
+	for i := 1; i <= int(cost); i++ {
+		members[member+":"+strconv.Itoa(i)] = now
+	}
+	tx.ZAdd(keys[0], members, time.Duration(window)*time.Millisecond)
+
+	return scriptReply(true, limit-count-cost, 0, window), nil
+}
+
+// Allow checks whether the request fits in the rolling window and logs it if so.
+// Result.Remaining = requests left in window, Result.ResetAt = when the newest entry slides out
+func (sl *SlidingWindowLog) Allow(ctx context.Context, key string) (*Result, error) {
+	return sl.AllowN(ctx, key, 1)
+}
+
+// AllowN is like Allow but logs n entries at once (all or nothing).
+// A cost above Limit can never fit and returns ErrCostExceedsLimit.
+func (sl *SlidingWindowLog) AllowN(ctx context.Context, key string, n int64) (*Result, error) {
+	if n < 1 {
+		return nil, ErrInvalidCost
+	}
+	if n > sl.Limit {
+		return nil, ErrCostExceedsLimit
+	}
+
+	now := sl.now()
+	nowMs := now.UnixMilli()
+
+	// Member must be unique so requests in the same millisecond are all counted
+	member := strconv.FormatInt(nowMs, 10) + "-" + strconv.FormatUint(rand.Uint64(), 36)
+
+	res, err := sl.store().Eval(ctx, slidingWindowLogScript,
+		[]string{sl.logKey(key)}, sl.Limit, sl.Window.Milliseconds(), nowMs, member, n)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := parseScriptResult(res, now)
+	if err != nil {
+		return nil, err
+	}
+	result.Limit = float64(sl.Limit)
+	result.Window = sl.Window
+	result.Algorithm = AlgorithmSlidingWindowLog
+	return result, nil
+}
+
+// Reset clears the request log for a specific key
+func (sl *SlidingWindowLog) Reset(ctx context.Context, key string) error {
+	return sl.store().Del(ctx, sl.logKey(key))
+}
+
+// GetStatus counts the requests logged in the current rolling window for a key
+func (sl *SlidingWindowLog) GetStatus(ctx context.Context, key string) (*Status, error) {
+	now := sl.now().UnixMilli()
+	windowStart := now - sl.Window.Milliseconds()
+
+	// Count only entries inside (now - window, +inf]; expired entries are trimmed by Allow
+	count, err := sl.store().ZCount(ctx, sl.logKey(key), float64(windowStart))
+	if err != nil {
+		return nil, err
+	}
+
+	limit := float64(sl.Limit)
+	current := float64(count)
+	remaining := limit - current
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return &Status{
+		Key:       key,
+		Current:   current,                     // Requests in current rolling window
+		Capacity:  limit,                       // Maximum requests per window
+		Remaining: remaining,                   // Requests left in rolling window
+		LeakRate:  limit / sl.Window.Seconds(), // Average allowed rate per second
+		IsLimited: current >= limit,            // Limited once window is full
+		Algorithm: AlgorithmSlidingWindowLog,
+	}, nil
+}
@@ -0,0 +1,195 @@
+package limiter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+// TestNewSlidingWindowLog verifies SlidingWindowLog constructor
+func TestNewSlidingWindowLog(t *testing.T) {
+	sl := NewSlidingWindowLog(60, time.Minute)
+
+	assert.Equal(t, int64(60), sl.Limit)    // Max requests per rolling window
+	assert.Equal(t, time.Minute, sl.Window) // Rolling window length
+}
+
+// TestNewSlidingWindowLog_RejectsInvalidParams verifies that a window without whole milliseconds or a zero limit is rejected
+func TestNewSlidingWindowLog_RejectsInvalidParams(t *testing.T) {
+	assert.Panics(t, func() { NewSlidingWindowLog(10, 0) })
+	assert.Panics(t, func() { NewSlidingWindowLog(10, 1500*time.Microsecond) })
+	assert.Panics(t, func() { NewSlidingWindowLog(0, time.Minute) })
+}
+
+// TestSlidingWindowLog_ImplementsInterface ensures SlidingWindowLog implements RateLimiter
+func TestSlidingWindowLog_ImplementsInterface(t *testing.T) {
+	var _ RateLimiter = (*SlidingWindowLog)(nil)
+}
+
+// TestSlidingWindowLog_Allow_FirstRequest tests first request with an empty log
+func TestSlidingWindowLog_Allow_FirstRequest(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	sl := NewSlidingWindowLog(5, time.Minute, WithClock(NewManualClock(testEpoch)), WithStorage(store))
+
+	// Log was empty - request is logged, 4 left
+	result, err := sl.Allow(ctx, "test_log_key")
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 4.0, result.Remaining)
+}
+
+// TestSlidingWindowLog_Allow_LimitReached tests denial when the rolling window is full
+func TestSlidingWindowLog_Allow_LimitReached(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	sl := NewSlidingWindowLog(5, time.Minute, WithClock(clk), WithStorage(store))
+
+	key := "test_log_full"
+
+	_, err := sl.AllowN(ctx, key, 2)
+	assert.NoError(t, err)
+	clk.Advance(20 * time.Second)
+	_, err = sl.AllowN(ctx, key, 3)
+	assert.NoError(t, err)
+	clk.Advance(10 * time.Second)
+
+	result, err := sl.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed) // Should be denied
+	assert.Equal(t, 0.0, result.Remaining)
+	assert.Equal(t, float64(sl.Limit), result.Limit)
+	assert.Equal(t, 30*time.Second, result.RetryAfter)             // Oldest entries leave the window
+	assert.Equal(t, testEpoch.Add(80*time.Second), result.ResetAt) // Newest entries leave the window
+	assert.Equal(t, AlgorithmSlidingWindowLog, result.Algorithm)
+}
+
+// TestSlidingWindowLog_Allow_RedisError tests that script errors are returned
+func TestSlidingWindowLog_Allow_RedisError(t *testing.T) {
+	mock := setupMockRedis()
+	sl := NewSlidingWindowLog(5, time.Minute)
+
+	key := "test_log_error"
+
+	expectScript(mock, sl, key, 1).SetErr(fmt.Errorf("connection refused"))
+
+	result, err := sl.Allow(ctx, key)
+	assert.Error(t, err)
+	assert.Nil(t, result)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSlidingWindowLog_Reset tests resetting the request log
+func TestSlidingWindowLog_Reset(t *testing.T) {
+	mock := setupMockRedis()
+	sl := NewSlidingWindowLog(5, time.Minute)
+
+	key := "reset_log_test"
+
+	mock.ExpectDel("log:{" + key + "}").SetVal(1)
+
+	err := sl.Reset(ctx, key)
+	assert.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSlidingWindowLog_GetStatus tests counting requests in the rolling window
+func TestSlidingWindowLog_GetStatus(t *testing.T) {
+	mock := setupMockRedis()
+	sl := NewSlidingWindowLog(10, 10*time.Second)
+
+	key := "status_log_test"
+
+	mock.Regexp().ExpectZCount("log:{"+key+"}", `^\(\d+$`, `^\+inf$`).SetVal(4)
+
+	status, err := sl.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, key, status.Key)
+	assert.Equal(t, 4.0, status.Current)   // 4 requests in window
+	assert.Equal(t, 10.0, status.Capacity) // Limit per window
+	assert.Equal(t, 6.0, status.Remaining) // 10 - 4 = 6
+	assert.False(t, status.IsLimited)
+	assert.Equal(t, AlgorithmSlidingWindowLog, status.Algorithm)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSlidingWindowLog_GetStatus_Limited tests status when the rolling window is full
+func TestSlidingWindowLog_GetStatus_Limited(t *testing.T) {
+	mock := setupMockRedis()
+	sl := NewSlidingWindowLog(5, time.Minute)
+
+	key := "limited_log_test"
+
+	mock.Regexp().ExpectZCount("log:{"+key+"}", `^\(\d+$`, `^\+inf$`).SetVal(5)
+
+	status, err := sl.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, status.Remaining)
+	assert.True(t, status.IsLimited)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSlidingWindowLog_MemoryStorage(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	sl := NewSlidingWindowLog(2, 10*time.Second, WithClock(clk), WithStorage(store))
+
+	key := "memory_log_test"
+
+	result, err := sl.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	clk.Advance(4 * time.Second)
+	result, err = sl.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	// The first entry slides out 10 seconds after it was logged
+	clk.Advance(time.Second)
+	result, err = sl.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 5*time.Second, result.RetryAfter)
+	assert.Equal(t, 9*time.Second, result.ResetAt.Sub(clk.Now()))
+
+	status, err := sl.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, status.Current)
+
+	clk.Advance(5 * time.Second)
+	result, err = sl.Allow(ctx, key)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0.0, result.Remaining)
+
+	assert.NoError(t, sl.Reset(ctx, key))
+	status, err = sl.GetStatus(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, status.Current)
+}
+
+// TestSlidingWindowLog_AllowN_CostExceedsLimit tests that a cost above the limit is an error, not a retryable denial
+func TestSlidingWindowLog_AllowN_CostExceedsLimit(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	sl := NewSlidingWindowLog(5, 10*time.Second, WithStorage(store))
+
+	result, err := sl.AllowN(ctx, "log_cost_test", 6)
+	assert.ErrorIs(t, err, ErrCostExceedsLimit)
+	assert.ErrorIs(t, err, ErrInvalidCost)
+	assert.Nil(t, result)
+
+	// The whole limit at once still fits
+	result, err = sl.AllowN(ctx, "log_cost_test", 5)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+}
@@ -3,183 +3,325 @@ package limiter
 import (
 	"context"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/redis/go-redis/v9"
 	"github.com/user/Rate-Limiting-API/internal/storage"
 )
 
-// Pastikan TokenBucket implement RateLimiter interface
-var _ RateLimiter = (*TokenBucket)(nil)
+// Pastikan TokenBucket implement RateLimiter dan Waiter interface
+var (
+	_ RateLimiter = (*TokenBucket)(nil)
+	_ Waiter      = (*TokenBucket)(nil)
+)
 
 // TokenBucket implements the Token Bucket rate limiting algorithm.
 // Unlike Leaky Bucket which drains at a constant rate, Token Bucket:
 // - Refills tokens at a constant rate
-// - Each request consumes 1 token
+// - Each request consumes 1 token (n tokens with AllowN)
 // - If no tokens available, request is denied
 // - Allows bursts up to bucket capacity
 type TokenBucket struct {
 	Capacity   float64
 	RefillRate float64
 	TTL        time.Duration
+	Clock      Clock
+	Storage    storage.Storage
+	Namespace  string
+
+	// LeaseSize > 0 enables token leasing: each call to Redis claims up to LeaseSize tokens,
+	// which this instance then serves locally for up to LeaseTTL without further round trips.
+	// Unspent tokens go back to Redis on the next claim or via ReturnExpiredLeases
+	// (run every LeaseTTL by NewLeasingTokenBucket until Close).
+	// Trade-off: up to LeaseSize tokens per key per instance may be spent after they were
+	// claimed (overshoot bound per window), and Remaining is this instance's view only.
+	LeaseSize int64
+	LeaseTTL  time.Duration
+
+	leases   sync.Map      // key -> *tokenLease
+	leaseGen atomic.Uint64 // Bumped by setConfig; leases claimed under an older generation stop serving
+	stop     chan struct{}
+	once     sync.Once
+
+	// paramsMu guards the fields the lease janitor reads outside the manager's lock
+	// (Capacity, RefillRate, TTL, Clock, Namespace and changedAt) against setConfig and the manager
+	paramsMu sync.RWMutex
+
+	changedAt int64 // Unix ms of the last config change (0 = never); see setConfig
 }
 
 // NewTokenBucket creates a new TokenBucket instance
 // capacity: maximum tokens bucket can hold
 // refillRate: tokens added per second
 // ttl: time-to-live for Redis keys
-func NewTokenBucket(capacity, refillRate float64, ttl time.Duration) *TokenBucket {
+// Panics if capacity or refillRate is not positive, or ttl is negative.
+func NewTokenBucket(capacity, refillRate float64, ttl time.Duration, opts ...Option) *TokenBucket {
+	if err := checkBucketConfig(Config{Capacity: capacity, Rate: refillRate, TTL: ttl}); err != nil {
+		panic(err)
+	}
+	o := applyOptions(opts)
 	return &TokenBucket{
 		Capacity:   capacity,
 		RefillRate: refillRate,
 		TTL:        ttl,
+		Clock:      o.clock,
+		Storage:    o.storage,
+		Namespace:  o.namespace,
 	}
 }
 
-// tokensKey generates Redis key for token count
-func (tb *TokenBucket) tokensKey(key string) string {
-	return "token:" + key + ":tokens"
+// now returns the current time from Clock
+func (tb *TokenBucket) now() time.Time {
+	return nowFrom(tb.Clock)
 }
 
-// timeKey generates Redis key for last refill timestamp
-func (tb *TokenBucket) timeKey(key string) string {
-	return "token:" + key + ":time"
+// store returns the state backend
+func (tb *TokenBucket) store() storage.Storage {
+	return storeFrom(tb.Storage)
 }
 
-func (tb *TokenBucket) Allow(ctx context.Context, key string) (bool, float64, error) {
-	tokensKey := tb.tokensKey(key) // Redis key for token storage
-	timeKey := tb.timeKey(key)     // Redis key for last refill time
+// bucketKey generates the Redis key for a client; state is a HASH with tokens, time, capacity and rate fields
+func (tb *TokenBucket) bucketKey(key string) string {
+	return tokenBucketKey(tb.Namespace, key)
+}
 
-	now := time.Now().Unix() // Current Unix timestamp
+// tokenBucketKey is bucketKey for a given namespace
+func tokenBucketKey(namespace, key string) string {
+	return namespacedKey(namespace, "token:"+hashTag(key))
+}
 
-	// Retrieve current token count from Redis
-	tokensVal, err := storage.RedisClient.Get(ctx, tokensKey).Result()
-	var tokens float64
-	if err == redis.Nil {
-		// Key doesn't exist - start with full bucket
-		tokens = tb.Capacity
-	} else if err != nil {
-		// Redis error - return failure
-		return false, 0, err
-	} else {
-		// Parse existing token count
-		tokens, _ = strconv.ParseFloat(tokensVal, 64)
-	}
+// KeyPattern returns the Redis key pattern of the buckets and how to extract the client key (used by the dashboard)
+func (tb *TokenBucket) KeyPattern() (string, func(string) string) {
+	prefix := namespacedKey(tb.Namespace, "token:{")
+	return prefix + "*}", clientKeyBetween(prefix, "}")
+}
 
-	// Retrieve last refill timestamp from Redis
-	timeVal, err := storage.RedisClient.Get(ctx, timeKey).Result()
-	var lastTime int64
-	if err == redis.Nil {
-		// Key doesn't exist - use current time
-		lastTime = now
-	} else if err != nil {
-		// Redis error - return failure
-		return false, 0, err
-	} else {
-		// Parse existing timestamp
-		lastTime, _ = strconv.ParseInt(timeVal, 10, 64)
+// tokenBucketScript performs the Token Bucket read-compute-write atomically in Redis
+// KEYS[1] = bucket key (HASH with tokens and time, plus the capacity and rate it was written with)
+// ARGV[1] = capacity, ARGV[2] = refill rate, ARGV[3] = now (unix ms), ARGV[4] = TTL (ms, 0 = no expiry),
+// ARGV[5] = cost, ARGV[6] = last config change (unix ms, 0 = never)
+// Returns: {allowed (0/1), remaining tokens, retry after (ms), reset after (ms)} (numbers as strings)
+var tokenBucketScript = storage.NewScript(`
+local capacity = tonumber(ARGV[1])
+local refill_rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+local cost = tonumber(ARGV[5])
+local changed_at = tonumber(ARGV[6])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'time', 'capacity', 'rate')
+local tokens = tonumber(state[1]) or capacity
+local last = tonumber(state[2]) or now
+local stored_capacity = tonumber(state[3]) or capacity
+local stored_rate = tonumber(state[4]) or refill_rate
+
+if last < 1e11 then
+  last = last * 1000 -- Legacy timestamp written in seconds before the upgrade
+end
+
+-- Same steps as refill in config.go
+local split = math.min(now, math.max(last, changed_at))
+tokens = math.min(stored_capacity, tokens + math.max(0, split - last) / 1000 * stored_rate)
+if stored_capacity ~= capacity then
+  tokens = math.max(0, math.min(capacity, tokens + capacity - stored_capacity))
+end
+tokens = math.min(capacity, tokens + math.max(0, now - split) / 1000 * refill_rate)
+
+if tokens < cost then
+  local retry_after = (cost - tokens) / refill_rate * 1000
+  return {0, tostring(tokens), tostring(retry_after), tostring((capacity - tokens) / refill_rate * 1000)}
+end
+
+tokens = tokens - cost
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'time', tostring(now), 'capacity', ARGV[1], 'rate', ARGV[2])
+if ttl > 0 then
+  redis.call('PEXPIRE', KEYS[1], ttl)
+else
+  redis.call('PERSIST', KEYS[1])
+end
+
+return {1, tostring(tokens), '0', tostring((capacity - tokens) / refill_rate * 1000)}
+`).WithLocal(tokenBucketLocal)
+
+// tokenBucketLocal is the Go version of tokenBucketScript for storages without Lua (MemoryStorage).
+// It takes the same keys and args and returns the same reply format.
+func tokenBucketLocal(tx storage.Tx, keys []string, args []interface{}) ([]interface{}, error) {
+	capacity := argFloat(args[0])
+	refillRate := argFloat(args[1])
+	now := argFloat(args[2])
+	ttl := time.Duration(argFloat(args[3])) * time.Millisecond
+	cost := argFloat(args[4])
+	changedAt := argFloat(args[5])
+
+	tokens := readTokens(tx, keys[0], now, changedAt, capacity, refillRate)
+
+	if tokens < cost {
+		retryAfter := (cost - tokens) / refillRate * 1000
+		return scriptReply(false, tokens, retryAfter, (capacity-tokens)/refillRate*1000), nil
 	}
 
-	// Calculate tokens to add based on elapsed time
-	elapsed := float64(now - lastTime)     // Seconds since last refill
-	tokensToAdd := elapsed * tb.RefillRate // Tokens earned in that time
-	tokens = tokens + tokensToAdd          // Add refilled tokens
-	if tokens > tb.Capacity {              // Cap at maximum capacity
-		tokens = tb.Capacity
+	tokens -= cost
+	writeTokens(tx, keys[0], tokens, now, capacity, refillRate, ttl)
+
+	return scriptReply(true, tokens, 0, (capacity-tokens)/refillRate*1000), nil
+}
+
+// readTokens returns the refilled tokens of a bucket hash for the Go script versions
+func readTokens(tx storage.Tx, key string, now, changedAt, capacity, rate float64) float64 {
+	tokens := capacity // Missing key = full bucket
+	if val, ok := tx.HGet(key, "tokens"); ok {
+		if parsed, err := strconv.ParseFloat(val, 64); err == nil {
+			tokens = parsed
+		}
+	}
+	last := now
+	if val, ok := tx.HGet(key, "time"); ok {
+		if ts, err := parseTimestampMs(val); err == nil {
+			last = ts
+		}
 	}
+	storedCapacity, storedRate := capacity, rate
+	if val, ok := tx.HGet(key, "capacity"); ok {
+		if parsed, err := strconv.ParseFloat(val, 64); err == nil {
+			storedCapacity = parsed
+		}
+	}
+	if val, ok := tx.HGet(key, "rate"); ok {
+		if parsed, err := strconv.ParseFloat(val, 64); err == nil {
+			storedRate = parsed
+		}
+	}
+	return refill(tokens, last, now, changedAt, storedCapacity, storedRate, capacity, rate)
+}
 
-	// Check if we have tokens available
-	if tokens < 1 {
-		// No tokens available - deny request
-		return false, 0, nil
+// writeTokens stores a bucket hash together with the parameters it was computed with
+func writeTokens(tx storage.Tx, key string, tokens, now, capacity, rate float64, ttl time.Duration) {
+	tx.HSet(key, map[string]string{
+		"tokens":   formatNumber(tokens),
+		"time":     formatNumber(now),
+		"capacity": formatNumber(capacity),
+		"rate":     formatNumber(rate),
+	}, ttl)
+}
+
+// Allow checks whether a request is allowed and consumes a token if so.
+// The refill, check and consume steps run as a single Lua script (EVALSHA with
+// EVAL fallback), so concurrent API instances cannot both spend the same token.
+// Result.Remaining = tokens left, Result.ResetAt = when the bucket is full again
+func (tb *TokenBucket) Allow(ctx context.Context, key string) (*Result, error) {
+	return tb.AllowN(ctx, key, 1)
+}
+
+// AllowN is like Allow but consumes n tokens at once.
+// The request is denied without consuming anything if fewer than n tokens are available.
+// A cost above Capacity can never fit and returns ErrCostExceedsLimit.
+func (tb *TokenBucket) AllowN(ctx context.Context, key string, n int64) (*Result, error) {
+	if n < 1 {
+		return nil, ErrInvalidCost
+	}
+	if float64(n) > tb.Capacity {
+		return nil, ErrCostExceedsLimit
+	}
+	if tb.LeaseSize > 0 {
+		return tb.allowLeased(ctx, key, n) // Serve from the local batch when possible
 	}
 
-	// Consume 1 token for this request
-	tokens = tokens - 1
+	keys := []string{tb.bucketKey(key)} // Single hash holding tokens and last refill time
+	now := tb.now()                     // Current time (script uses Unix milliseconds)
 
-	// Save updated token count to Redis with TTL
-	err = storage.RedisClient.Set(ctx, tokensKey, strconv.FormatFloat(tokens, 'f', -1, 64), tb.TTL).Err()
+	// Run refill + consume atomically on the Redis server
+	res, err := tb.store().Eval(ctx, tokenBucketScript, keys,
+		tb.Capacity, tb.RefillRate, now.UnixMilli(), tb.TTL.Milliseconds(), n, tb.changedAt)
 	if err != nil {
-		return false, 0, err
+		// Redis error - return failure
+		return nil, err
 	}
 
-	// Save current time as last refill time to Redis with TTL
-	err = storage.RedisClient.Set(ctx, timeKey, strconv.FormatInt(now, 10), tb.TTL).Err()
+	result, err := parseScriptResult(res, now)
 	if err != nil {
-		return false, 0, err
+		return nil, err
 	}
-
-	// Return success with remaining token count
-	return true, tokens, nil
+	result.Limit = tb.Capacity
+	result.Window = rateWindow(tb.Capacity, tb.RefillRate)
+	result.Algorithm = AlgorithmTokenBucket
+	return result, nil
 }
 
 // Reset clears all state for a specific key
 func (tb *TokenBucket) Reset(ctx context.Context, key string) error {
-	tokensKey := tb.tokensKey(key) // Redis key for token storage
-	timeKey := tb.timeKey(key)     // Redis key for last refill time
+	// Tokens leased by this instance are forgotten; other instances keep theirs until they expire
+	tb.dropLease(key)
+
+	// Token count and timestamp live in the same hash
+	return tb.store().Del(ctx, tb.bucketKey(key))
+}
+
+// Reserve returns how long until a token will be available for key (0 = now).
+// With leasing, tokens held by this instance's lease count as available.
+// It does not consume anything; use Wait to actually take the token.
+func (tb *TokenBucket) Reserve(ctx context.Context, key string) (time.Duration, error) {
+	leased, usable := tb.leasedTokens(key)
+	if usable && leased >= 1 {
+		return 0, nil // Served from the lease without a round trip
+	}
+
+	status, err := tb.GetStatus(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	// Bucket must refill until at least one whole token is available.
+	// An expired lease's tokens go back to the bucket on the next claim.
+	missing := 1 - status.Remaining - leased
+	if missing <= 0 {
+		return 0, nil
+	}
+	return time.Duration(missing / tb.RefillRate * float64(time.Second)), nil
+}
 
-	// Use pipeline to delete both keys atomically
-	pipe := storage.RedisClient.Pipeline()
-	pipe.Del(ctx, tokensKey) // Delete token count
-	pipe.Del(ctx, timeKey)   // Delete timestamp
-	_, err := pipe.Exec(ctx) // Execute pipeline
-	return err
+// Wait blocks until a token is consumed for key, the context is done, or the
+// next token would only arrive after the context deadline (ErrWaitExceedsDeadline).
+func (tb *TokenBucket) Wait(ctx context.Context, key string) error {
+	return waitFor(ctx, tb, key)
 }
 
 // GetStatus retrieves current rate limiter status for a key
 func (tb *TokenBucket) GetStatus(ctx context.Context, key string) (*Status, error) {
-	tokensKey := tb.tokensKey(key) // Redis key for token storage
-	timeKey := tb.timeKey(key)     // Redis key for last refill time
-
-	now := time.Now().Unix() // Current Unix timestamp
-
-	// Retrieve current token count from Redis
-	tokensVal, err := storage.RedisClient.Get(ctx, tokensKey).Result()
-	var tokens float64
-	var keyExists bool
-	if err == redis.Nil {
-		// Key doesn't exist - bucket is full
-		tokens = tb.Capacity
-		keyExists = false
-	} else if err != nil {
-		// Redis error - return failure
+	now := float64(tb.now().UnixMilli()) // Current Unix timestamp in milliseconds
+
+	// Retrieve token count and last refill timestamp (empty map when the key doesn't exist)
+	state, err := tb.store().HGetAll(ctx, tb.bucketKey(key))
+	if err != nil {
 		return nil, err
-	} else {
-		// Parse existing token count
-		tokens, _ = strconv.ParseFloat(tokensVal, 64)
-		keyExists = true
 	}
 
-	// Retrieve last refill timestamp from Redis
-	timeVal, err := storage.RedisClient.Get(ctx, timeKey).Result()
-	var lastTime int64
-	if err == redis.Nil {
-		// Key doesn't exist - use current time
-		lastTime = now
-	} else if err != nil {
-		// Redis error - return failure
-		return nil, err
-	} else {
-		// Parse existing timestamp
-		lastTime, _ = strconv.ParseInt(timeVal, 10, 64)
+	tokens := tb.Capacity // Missing key = full bucket
+	if tokensVal, ok := state["tokens"]; ok {
+		tokens, _ = strconv.ParseFloat(tokensVal, 64)
 	}
 
-	// Calculate tokens added since last refill
-	elapsed := float64(now - lastTime)     // Seconds since last refill
-	tokensToAdd := elapsed * tb.RefillRate // Tokens earned
-	tokens = tokens + tokensToAdd          // Add refilled tokens
-	if tokens > tb.Capacity {              // Cap at maximum capacity
-		tokens = tb.Capacity
+	lastTime := now // Missing key = no time elapsed
+	if timeVal, ok := state["time"]; ok {
+		// Legacy second values are converted to ms
+		lastTime, _ = parseTimestampMs(timeVal)
 	}
 
-	// IMPORTANT: Save the updated state to Redis to ensure consistency
-	// Only save if the key already exists (has been used before)
-	if keyExists && elapsed > 0 {
-		// Save updated token count
-		storage.RedisClient.Set(ctx, tokensKey, strconv.FormatFloat(tokens, 'f', -1, 64), tb.TTL)
-		// Save current time as last refill time
-		storage.RedisClient.Set(ctx, timeKey, strconv.FormatInt(now, 10), tb.TTL)
+	// Parameters the bucket was written with (keys from before they were stored use the current ones)
+	storedCapacity, storedRate := tb.Capacity, tb.RefillRate
+	if capacityVal, ok := state["capacity"]; ok {
+		storedCapacity, _ = strconv.ParseFloat(capacityVal, 64)
 	}
+	if rateVal, ok := state["rate"]; ok {
+		storedRate, _ = strconv.ParseFloat(rateVal, 64)
+	}
+
+	// Add tokens earned since last refill, at the old parameters until the last config change
+	tokens = refill(tokens, lastTime, now, float64(tb.changedAt), storedCapacity, storedRate, tb.Capacity, tb.RefillRate)
+
+	// State is only read here; refill is derived from the stored timestamp.
+	// Writing it back would race with the atomic update done by Allow.
 
 	// For Token Bucket, "current usage" = capacity - tokens (inverse of Leaky Bucket)
 	// This makes the UI consistent: higher usage = less remaining
@@ -191,11 +333,11 @@ func (tb *TokenBucket) GetStatus(ctx context.Context, key string) (*Status, erro
 	// Build and return status
 	return &Status{
 		Key:       key,
-		Current:   currentUsage,   // "Used" tokens (capacity - available)
-		Capacity:  tb.Capacity,    // Maximum bucket size
-		Remaining: tokens,         // Available tokens
-		LeakRate:  tb.RefillRate,  // Refill rate (reusing LeakRate field)
-		IsLimited: tokens < 1,     // Limited if no tokens available
-		Algorithm: "token_bucket", // Algorithm identifier
+		Current:   currentUsage,         // "Used" tokens (capacity - available)
+		Capacity:  tb.Capacity,          // Maximum bucket size
+		Remaining: tokens,               // Available tokens
+		LeakRate:  tb.RefillRate,        // Refill rate (reusing LeakRate field)
+		IsLimited: tokens < 1,           // Limited if no tokens available
+		Algorithm: AlgorithmTokenBucket, // Algorithm identifier
 	}, nil
 }
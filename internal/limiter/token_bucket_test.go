@@ -3,6 +3,8 @@ package limiter
 import (
 	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -29,6 +31,13 @@ func TestNewTokenBucket(t *testing.T) {
 	assert.Equal(t, time.Hour, tb.TTL)  // Redis TTL
 }
 
+// TestNewTokenBucket_RejectsInvalidParams verifies that a bucket that would divide by zero cannot be built
+func TestNewTokenBucket_RejectsInvalidParams(t *testing.T) {
+	assert.Panics(t, func() { NewTokenBucket(0, 2, time.Hour) })
+	assert.Panics(t, func() { NewTokenBucket(10, 0, time.Hour) })
+	assert.Panics(t, func() { NewLeasingTokenBucket(10, -1, time.Hour, 5, time.Second) })
+}
+
 // TestTokenBucket_ImplementsInterface ensures TokenBucket implements RateLimiter
 func TestTokenBucket_ImplementsInterface(t *testing.T) {
 	var _ RateLimiter = (*TokenBucket)(nil)
@@ -36,95 +45,258 @@ func TestTokenBucket_ImplementsInterface(t *testing.T) {
 
 // TestTokenBucket_Allow_FirstRequest tests first request with full bucket
 func TestTokenBucket_Allow_FirstRequest(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	tb := NewTokenBucket(5, 1, time.Hour, WithClock(NewManualClock(testEpoch)), WithStorage(store))
+
+	// First request - starts with a full bucket and consumes 1 token
+	result, err := tb.Allow(tokenCtx, "test_token_key")
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 4.0, result.Remaining) // 5 - 1 = 4 tokens
+}
+
+// TestTokenBucket_Allow_NoTokens tests denial when no tokens available
+func TestTokenBucket_Allow_NoTokens(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	tb := NewTokenBucket(5, 1, time.Hour, WithClock(NewManualClock(testEpoch)), WithStorage(store))
+
+	key := "test_token_no_tokens"
+
+	_, err := tb.AllowN(tokenCtx, key, 5) // Drain the bucket
+	assert.NoError(t, err)
+
+	result, err := tb.Allow(tokenCtx, key)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)        // Should be denied
+	assert.Equal(t, 0.0, result.Remaining) // No tokens
+	assert.Equal(t, tb.Capacity, result.Limit)
+	assert.Equal(t, time.Second, result.RetryAfter) // 1 token per second
+	assert.Equal(t, testEpoch.Add(5*time.Second), result.ResetAt)
+	assert.Equal(t, AlgorithmTokenBucket, result.Algorithm)
+}
+
+// TestTokenBucket_Allow_UsesClock tests that the script receives the injected clock's time
+func TestTokenBucket_Allow_UsesClock(t *testing.T) {
 	mock := setupTokenMockRedis()
-	tb := NewTokenBucket(5, 1, time.Hour)
+	clk := NewManualClock(testEpoch)
+	tb := NewTokenBucket(5, 2, time.Hour, WithClock(clk))
 
-	key := "test_token_key"
-	tokensKey := fmt.Sprintf("token:%s:tokens", key)
-	timeKey := fmt.Sprintf("token:%s:time", key)
+	key := "test_token_clock"
+	keys := []string{fmt.Sprintf("token:{%s}", key)}
 
-	// First request - keys don't exist, bucket starts full
-	mock.ExpectGet(tokensKey).RedisNil()
-	mock.ExpectGet(timeKey).RedisNil()
-	mock.ExpectSet(tokensKey, "4", time.Hour).SetVal("OK") // 5 - 1 = 4 tokens remaining
-	mock.Regexp().ExpectSet(timeKey, `\d+`, time.Hour).SetVal("OK")
+	// Bucket empty at t0; 500ms later (no sleep) one token has been refilled
+	mock.Regexp().ExpectEvalSha(tokenBucketScript.Hash(), keys,
+		tb.Capacity, tb.RefillRate, `^1700000000000$`, tb.TTL.Milliseconds(), int64(1), int64(0)).
+		SetVal([]interface{}{int64(0), "0", "500", "2500"})
+	mock.Regexp().ExpectEvalSha(tokenBucketScript.Hash(), keys,
+		tb.Capacity, tb.RefillRate, `^1700000000500$`, tb.TTL.Milliseconds(), int64(1), int64(0)).
+		SetVal([]interface{}{int64(1), "0", "0", "2500"})
 
-	allowed, remaining, err := tb.Allow(tokenCtx, key)
+	result, err := tb.Allow(tokenCtx, key)
 	assert.NoError(t, err)
-	assert.True(t, allowed)
-	assert.Equal(t, 4.0, remaining) // 5 - 1 = 4 tokens
+	assert.False(t, result.Allowed)
+	assert.Equal(t, testEpoch.Add(2500*time.Millisecond), result.ResetAt)
+	assert.Equal(t, 2500*time.Millisecond, result.ResetAfter) // Relative to the limiter clock, not time.Now
+
+	clk.Advance(result.RetryAfter)
+
+	result, err = tb.Allow(tokenCtx, key)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, testEpoch.Add(3*time.Second), result.ResetAt)
 
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-// TestTokenBucket_Allow_NoTokens tests denial when no tokens available
-func TestTokenBucket_Allow_NoTokens(t *testing.T) {
+// TestTokenBucket_GetStatus_WithStorage tests that an injected storage is used instead of the global client
+func TestTokenBucket_GetStatus_WithStorage(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	tb := NewTokenBucket(5, 1, time.Hour, WithStorage(storage.NewRedisStorage(db)))
+
+	key := "test_token_storage"
+
+	mock.ExpectHGetAll(fmt.Sprintf("token:{%s}", key)).SetVal(map[string]string{})
+
+	status, err := tb.GetStatus(tokenCtx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 5.0, status.Remaining) // Missing keys = full bucket
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestTokenBucket_MemoryStorage tests refill against the in-memory backend
+func TestTokenBucket_MemoryStorage(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	tb := NewTokenBucket(2, 2, time.Hour, WithClock(clk), WithStorage(store))
+
+	key := "test_token_memory"
+
+	result, err := tb.AllowN(tokenCtx, key, 2) // Drain the bucket
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	result, err = tb.Allow(tokenCtx, key)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+
+	clk.Advance(250 * time.Millisecond) // Half a token only
+
+	status, err := tb.GetStatus(tokenCtx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, status.Remaining)
+
+	clk.Advance(250 * time.Millisecond)
+
+	result, err = tb.Allow(tokenCtx, key)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+}
+
+// TestTokenBucket_MemoryStorage_Concurrent tests that concurrent callers cannot spend the same token
+func TestTokenBucket_MemoryStorage_Concurrent(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	tb := NewTokenBucket(50, 0.001, time.Hour, WithStorage(store))
+
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := tb.Allow(tokenCtx, "test_token_concurrent")
+			if err == nil && result.Allowed {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(50), allowed.Load())
+}
+
+// TestTokenBucket_Allow_NoTTL tests that a zero TTL is passed to the script as 0ms
+func TestTokenBucket_Allow_NoTTL(t *testing.T) {
 	mock := setupTokenMockRedis()
-	tb := NewTokenBucket(5, 1, time.Hour)
+	tb := &TokenBucket{Capacity: 5, RefillRate: 1} // No TTL
 
-	key := "test_token_no_tokens"
-	tokensKey := fmt.Sprintf("token:%s:tokens", key)
-	timeKey := fmt.Sprintf("token:%s:time", key)
-	now := fmt.Sprintf("%d", time.Now().Unix())
+	key := "test_token_no_ttl"
 
-	// Bucket is empty (0 tokens)
-	mock.ExpectGet(tokensKey).SetVal("0")
-	mock.ExpectGet(timeKey).SetVal(now)
+	expectScript(mock, tb, key, 1).SetVal([]interface{}{int64(1), "4", "0", "0"})
 
-	allowed, remaining, err := tb.Allow(tokenCtx, key)
+	result, err := tb.Allow(tokenCtx, key)
 	assert.NoError(t, err)
-	assert.False(t, allowed)        // Should be denied
-	assert.Equal(t, 0.0, remaining) // No tokens
+	assert.True(t, result.Allowed)
 
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-// TestTokenBucket_Allow_RefillOverTime tests token refill after time passes
-func TestTokenBucket_Allow_RefillOverTime(t *testing.T) {
+// TestTokenBucket_Allow_RedisError tests that script errors are returned
+func TestTokenBucket_Allow_RedisError(t *testing.T) {
 	mock := setupTokenMockRedis()
 	tb := NewTokenBucket(5, 1, time.Hour)
 
+	key := "test_token_error"
+
+	expectScript(mock, tb, key, 1).SetErr(fmt.Errorf("connection refused"))
+
+	result, err := tb.Allow(tokenCtx, key)
+	assert.Error(t, err)
+	assert.Nil(t, result)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestTokenBucket_GetStatus_RefillOverTime tests token refill after time passes
+func TestTokenBucket_GetStatus_RefillOverTime(t *testing.T) {
+	mock := setupTokenMockRedis()
+	clk := NewManualClock(testEpoch)
+	tb := NewTokenBucket(5, 1, time.Hour, WithClock(clk))
+
 	key := "test_token_refill"
-	tokensKey := fmt.Sprintf("token:%s:tokens", key)
-	timeKey := fmt.Sprintf("token:%s:time", key)
+	bucketKey := fmt.Sprintf("token:{%s}", key)
 
 	// Bucket was empty (0 tokens) but 3 seconds have passed, refilled 3 tokens
-	pastTime := fmt.Sprintf("%d", time.Now().Unix()-3)
+	pastTime := fmt.Sprintf("%d", clk.Now().UnixMilli()-3000)
 
-	mock.ExpectGet(tokensKey).SetVal("0")
-	mock.ExpectGet(timeKey).SetVal(pastTime)
-	mock.ExpectSet(tokensKey, "2", time.Hour).SetVal("OK") // 0 + 3 - 1 = 2 tokens
-	mock.Regexp().ExpectSet(timeKey, `\d+`, time.Hour).SetVal("OK")
+	mock.ExpectHGetAll(bucketKey).SetVal(map[string]string{"tokens": "0", "time": pastTime})
 
-	allowed, remaining, err := tb.Allow(tokenCtx, key)
+	status, err := tb.GetStatus(tokenCtx, key)
 	assert.NoError(t, err)
-	assert.True(t, allowed)
-	assert.Equal(t, 2.0, remaining) // 0 + 3 (refilled) - 1 (consumed) = 2
+	assert.Equal(t, 3.0, status.Remaining) // 0 + 3 (refilled) = 3
+	assert.Equal(t, 2.0, status.Current)   // 5 - 3 = 2 usage
 
+	// GetStatus must not write the refilled state back
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-// TestTokenBucket_Allow_CapAtMax tests that tokens don't exceed capacity
-func TestTokenBucket_Allow_CapAtMax(t *testing.T) {
+// TestTokenBucket_GetStatus_SubSecondRefill tests that tokens refill within the same second
+func TestTokenBucket_GetStatus_SubSecondRefill(t *testing.T) {
 	mock := setupTokenMockRedis()
-	tb := NewTokenBucket(5, 1, time.Hour)
+	clk := NewManualClock(testEpoch)
+	tb := NewTokenBucket(10, 2, time.Hour, WithClock(clk))
+
+	key := "test_token_subsecond"
+	bucketKey := fmt.Sprintf("token:{%s}", key)
+
+	// Empty bucket, 500ms ago - at 2 tokens/sec one token is back already
+	// (with second-resolution timestamps a burst inside one second refilled nothing)
+	pastTime := fmt.Sprintf("%d", clk.Now().UnixMilli()-500)
+
+	mock.ExpectHGetAll(bucketKey).SetVal(map[string]string{"tokens": "0", "time": pastTime})
+
+	status, err := tb.GetStatus(tokenCtx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, status.Remaining)
+	assert.Equal(t, 9.0, status.Current)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestTokenBucket_GetStatus_LegacySecondsTimestamp tests reading a time key written before the ms upgrade
+func TestTokenBucket_GetStatus_LegacySecondsTimestamp(t *testing.T) {
+	mock := setupTokenMockRedis()
+	clk := NewManualClock(testEpoch)
+	tb := NewTokenBucket(5, 1, time.Hour, WithClock(clk))
+
+	key := "test_token_legacy"
+	bucketKey := fmt.Sprintf("token:{%s}", key)
+
+	// Unix seconds from 2 seconds ago; misreading it as ms (1970) would refill the bucket completely
+	legacyTime := fmt.Sprintf("%d", clk.Now().Unix()-2)
+
+	mock.ExpectHGetAll(bucketKey).SetVal(map[string]string{"tokens": "0", "time": legacyTime})
+
+	status, err := tb.GetStatus(tokenCtx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, status.Remaining) // 0 + 2 seconds * 1
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestTokenBucket_GetStatus_CapAtMax tests that tokens don't exceed capacity
+func TestTokenBucket_GetStatus_CapAtMax(t *testing.T) {
+	mock := setupTokenMockRedis()
+	clk := NewManualClock(testEpoch)
+	tb := NewTokenBucket(5, 1, time.Hour, WithClock(clk))
 
 	key := "test_token_cap"
-	tokensKey := fmt.Sprintf("token:%s:tokens", key)
-	timeKey := fmt.Sprintf("token:%s:time", key)
+	bucketKey := fmt.Sprintf("token:{%s}", key)
 
 	// Bucket had 4 tokens, 10 seconds passed (would add 10, but caps at 5)
-	pastTime := fmt.Sprintf("%d", time.Now().Unix()-10)
+	pastTime := fmt.Sprintf("%d", clk.Now().UnixMilli()-10000)
 
-	mock.ExpectGet(tokensKey).SetVal("4")
-	mock.ExpectGet(timeKey).SetVal(pastTime)
-	mock.ExpectSet(tokensKey, "4", time.Hour).SetVal("OK") // capped at 5, then -1 = 4
-	mock.Regexp().ExpectSet(timeKey, `\d+`, time.Hour).SetVal("OK")
+	mock.ExpectHGetAll(bucketKey).SetVal(map[string]string{"tokens": "4", "time": pastTime})
 
-	allowed, remaining, err := tb.Allow(tokenCtx, key)
+	status, err := tb.GetStatus(tokenCtx, key)
 	assert.NoError(t, err)
-	assert.True(t, allowed)
-	assert.Equal(t, 4.0, remaining) // min(4+10, 5) - 1 = 4
+	assert.Equal(t, 5.0, status.Remaining) // min(4+10, 5) = 5
+	assert.Equal(t, 0.0, status.Current)
 
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -135,11 +307,9 @@ func TestTokenBucket_Reset(t *testing.T) {
 	tb := NewTokenBucket(5, 1, time.Hour)
 
 	key := "reset_token_test"
-	tokensKey := fmt.Sprintf("token:%s:tokens", key)
-	timeKey := fmt.Sprintf("token:%s:time", key)
+	bucketKey := fmt.Sprintf("token:{%s}", key)
 
-	mock.ExpectDel(tokensKey).SetVal(1)
-	mock.ExpectDel(timeKey).SetVal(1)
+	mock.ExpectDel(bucketKey).SetVal(1)
 
 	err := tb.Reset(tokenCtx, key)
 	assert.NoError(t, err)
@@ -148,17 +318,27 @@ func TestTokenBucket_Reset(t *testing.T) {
 }
 
 // TestTokenBucket_GetStatus tests retrieving current status
+func TestTokenBucket_Reset_WithNamespace(t *testing.T) {
+	mock := setupTokenMockRedis()
+	tb := NewTokenBucket(10, 1, time.Hour, WithNamespace("billing"))
+
+	// Only the key inside the namespace is touched
+	mock.ExpectDel("billing:token:{api-key}").SetVal(1)
+
+	assert.NoError(t, tb.Reset(tokenCtx, "api-key"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestTokenBucket_GetStatus(t *testing.T) {
 	mock := setupTokenMockRedis()
-	tb := NewTokenBucket(10, 2, time.Hour)
+	clk := NewManualClock(testEpoch)
+	tb := NewTokenBucket(10, 2, time.Hour, WithClock(clk))
 
 	key := "status_token_test"
-	tokensKey := fmt.Sprintf("token:%s:tokens", key)
-	timeKey := fmt.Sprintf("token:%s:time", key)
-	now := fmt.Sprintf("%d", time.Now().Unix())
+	bucketKey := fmt.Sprintf("token:{%s}", key)
+	now := fmt.Sprintf("%d", clk.Now().UnixMilli())
 
-	mock.ExpectGet(tokensKey).SetVal("7")
-	mock.ExpectGet(timeKey).SetVal(now)
+	mock.ExpectHGetAll(bucketKey).SetVal(map[string]string{"tokens": "7", "time": now})
 
 	status, err := tb.GetStatus(tokenCtx, key)
 	assert.NoError(t, err)
@@ -176,15 +356,14 @@ func TestTokenBucket_GetStatus(t *testing.T) {
 // TestTokenBucket_GetStatus_Limited tests status when bucket is empty
 func TestTokenBucket_GetStatus_Limited(t *testing.T) {
 	mock := setupTokenMockRedis()
-	tb := NewTokenBucket(5, 1, time.Hour)
+	clk := NewManualClock(testEpoch)
+	tb := NewTokenBucket(5, 1, time.Hour, WithClock(clk))
 
 	key := "limited_token_test"
-	tokensKey := fmt.Sprintf("token:%s:tokens", key)
-	timeKey := fmt.Sprintf("token:%s:time", key)
-	now := fmt.Sprintf("%d", time.Now().Unix())
+	bucketKey := fmt.Sprintf("token:{%s}", key)
+	now := fmt.Sprintf("%d", clk.Now().UnixMilli())
 
-	mock.ExpectGet(tokensKey).SetVal("0")
-	mock.ExpectGet(timeKey).SetVal(now)
+	mock.ExpectHGetAll(bucketKey).SetVal(map[string]string{"tokens": "0", "time": now})
 
 	status, err := tb.GetStatus(tokenCtx, key)
 	assert.NoError(t, err)
@@ -194,3 +373,120 @@ func TestTokenBucket_GetStatus_Limited(t *testing.T) {
 
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+// TestTokenBucket_AllowN_Batch tests consuming several tokens in one call
+func TestTokenBucket_AllowN_Batch(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	tb := NewTokenBucket(10, 1, time.Hour, WithClock(NewManualClock(testEpoch)), WithStorage(store))
+
+	// Batch of 4 from a full bucket - 6 tokens left
+	result, err := tb.AllowN(tokenCtx, "test_token_batch", 4)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 6.0, result.Remaining)
+}
+
+// TestTokenBucket_AllowN_NotEnoughTokens tests that a batch larger than the balance is denied as a whole
+func TestTokenBucket_AllowN_NotEnoughTokens(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	tb := NewTokenBucket(10, 1, time.Hour, WithClock(NewManualClock(testEpoch)), WithStorage(store))
+
+	key := "test_token_batch_denied"
+
+	_, err := tb.AllowN(tokenCtx, key, 7)
+	assert.NoError(t, err)
+
+	// Only 3 tokens left - nothing is consumed, balance is reported
+	result, err := tb.AllowN(tokenCtx, key, 5)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 3.0, result.Remaining)
+
+	status, err := tb.GetStatus(tokenCtx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 3.0, status.Remaining)
+}
+
+// TestTokenBucket_AllowN_InvalidCost tests that n < 1 is rejected without touching Redis
+func TestTokenBucket_AllowN_InvalidCost(t *testing.T) {
+	mock := setupMockRedis()
+	tb := NewTokenBucket(10, 1, time.Hour)
+
+	result, err := tb.AllowN(tokenCtx, "test_token_zero", 0)
+	assert.ErrorIs(t, err, ErrInvalidCost)
+	assert.Nil(t, result)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestTokenBucket_Reserve_Empty tests the wait time for the next whole token
+func TestTokenBucket_Reserve_Empty(t *testing.T) {
+	mock := setupTokenMockRedis()
+	clk := NewManualClock(testEpoch)
+	tb := NewTokenBucket(10, 2, time.Hour, WithClock(clk))
+
+	key := "reserve_empty_test"
+	now := fmt.Sprintf("%d", clk.Now().UnixMilli())
+
+	// Half a token left, refill 2/sec - next whole token in 250ms
+	mock.ExpectHGetAll(fmt.Sprintf("token:{%s}", key)).SetVal(map[string]string{"tokens": "0.5", "time": now})
+
+	wait, err := tb.Reserve(tokenCtx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 250*time.Millisecond, wait)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestTokenBucket_Reserve_Available tests that no wait is needed when tokens are available
+func TestTokenBucket_Reserve_Available(t *testing.T) {
+	mock := setupTokenMockRedis()
+	clk := NewManualClock(testEpoch)
+	tb := NewTokenBucket(10, 2, time.Hour, WithClock(clk))
+
+	key := "reserve_available_test"
+	now := fmt.Sprintf("%d", clk.Now().UnixMilli())
+
+	mock.ExpectHGetAll(fmt.Sprintf("token:{%s}", key)).SetVal(map[string]string{"tokens": "3", "time": now})
+
+	wait, err := tb.Reserve(tokenCtx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), wait)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestTokenBucket_Wait_Allowed tests that Wait returns immediately when a token is available
+func TestTokenBucket_Wait_Allowed(t *testing.T) {
+	mock := setupTokenMockRedis()
+	tb := NewTokenBucket(10, 2, time.Hour)
+
+	key := "wait_allowed_test"
+
+	expectScript(mock, tb, key, 1).SetVal([]interface{}{int64(1), "9", "0", "500"})
+
+	err := tb.Wait(tokenCtx, key)
+	assert.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestTokenBucket_Wait_ExceedsDeadline tests that Wait gives up when the token arrives too late
+func TestTokenBucket_Wait_ExceedsDeadline(t *testing.T) {
+	mock := setupTokenMockRedis()
+	tb := NewTokenBucket(10, 0.1, time.Hour)
+
+	key := "wait_deadline_test"
+
+	expectScript(mock, tb, key, 1).SetVal([]interface{}{int64(0), "0", "10000", "100000"})
+
+	waitCtx, cancel := context.WithTimeout(tokenCtx, 100*time.Millisecond)
+	defer cancel()
+
+	err := tb.Wait(waitCtx, key)
+	assert.ErrorIs(t, err, ErrWaitExceedsDeadline)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
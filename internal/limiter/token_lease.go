@@ -0,0 +1,333 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+// tokenLease is a batch of tokens claimed from Redis and served locally by one instance
+type tokenLease struct {
+	mu        sync.Mutex
+	tokens    float64   // Claimed tokens not yet spent
+	remaining float64   // Tokens left in Redis when the batch was claimed
+	expiresAt time.Time // After this the tokens are returned instead of served
+	gen       uint64    // TokenBucket.leaseGen when claimed; an older lease is treated as expired
+	dead      bool      // Removed from TokenBucket.leases; callers must look up a fresh lease
+}
+
+// NewLeasingTokenBucket creates a TokenBucket that claims leaseSize tokens per Redis round trip
+// and serves them locally for up to leaseTTL (see TokenBucket.LeaseSize).
+// A background janitor returns expired leases every leaseTTL; call Close to stop it.
+func NewLeasingTokenBucket(capacity, refillRate float64, ttl time.Duration, leaseSize int64, leaseTTL time.Duration, opts ...Option) *TokenBucket {
+	tb := NewTokenBucket(capacity, refillRate, ttl, opts...)
+	tb.LeaseSize = leaseSize
+	tb.LeaseTTL = leaseTTL
+	if leaseTTL > 0 {
+		tb.stop = make(chan struct{})
+		go tb.leaseJanitor(leaseTTL)
+	}
+	return tb
+}
+
+// Close stops the lease janitor. It does not return the leases; call ReturnLeases first on shutdown.
+func (tb *TokenBucket) Close() {
+	tb.once.Do(func() {
+		if tb.stop != nil {
+			close(tb.stop)
+		}
+	})
+}
+
+// leaseJanitor returns expired leases every interval until Close is called.
+// Leases that fail to return are kept and retried on the next tick.
+func (tb *TokenBucket) leaseJanitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-tb.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			tb.ReturnExpiredLeases(ctx)
+			cancel()
+		}
+	}
+}
+
+// tokenLeaseScript refills the bucket, takes back returned tokens and claims a batch atomically in Redis
+// KEYS[1] = bucket key (same HASH as tokenBucketScript)
+// ARGV[1] = capacity, ARGV[2] = refill rate, ARGV[3] = now (unix ms), ARGV[4] = TTL (ms, 0 = no expiry),
+// ARGV[5] = minimum claim (request cost), ARGV[6] = maximum claim, ARGV[7] = tokens returned from an old lease,
+// ARGV[8] = last config change (unix ms, 0 = never)
+// Returns: {allowed (0/1), remaining tokens, retry after (ms), reset after (ms), granted tokens} (numbers as strings)
+var tokenLeaseScript = storage.NewScript(`
+local capacity = tonumber(ARGV[1])
+local refill_rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+local cost = tonumber(ARGV[5])
+local max_claim = tonumber(ARGV[6])
+local refund = tonumber(ARGV[7])
+local changed_at = tonumber(ARGV[8])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'time', 'capacity', 'rate')
+local tokens = tonumber(state[1]) or capacity
+local last = tonumber(state[2]) or now
+local stored_capacity = tonumber(state[3]) or capacity
+local stored_rate = tonumber(state[4]) or refill_rate
+
+if last < 1e11 then
+  last = last * 1000 -- Legacy timestamp written in seconds before the upgrade
+end
+
+-- Same steps as refill in config.go
+local split = math.min(now, math.max(last, changed_at))
+tokens = math.min(stored_capacity, tokens + math.max(0, split - last) / 1000 * stored_rate)
+if stored_capacity ~= capacity then
+  tokens = math.max(0, math.min(capacity, tokens + capacity - stored_capacity))
+end
+tokens = math.min(capacity, tokens + math.max(0, now - split) / 1000 * refill_rate + refund)
+
+local granted = math.min(max_claim, math.floor(tokens))
+local allowed = 1
+if granted < cost then
+  allowed = 0
+  granted = 0
+end
+
+-- Denials only write when returned tokens must be saved
+if allowed == 1 or refund > 0 then
+  tokens = tokens - granted
+  redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'time', tostring(now), 'capacity', ARGV[1], 'rate', ARGV[2])
+  if ttl > 0 then
+    redis.call('PEXPIRE', KEYS[1], ttl)
+  else
+    redis.call('PERSIST', KEYS[1])
+  end
+end
+
+local retry_after = 0
+if allowed == 0 then
+  retry_after = (cost - tokens) / refill_rate * 1000
+end
+return {allowed, tostring(tokens), tostring(retry_after), tostring((capacity - tokens) / refill_rate * 1000), tostring(granted)}
+`).WithLocal(tokenLeaseLocal)
+
+// tokenLeaseLocal is the Go version of tokenLeaseScript for storages without Lua (MemoryStorage).
+// It takes the same keys and args and returns the same reply format.
+func tokenLeaseLocal(tx storage.Tx, keys []string, args []interface{}) ([]interface{}, error) {
+	capacity := argFloat(args[0])
+	refillRate := argFloat(args[1])
+	now := argFloat(args[2])
+	ttl := time.Duration(argFloat(args[3])) * time.Millisecond
+	cost := argFloat(args[4])
+	maxClaim := argFloat(args[5])
+	refund := argFloat(args[6])
+	changedAt := argFloat(args[7])
+
+	tokens := math.Min(capacity, readTokens(tx, keys[0], now, changedAt, capacity, refillRate)+refund)
+
+	granted := math.Min(maxClaim, math.Floor(tokens))
+	allowed := granted >= cost
+	if !allowed {
+		granted = 0
+	}
+
+	// Denials only write when returned tokens must be saved
+	if allowed || refund > 0 {
+		tokens -= granted
+		writeTokens(tx, keys[0], tokens, now, capacity, refillRate, ttl)
+	}
+
+	retryAfter := 0.0
+	if !allowed {
+		retryAfter = (cost - tokens) / refillRate * 1000
+	}
+	return scriptReply(allowed, tokens, retryAfter, (capacity-tokens)/refillRate*1000, granted), nil
+}
+
+// leasedTokens reports the unspent tokens of key's local lease and whether the lease can still serve them
+func (tb *TokenBucket) leasedTokens(key string) (float64, bool) {
+	val, ok := tb.leases.Load(key)
+	if !ok {
+		return 0, false
+	}
+	lease := val.(*tokenLease)
+	lease.mu.Lock()
+	defer lease.mu.Unlock()
+	if lease.dead {
+		return 0, false
+	}
+	return lease.tokens, tb.leaseUsable(lease, tb.now())
+}
+
+// leaseUsable reports whether lease may still serve tokens: not expired and claimed under
+// the current parameters; the caller holds lease.mu
+func (tb *TokenBucket) leaseUsable(lease *tokenLease, now time.Time) bool {
+	return now.Before(lease.expiresAt) && lease.gen == tb.leaseGen.Load()
+}
+
+// lease returns the local lease for key, creating an empty one if needed
+func (tb *TokenBucket) lease(key string) *tokenLease {
+	val, _ := tb.leases.LoadOrStore(key, &tokenLease{})
+	return val.(*tokenLease)
+}
+
+// allowLeased serves n tokens from the local lease, claiming a new batch from Redis when
+// the lease is used up or expired. Leftover tokens of the old lease are returned in the same call.
+func (tb *TokenBucket) allowLeased(ctx context.Context, key string, n int64) (*Result, error) {
+	for {
+		lease := tb.lease(key)
+		lease.mu.Lock()
+		if lease.dead {
+			lease.mu.Unlock() // Removed by Reset/ReturnExpiredLeases while we waited
+			continue
+		}
+		result, err := tb.allowFromLease(ctx, key, lease, n)
+		lease.mu.Unlock()
+		return result, err
+	}
+}
+
+// allowFromLease does the work of allowLeased; the caller holds lease.mu
+func (tb *TokenBucket) allowFromLease(ctx context.Context, key string, lease *tokenLease, n int64) (*Result, error) {
+	now := tb.now()
+	cost := float64(n)
+
+	if tb.leaseUsable(lease, now) && lease.tokens >= cost {
+		lease.tokens -= cost
+		remaining := lease.remaining + lease.tokens
+		resetAfter := msToDuration((tb.Capacity - remaining) / tb.RefillRate * 1000)
+		return &Result{
+			Allowed:    true,
+			Limit:      tb.Capacity,
+			Remaining:  remaining,
+			ResetAt:    now.Add(resetAfter),
+			ResetAfter: resetAfter,
+			Window:     rateWindow(tb.Capacity, tb.RefillRate),
+			Algorithm:  AlgorithmTokenBucket,
+		}, nil
+	}
+
+	maxClaim := n
+	if tb.LeaseSize > maxClaim {
+		maxClaim = tb.LeaseSize
+	}
+	res, err := tb.store().Eval(ctx, tokenLeaseScript, []string{tb.bucketKey(key)},
+		tb.Capacity, tb.RefillRate, now.UnixMilli(), tb.TTL.Milliseconds(), n, maxClaim, lease.tokens, tb.changedAt)
+	if err != nil {
+		return nil, err // Lease is kept; its tokens are returned on the next successful claim
+	}
+
+	result, granted, err := parseLeaseResult(res, now)
+	if err != nil {
+		return nil, err
+	}
+	result.Limit = tb.Capacity
+	result.Window = rateWindow(tb.Capacity, tb.RefillRate)
+	result.Algorithm = AlgorithmTokenBucket
+
+	// Old tokens went back to Redis; keep whatever is left of the new batch
+	lease.tokens = 0
+	lease.expiresAt = time.Time{}
+	if result.Allowed {
+		lease.tokens = granted - cost
+		lease.remaining = result.Remaining
+		lease.expiresAt = now.Add(tb.LeaseTTL)
+		lease.gen = tb.leaseGen.Load()
+		result.Remaining += lease.tokens
+	}
+	return result, nil
+}
+
+// parseLeaseResult parses a tokenLeaseScript reply into a Result and the number of granted tokens
+func parseLeaseResult(res []interface{}, now time.Time) (*Result, float64, error) {
+	if len(res) != 5 {
+		return nil, 0, fmt.Errorf("unexpected script reply: %v", res)
+	}
+	result, err := parseScriptResult(res[:4], now)
+	if err != nil {
+		return nil, 0, err
+	}
+	str, ok := res[4].(string)
+	if !ok {
+		return nil, 0, fmt.Errorf("unexpected script reply: %v", res)
+	}
+	granted, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return nil, 0, err
+	}
+	return result, granted, nil
+}
+
+// ReturnExpiredLeases gives the unspent tokens of every expired lease back to Redis and forgets
+// the lease, so idle keys neither keep tokens claimed nor stay in memory.
+// NewLeasingTokenBucket already runs it every LeaseTTL.
+func (tb *TokenBucket) ReturnExpiredLeases(ctx context.Context) error {
+	return tb.returnLeases(ctx, false)
+}
+
+// ReturnLeases gives the unspent tokens of every lease back to Redis, expired or not.
+// Call it on shutdown so other instances can use the tokens this one still holds.
+func (tb *TokenBucket) ReturnLeases(ctx context.Context) error {
+	return tb.returnLeases(ctx, true)
+}
+
+// returnLeases returns expired leases (or all leases) to Redis; the first error is reported
+// and failed leases are kept for the next run
+func (tb *TokenBucket) returnLeases(ctx context.Context, all bool) error {
+	// The janitor runs outside the manager's lock, so read the parameters once under paramsMu
+	tb.paramsMu.RLock()
+	capacity, rate, ttl, changedAt := tb.Capacity, tb.RefillRate, tb.TTL, tb.changedAt
+	clock, namespace := tb.Clock, tb.Namespace
+	tb.paramsMu.RUnlock()
+
+	var firstErr error
+	tb.leases.Range(func(k, val interface{}) bool {
+		key := k.(string)
+		lease := val.(*tokenLease)
+
+		lease.mu.Lock()
+		defer lease.mu.Unlock()
+		now := nowFrom(clock)
+		if lease.dead || (!all && tb.leaseUsable(lease, now)) {
+			return true
+		}
+
+		if lease.tokens > 0 {
+			// Claim nothing, only return tokens
+			_, err := tb.store().Eval(ctx, tokenLeaseScript, []string{tokenBucketKey(namespace, key)},
+				capacity, rate, now.UnixMilli(), ttl.Milliseconds(), int64(0), int64(0), lease.tokens, changedAt)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return true // Keep the lease and retry on the next run
+			}
+		}
+
+		lease.dead = true
+		tb.leases.Delete(key)
+		return true
+	})
+	return firstErr
+}
+
+// dropLease forgets the local lease for key without returning its tokens
+func (tb *TokenBucket) dropLease(key string) {
+	val, ok := tb.leases.LoadAndDelete(key)
+	if !ok {
+		return
+	}
+	lease := val.(*tokenLease)
+	lease.mu.Lock()
+	lease.dead = true
+	lease.mu.Unlock()
+}
@@ -0,0 +1,235 @@
+package limiter
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/user/Rate-Limiting-API/internal/storage"
+)
+
+// storedTokens reads the token count kept in the storage (not counting local leases)
+func storedTokens(t *testing.T, store storage.Storage, tb *TokenBucket, key string) string {
+	state, err := store.HGetAll(tokenCtx, tb.bucketKey(key))
+	assert.NoError(t, err)
+	return state["tokens"]
+}
+
+func TestTokenBucket_Lease_ServesLocally(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	tb := NewLeasingTokenBucket(10, 1, time.Hour, 5, time.Second, WithClock(clk), WithStorage(store))
+	defer tb.Close()
+
+	key := "lease_local"
+
+	// First request claims a batch of 5, the next 4 never reach the storage
+	for i := 0; i < 5; i++ {
+		result, err := tb.Allow(tokenCtx, key)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, float64(9-i), result.Remaining)
+		assert.Equal(t, "5", storedTokens(t, store, tb, key))
+	}
+
+	// Batch used up - the 6th request claims the rest of the bucket
+	result, err := tb.Allow(tokenCtx, key)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, "0", storedTokens(t, store, tb, key))
+}
+
+func TestTokenBucket_Lease_PartialClaimAndDeny(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	tb := NewLeasingTokenBucket(3, 1, time.Hour, 5, time.Second, WithClock(clk), WithStorage(store))
+	defer tb.Close()
+
+	key := "lease_partial"
+
+	// Only 3 tokens exist, so the batch is smaller than LeaseSize
+	for i := 0; i < 3; i++ {
+		result, err := tb.Allow(tokenCtx, key)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+	}
+
+	result, err := tb.Allow(tokenCtx, key)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+}
+
+func TestTokenBucket_Lease_ExpiredTokensReturned(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	tb := NewLeasingTokenBucket(10, 1, time.Hour, 5, time.Second, WithClock(clk), WithStorage(store))
+	defer tb.Close()
+
+	key := "lease_expired"
+
+	for i := 0; i < 2; i++ {
+		_, err := tb.Allow(tokenCtx, key)
+		assert.NoError(t, err)
+	}
+
+	// Lease still valid - nothing is returned yet
+	assert.NoError(t, tb.ReturnExpiredLeases(tokenCtx))
+	assert.Equal(t, "5", storedTokens(t, store, tb, key))
+
+	// 5 left + 1 refilled + 3 unspent returned
+	clk.Advance(time.Second)
+	assert.NoError(t, tb.ReturnExpiredLeases(tokenCtx))
+	assert.Equal(t, "9", storedTokens(t, store, tb, key))
+
+	_, leased := tb.leases.Load(key)
+	assert.False(t, leased)
+}
+
+func TestTokenBucket_Lease_ReturnLeasesOnShutdown(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	tb := NewLeasingTokenBucket(10, 1, time.Hour, 5, time.Minute, WithClock(clk), WithStorage(store))
+	defer tb.Close()
+
+	_, err := tb.Allow(tokenCtx, "lease_shutdown")
+	assert.NoError(t, err)
+
+	assert.NoError(t, tb.ReturnLeases(tokenCtx))
+	assert.Equal(t, "9", storedTokens(t, store, tb, "lease_shutdown"))
+}
+
+func TestTokenBucket_Lease_InstancesShareBucket(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	a := NewLeasingTokenBucket(10, 1, time.Hour, 4, time.Second, WithClock(clk), WithStorage(store))
+	defer a.Close()
+	b := NewLeasingTokenBucket(10, 1, time.Hour, 4, time.Second, WithClock(clk), WithStorage(store))
+
+	// Tokens are taken out of the shared bucket, so together they never exceed capacity
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		for _, tb := range []*TokenBucket{a, b} {
+			result, err := tb.Allow(tokenCtx, "lease_shared")
+			assert.NoError(t, err)
+			if result.Allowed {
+				allowed++
+			}
+		}
+	}
+	assert.Equal(t, 10, allowed)
+}
+
+func TestTokenBucket_Lease_ScriptArgs(t *testing.T) {
+	mock := setupTokenMockRedis()
+	tb := NewLeasingTokenBucket(10, 1, time.Hour, 5, time.Second)
+	defer tb.Close()
+
+	key := "lease_redis"
+
+	// Claim at least 1, at most 5, nothing to return yet
+	mock.Regexp().ExpectEvalSha(tokenLeaseScript.Hash(), []string{fmt.Sprintf(`token:\{%s\}`, key)},
+		tb.Capacity, tb.RefillRate, `^\d{13}$`, tb.TTL.Milliseconds(), int64(1), int64(5), float64(0), int64(0)).
+		SetVal([]interface{}{int64(1), "5", "0", "5000", "5"})
+
+	result, err := tb.Allow(tokenCtx, key)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 9.0, result.Remaining) // 5 in Redis + 4 still leased
+
+	// Served from the lease without another round trip
+	result, err = tb.Allow(tokenCtx, key)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 8.0, result.Remaining)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTokenBucket_Lease_ResetDropsLease(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	tb := NewLeasingTokenBucket(4, 1, time.Hour, 4, time.Minute, WithStorage(store))
+	defer tb.Close()
+
+	key := "lease_reset"
+
+	_, err := tb.Allow(tokenCtx, key)
+	assert.NoError(t, err)
+	assert.NoError(t, tb.Reset(tokenCtx, key))
+
+	// Fresh bucket and fresh lease: 4 claimed, 1 spent
+	result, err := tb.Allow(tokenCtx, key)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 3.0, result.Remaining)
+}
+
+func TestTokenBucket_Lease_JanitorReturnsExpiredLeases(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	tb := NewLeasingTokenBucket(10, 1, time.Hour, 5, 10*time.Millisecond, WithStorage(store))
+	defer tb.Close()
+
+	_, err := tb.Allow(tokenCtx, "lease_janitor")
+	assert.NoError(t, err)
+
+	// The idle lease is returned and forgotten without anyone calling ReturnExpiredLeases
+	assert.Eventually(t, func() bool {
+		_, leased := tb.leases.Load("lease_janitor")
+		return !leased
+	}, time.Second, 5*time.Millisecond)
+	tokens, err := strconv.ParseFloat(storedTokens(t, store, tb, "lease_janitor"), 64)
+	assert.NoError(t, err)
+	assert.InDelta(t, 9, tokens, 0.5) // 5 left + 4 unspent returned (+ a little refill)
+}
+
+func TestTokenBucket_Lease_ReserveCountsLease(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	clk := NewManualClock(testEpoch)
+	tb := NewLeasingTokenBucket(5, 1, time.Hour, 5, time.Second, WithClock(clk), WithStorage(store))
+	defer tb.Close()
+
+	key := "lease_reserve"
+
+	// The whole bucket is leased: the storage is empty but 4 tokens can be served locally
+	_, err := tb.Allow(tokenCtx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, "0", storedTokens(t, store, tb, key))
+	wait, err := tb.Reserve(tokenCtx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), wait)
+
+	// Lease used up - wait for the bucket to refill
+	for i := 0; i < 4; i++ {
+		_, err = tb.Allow(tokenCtx, key)
+		assert.NoError(t, err)
+	}
+	wait, err = tb.Reserve(tokenCtx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, wait)
+}
+
+// Run with -race: the janitor reads the bucket parameters outside the manager's lock
+func TestTokenBucket_Lease_JanitorRunsAlongsideUpdateConfig(t *testing.T) {
+	store := storage.NewMemoryStorage(0)
+	defer store.Close()
+	tb := NewLeasingTokenBucket(10, 1, time.Hour, 5, time.Millisecond, WithStorage(store))
+	defer tb.Close()
+	m := NewLimiterManager(NewLeakyBucket(10, 1, time.Hour), tb, AlgorithmTokenBucket)
+
+	for i := 0; i < 200; i++ {
+		_, err := m.Allow(tokenCtx, fmt.Sprintf("k%d", i%4))
+		assert.NoError(t, err)
+		assert.NoError(t, m.UpdateConfig(tokenCtx, AlgorithmTokenBucket, Config{Capacity: float64(10 + i%2), Rate: 1, TTL: time.Hour}))
+		time.Sleep(100 * time.Microsecond)
+	}
+}
@@ -0,0 +1,68 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrWaitExceedsDeadline dikembalikan oleh Wait jika slot berikutnya baru tersedia setelah deadline context
+var ErrWaitExceedsDeadline = errors.New("limiter: wait would exceed context deadline")
+
+// minWaitInterval adalah jeda minimum sebelum mencoba lagi, agar tidak busy-loop ke Redis
+const minWaitInterval = 10 * time.Millisecond
+
+// Waiter diimplementasikan oleh limiter yang bisa menunggu kapasitas alih-alih menolak request
+type Waiter interface {
+	// Reserve mengembalikan berapa lama sampai satu request akan diizinkan (0 = sekarang), tanpa mengonsumsi
+	Reserve(ctx context.Context, key string) (time.Duration, error)
+
+	// Wait memblok sampai request diizinkan (dan dikonsumsi) atau context selesai
+	Wait(ctx context.Context, key string) error
+}
+
+// waitFor memanggil Allow berulang kali, tidur selama RetryAfter di antaranya.
+// Percobaan diulang karena worker lain bisa mengambil slot yang sama lebih dulu.
+func waitFor(ctx context.Context, rl RateLimiter, key string) error {
+	for {
+		result, err := rl.Allow(ctx, key)
+		if err != nil {
+			return err
+		}
+		if result.Allowed {
+			// Shaping mode: slot sudah dipesan, tunggu giliran keluar dari antrian
+			return sleepCtx(ctx, result.Delay)
+		}
+
+		delay := result.RetryAfter
+		if delay < minWaitInterval {
+			delay = minWaitInterval
+		}
+
+		// Tidak perlu tidur jika slot baru tersedia setelah deadline
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return ErrWaitExceedsDeadline
+		}
+
+		if err := sleepCtx(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// sleepCtx tidur selama d atau sampai context selesai
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
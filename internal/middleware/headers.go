@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/Rate-Limiting-API/internal/limiter"
+)
+
+// HeaderDialect memilih header rate limit yang dikirim ke client (bisa digabung dengan |)
+type HeaderDialect int
+
+const (
+	// HeadersXRateLimit mengirim X-RateLimit-Limit, X-RateLimit-Remaining dan X-RateLimit-Reset (Unix epoch detik)
+	HeadersXRateLimit HeaderDialect = 1 << iota
+
+	// HeadersIETF mengirim RateLimit dan RateLimit-Policy
+	// (draft-ietf-httpapi-ratelimit-headers: reset dalam detik dari sekarang, w = window dalam detik)
+	HeadersIETF
+
+	// HeadersRetryAfter mengirim Retry-After (detik) pada response 429
+	HeadersRetryAfter
+
+	// HeadersNone mematikan semua header rate limit
+	HeadersNone HeaderDialect = -1
+
+	// HeadersDefault dipakai jika RateLimitConfig.Headers tidak diisi
+	HeadersDefault = HeadersXRateLimit | HeadersRetryAfter
+)
+
+// setRateLimitHeaders menulis header sesuai dialect yang dipilih
+func setRateLimitHeaders(c *gin.Context, dialect HeaderDialect, result *limiter.Result) {
+	if dialect == HeadersNone {
+		return
+	}
+
+	limit := formatCount(result.Limit)
+	remaining := formatCount(result.Remaining)
+
+	if dialect&HeadersXRateLimit != 0 {
+		c.Header("X-RateLimit-Limit", limit)
+		c.Header("X-RateLimit-Remaining", remaining)
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(ceilUnix(result.ResetAt), 10))
+	}
+
+	if dialect&HeadersIETF != 0 {
+		reset := formatSeconds(result.ResetAfter) // Relatif ke clock limiter, bukan jam lokal
+		c.Header("RateLimit", "limit="+limit+", remaining="+remaining+", reset="+reset)
+		c.Header("RateLimit-Policy", limit+";w="+formatSeconds(result.Window))
+	}
+
+	if dialect&HeadersRetryAfter != 0 && !result.Allowed && result.RetryAfter > 0 {
+		c.Header("Retry-After", formatSeconds(result.RetryAfter))
+	}
+}
+
+// formatCount membulatkan ke bawah: sisa 0.6 belum cukup untuk satu request
+func formatCount(v float64) string {
+	return strconv.FormatFloat(math.Max(0, math.Floor(v)), 'f', 0, 64)
+}
+
+// formatSeconds membulatkan durasi ke atas dalam detik agar client tidak retry terlalu cepat
+func formatSeconds(d time.Duration) string {
+	if d <= 0 {
+		return "0"
+	}
+	return strconv.FormatFloat(math.Ceil(d.Seconds()), 'f', 0, 64)
+}
+
+// ceilUnix mengubah waktu menjadi Unix epoch detik, dibulatkan ke atas
+func ceilUnix(t time.Time) int64 {
+	sec := t.Unix()
+	if t.Nanosecond() > 0 {
+		sec++
+	}
+	return sec
+}
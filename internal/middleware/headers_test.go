@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/user/Rate-Limiting-API/internal/limiter"
+)
+
+func serveWithHeaders(dialect HeaderDialect, result *limiter.Result) *httptest.ResponseRecorder {
+	mock := &MockRateLimiter{
+		AllowFunc: func(ctx context.Context, key string) (*limiter.Result, error) {
+			return result, nil
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RateLimitWithConfig(RateLimitConfig{
+		Limiter: mock,
+		Headers: dialect,
+	}))
+	r.GET("/test", func(c *gin.Context) {
+		c.JSON(200, gin.H{"status": "ok"})
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/test", nil)
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestHeaders_Default(t *testing.T) {
+	resetAt := time.Now().Add(30 * time.Second)
+	w := serveWithHeaders(0, &limiter.Result{
+		Allowed:   true,
+		Limit:     10,
+		Remaining: 6.7, // Rounded down
+		ResetAt:   resetAt,
+		Window:    time.Minute,
+	})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "10", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "6", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, strconv.FormatInt(ceilUnix(resetAt), 10), w.Header().Get("X-RateLimit-Reset"))
+	assert.Empty(t, w.Header().Get("RateLimit"))   // IETF not enabled by default
+	assert.Empty(t, w.Header().Get("Retry-After")) // Only on 429
+}
+
+func TestHeaders_DeniedRetryAfter(t *testing.T) {
+	w := serveWithHeaders(0, &limiter.Result{
+		Allowed:    false,
+		Limit:      10,
+		RetryAfter: 1200 * time.Millisecond, // Rounded up
+		ResetAt:    time.Now().Add(5 * time.Second),
+	})
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+}
+
+func TestHeaders_IETF(t *testing.T) {
+	w := serveWithHeaders(HeadersIETF, &limiter.Result{
+		Allowed:    true,
+		Limit:      100,
+		Remaining:  42,
+		ResetAt:    time.Now().Add(time.Hour), // Clock limiter (mis. RedisClock) boleh berbeda dari jam lokal
+		ResetAfter: 9500 * time.Millisecond,
+		Window:     time.Minute,
+	})
+
+	assert.Equal(t, "limit=100, remaining=42, reset=10", w.Header().Get("RateLimit"))
+	assert.Equal(t, "100;w=60", w.Header().Get("RateLimit-Policy"))
+	assert.Empty(t, w.Header().Get("X-RateLimit-Limit")) // Legacy dialect not selected
+}
+
+func TestHeaders_Combined(t *testing.T) {
+	w := serveWithHeaders(HeadersXRateLimit|HeadersIETF|HeadersRetryAfter, &limiter.Result{
+		Allowed:    false,
+		Limit:      5,
+		RetryAfter: 3 * time.Second,
+		ResetAt:    time.Now().Add(10 * time.Second),
+		Window:     10 * time.Second,
+	})
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "5", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "5;w=10", w.Header().Get("RateLimit-Policy"))
+	assert.Equal(t, "3", w.Header().Get("Retry-After"))
+}
+
+func TestHeaders_None(t *testing.T) {
+	w := serveWithHeaders(HeadersNone, &limiter.Result{
+		Allowed:    false,
+		Limit:      5,
+		RetryAfter: 3 * time.Second,
+	})
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Empty(t, w.Header().Get("X-RateLimit-Remaining"))
+	assert.Empty(t, w.Header().Get("RateLimit"))
+	assert.Empty(t, w.Header().Get("Retry-After"))
+}
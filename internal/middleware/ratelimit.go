@@ -1,8 +1,11 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/user/Rate-Limiting-API/internal/limiter"
@@ -17,19 +20,79 @@ func DefaultKeyFunc(c *gin.Context) string {
 	return c.ClientIP()
 }
 
+// CostFunc adalah fungsi untuk menentukan cost sebuah request (default 1)
+// Misalnya batch endpoint dengan 100 item bisa mengembalikan 100
+type CostFunc func(c *gin.Context) int64
+
+// FailurePolicy menentukan apa yang dilakukan middleware jika limiter error (misalnya Redis down)
+type FailurePolicy int
+
+const (
+	// FailClosed menolak request dengan 500 (default)
+	FailClosed FailurePolicy = iota
+
+	// FailOpen meneruskan request tanpa rate limiting
+	FailOpen
+
+	// FailFallback memakai RateLimitConfig.Fallback (misalnya limiter in-memory lokal)
+	FailFallback
+)
+
+// DegradedHeader dikirim jika keputusan tidak dibuat oleh limiter utama.
+// Nilainya "closed", "open" atau "fallback" sesuai FailurePolicy yang dipakai.
+const DegradedHeader = "X-RateLimit-Degraded"
+
+// String mengembalikan nama policy seperti yang dikirim di DegradedHeader
+func (p FailurePolicy) String() string {
+	switch p {
+	case FailOpen:
+		return "open"
+	case FailFallback:
+		return "fallback"
+	default:
+		return "closed"
+	}
+}
+
 // RateLimitConfig adalah konfigurasi untuk middleware rate limiting
 type RateLimitConfig struct {
 	Limiter    limiter.RateLimiter
 	KeyFunc    KeyFunc
+	CostFunc   CostFunc      // Optional; nil = setiap request bernilai 1
+	Headers    HeaderDialect // Optional; 0 = HeadersDefault (X-RateLimit-* + Retry-After)
+	Shape      bool          // Tahan request selama Result.Delay (LeakyBucket shaping mode) sebelum diteruskan
 	ErrHandler gin.HandlerFunc
+
+	// OnError menentukan perilaku saat Limiter error; bungkus Limiter dengan limiter.CircuitBreaker
+	// agar Redis yang sedang down tidak terus dipanggil di setiap request
+	OnError  FailurePolicy
+	Fallback limiter.RateLimiter // Wajib jika OnError = FailFallback
+}
+
+// ResultContextKey adalah key gin context tempat middleware menyimpan *limiter.Result
+// sehingga handler dan ErrHandler bisa membaca limit, remaining, retry-after, dst.
+const ResultContextKey = "ratelimit.result"
+
+// GetResult mengambil *limiter.Result dari gin context (nil jika tidak ada)
+func GetResult(c *gin.Context) *limiter.Result {
+	val, exists := c.Get(ResultContextKey)
+	if !exists {
+		return nil
+	}
+	result, _ := val.(*limiter.Result)
+	return result
 }
 
 // DefaultErrHandler adalah default error handler ketika rate limit tercapai
 func DefaultErrHandler(c *gin.Context) {
-	c.JSON(http.StatusTooManyRequests, gin.H{
+	body := gin.H{
 		"error":   "Too Many Requests",
 		"message": "Rate limit exceeded. Please try again later.",
-	})
+	}
+	if result := GetResult(c); result != nil {
+		body["retry_after"] = result.RetryAfter.Seconds() // Detik sampai request boleh dicoba lagi
+	}
+	c.JSON(http.StatusTooManyRequests, body)
 	c.Abort()
 }
 
@@ -53,11 +116,41 @@ func RateLimitWithConfig(config RateLimitConfig) gin.HandlerFunc {
 	if config.ErrHandler == nil {
 		config.ErrHandler = DefaultErrHandler
 	}
+	if config.Headers == 0 {
+		config.Headers = HeadersDefault
+	}
+	if config.OnError == FailFallback && config.Fallback == nil {
+		panic("Fallback RateLimiter is required for FailFallback")
+	}
 
 	return func(c *gin.Context) {
 		key := config.KeyFunc(c)
 
-		allowed, remaining, err := config.Limiter.Allow(c.Request.Context(), key)
+		cost := int64(1)
+		if config.CostFunc != nil {
+			cost = config.CostFunc(c)
+		}
+
+		result, err := config.Limiter.AllowN(c.Request.Context(), key, cost)
+		if errors.Is(err, limiter.ErrInvalidCost) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid request cost",
+			})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			// Limiter utama tidak bisa dipakai - putuskan sesuai failure policy
+			c.Header(DegradedHeader, config.OnError.String())
+			switch config.OnError {
+			case FailOpen:
+				c.Next()
+				return
+			case FailFallback:
+				result, err = config.Fallback.AllowN(c.Request.Context(), key, cost)
+			}
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error":   "Internal Server Error",
@@ -67,14 +160,30 @@ func RateLimitWithConfig(config RateLimitConfig) gin.HandlerFunc {
 			return
 		}
 
+		// Simpan hasil untuk handler berikutnya / ErrHandler
+		c.Set(ResultContextKey, result)
+
 		// Set rate limit headers
-		c.Header("X-RateLimit-Remaining", strconv.FormatFloat(remaining, 'f', 0, 64))
+		setRateLimitHeaders(c, config.Headers, result)
 
-		if !allowed {
+		if !result.Allowed {
 			config.ErrHandler(c)
 			return
 		}
 
+		// Shaping: request sudah mendapat slot di antrian, tunggu gilirannya
+		if config.Shape && result.Delay > 0 {
+			timer := time.NewTimer(result.Delay)
+			select {
+			case <-c.Request.Context().Done():
+				// Client disconnect saat menunggu - tidak perlu diteruskan
+				timer.Stop()
+				c.Abort()
+				return
+			case <-timer.C:
+			}
+		}
+
 		c.Next()
 	}
 }
@@ -108,3 +217,61 @@ func RateLimitByUserID(rl limiter.RateLimiter, contextKey string) gin.HandlerFun
 		ErrHandler: DefaultErrHandler,
 	})
 }
+
+// ConcurrencyLimitConfig adalah konfigurasi untuk middleware concurrency limiting
+type ConcurrencyLimitConfig struct {
+	Limiter    limiter.LeaseLimiter
+	KeyFunc    KeyFunc
+	ErrHandler gin.HandlerFunc
+}
+
+// ConcurrencyLimit membuat middleware yang membatasi jumlah request in-flight per client
+func ConcurrencyLimit(ll limiter.LeaseLimiter) gin.HandlerFunc {
+	return ConcurrencyLimitWithConfig(ConcurrencyLimitConfig{
+		Limiter:    ll,
+		KeyFunc:    DefaultKeyFunc,
+		ErrHandler: DefaultErrHandler,
+	})
+}
+
+// ConcurrencyLimitWithConfig membuat middleware concurrency limiting dengan konfigurasi custom.
+// Slot dilepas setelah c.Next() selesai, juga ketika handler panic.
+func ConcurrencyLimitWithConfig(config ConcurrencyLimitConfig) gin.HandlerFunc {
+	if config.Limiter == nil {
+		panic("LeaseLimiter is required")
+	}
+	if config.KeyFunc == nil {
+		config.KeyFunc = DefaultKeyFunc
+	}
+	if config.ErrHandler == nil {
+		config.ErrHandler = DefaultErrHandler
+	}
+
+	return func(c *gin.Context) {
+		key := config.KeyFunc(c)
+
+		leaseID, remaining, err := config.Limiter.Acquire(c.Request.Context(), key)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Internal Server Error",
+				"message": "Failed to check concurrency limit",
+			})
+			c.Abort()
+			return
+		}
+
+		// Set concurrency limit headers
+		c.Header("X-Concurrency-Remaining", strconv.FormatFloat(remaining, 'f', 0, 64))
+
+		if leaseID == "" {
+			config.ErrHandler(c)
+			return
+		}
+
+		// Release even if the client disconnected (request context canceled);
+		// a failed release is recovered by lease expiry
+		defer config.Limiter.Release(context.WithoutCancel(c.Request.Context()), key, leaseID)
+
+		c.Next()
+	}
+}
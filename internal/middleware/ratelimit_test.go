@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -13,16 +14,24 @@ import (
 
 // MockRateLimiter untuk testing
 type MockRateLimiter struct {
-	AllowFunc     func(ctx context.Context, key string) (bool, float64, error)
+	AllowFunc     func(ctx context.Context, key string) (*limiter.Result, error)
+	AllowNFunc    func(ctx context.Context, key string, n int64) (*limiter.Result, error)
 	ResetFunc     func(ctx context.Context, key string) error
 	GetStatusFunc func(ctx context.Context, key string) (*limiter.Status, error)
 }
 
-func (m *MockRateLimiter) Allow(ctx context.Context, key string) (bool, float64, error) {
+func (m *MockRateLimiter) Allow(ctx context.Context, key string) (*limiter.Result, error) {
 	if m.AllowFunc != nil {
 		return m.AllowFunc(ctx, key)
 	}
-	return true, 10, nil
+	return &limiter.Result{Allowed: true, Remaining: 10}, nil
+}
+
+func (m *MockRateLimiter) AllowN(ctx context.Context, key string, n int64) (*limiter.Result, error) {
+	if m.AllowNFunc != nil {
+		return m.AllowNFunc(ctx, key, n)
+	}
+	return m.Allow(ctx, key)
 }
 
 func (m *MockRateLimiter) Reset(ctx context.Context, key string) error {
@@ -51,8 +60,8 @@ func setupRouter(rl limiter.RateLimiter) *gin.Engine {
 
 func TestRateLimit_Allowed(t *testing.T) {
 	mock := &MockRateLimiter{
-		AllowFunc: func(ctx context.Context, key string) (bool, float64, error) {
-			return true, 9, nil
+		AllowFunc: func(ctx context.Context, key string) (*limiter.Result, error) {
+			return &limiter.Result{Allowed: true, Remaining: 9}, nil
 		},
 	}
 
@@ -67,8 +76,8 @@ func TestRateLimit_Allowed(t *testing.T) {
 
 func TestRateLimit_Denied(t *testing.T) {
 	mock := &MockRateLimiter{
-		AllowFunc: func(ctx context.Context, key string) (bool, float64, error) {
-			return false, 0, nil
+		AllowFunc: func(ctx context.Context, key string) (*limiter.Result, error) {
+			return &limiter.Result{Allowed: false, Remaining: 0}, nil
 		},
 	}
 
@@ -83,8 +92,8 @@ func TestRateLimit_Denied(t *testing.T) {
 
 func TestRateLimit_Error(t *testing.T) {
 	mock := &MockRateLimiter{
-		AllowFunc: func(ctx context.Context, key string) (bool, float64, error) {
-			return false, 0, assert.AnError
+		AllowFunc: func(ctx context.Context, key string) (*limiter.Result, error) {
+			return nil, assert.AnError
 		},
 	}
 
@@ -109,10 +118,10 @@ func TestDefaultKeyFunc(t *testing.T) {
 
 func TestRateLimitByAPIKey(t *testing.T) {
 	mock := &MockRateLimiter{
-		AllowFunc: func(ctx context.Context, key string) (bool, float64, error) {
+		AllowFunc: func(ctx context.Context, key string) (*limiter.Result, error) {
 			// Verify the key is prefixed with "apikey:"
 			assert.Equal(t, "apikey:test-api-key", key)
-			return true, 5, nil
+			return &limiter.Result{Allowed: true, Remaining: 5}, nil
 		},
 	}
 
@@ -133,10 +142,10 @@ func TestRateLimitByAPIKey(t *testing.T) {
 
 func TestRateLimitByAPIKey_Fallback(t *testing.T) {
 	mock := &MockRateLimiter{
-		AllowFunc: func(ctx context.Context, key string) (bool, float64, error) {
+		AllowFunc: func(ctx context.Context, key string) (*limiter.Result, error) {
 			// Should fallback to IP when no API key
 			assert.NotContains(t, key, "apikey:")
-			return true, 5, nil
+			return &limiter.Result{Allowed: true, Remaining: 5}, nil
 		},
 	}
 
@@ -165,8 +174,8 @@ func TestRateLimitWithConfig_PanicOnNilLimiter(t *testing.T) {
 
 func TestRateLimitWithConfig_CustomErrorHandler(t *testing.T) {
 	mock := &MockRateLimiter{
-		AllowFunc: func(ctx context.Context, key string) (bool, float64, error) {
-			return false, 0, nil
+		AllowFunc: func(ctx context.Context, key string) (*limiter.Result, error) {
+			return &limiter.Result{Allowed: false, Remaining: 0}, nil
 		},
 	}
 
@@ -191,3 +200,340 @@ func TestRateLimitWithConfig_CustomErrorHandler(t *testing.T) {
 
 	assert.Equal(t, http.StatusForbidden, w.Code)
 }
+
+// setupFailureRouter membuat router dengan limiter utama yang selalu error
+func setupFailureRouter(policy FailurePolicy, fallback limiter.RateLimiter) *gin.Engine {
+	broken := &MockRateLimiter{
+		AllowFunc: func(ctx context.Context, key string) (*limiter.Result, error) {
+			return nil, assert.AnError
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RateLimitWithConfig(RateLimitConfig{
+		Limiter:  broken,
+		OnError:  policy,
+		Fallback: fallback,
+	}))
+	r.GET("/test", func(c *gin.Context) {
+		c.JSON(200, gin.H{"status": "ok"})
+	})
+	return r
+}
+
+func TestRateLimitWithConfig_FailClosed(t *testing.T) {
+	router := setupFailureRouter(FailClosed, nil)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/test", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "closed", w.Header().Get(DegradedHeader))
+}
+
+func TestRateLimitWithConfig_FailOpen(t *testing.T) {
+	router := setupFailureRouter(FailOpen, nil)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/test", nil)
+	router.ServeHTTP(w, req)
+
+	// Request diteruskan tanpa header rate limit
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "open", w.Header().Get(DegradedHeader))
+	assert.Empty(t, w.Header().Get("X-RateLimit-Remaining"))
+}
+
+func TestRateLimitWithConfig_FailFallback(t *testing.T) {
+	fallback := &MockRateLimiter{
+		AllowFunc: func(ctx context.Context, key string) (*limiter.Result, error) {
+			return &limiter.Result{Allowed: false, Limit: 5}, nil
+		},
+	}
+
+	router := setupFailureRouter(FailFallback, fallback)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/test", nil)
+	router.ServeHTTP(w, req)
+
+	// Keputusan fallback dipakai seperti keputusan limiter utama
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "fallback", w.Header().Get(DegradedHeader))
+	assert.Equal(t, "5", w.Header().Get("X-RateLimit-Limit"))
+}
+
+func TestRateLimitWithConfig_HealthyHasNoDegradedHeader(t *testing.T) {
+	router := setupRouter(&MockRateLimiter{})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/test", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(DegradedHeader))
+}
+
+func TestRateLimitWithConfig_PanicOnMissingFallback(t *testing.T) {
+	assert.Panics(t, func() {
+		RateLimitWithConfig(RateLimitConfig{
+			Limiter: &MockRateLimiter{},
+			OnError: FailFallback,
+		})
+	})
+}
+
+// MockLeaseLimiter untuk testing concurrency middleware
+type MockLeaseLimiter struct {
+	AcquireFunc func(ctx context.Context, key string) (string, float64, error)
+	Released    []string
+}
+
+func (m *MockLeaseLimiter) Acquire(ctx context.Context, key string) (string, float64, error) {
+	if m.AcquireFunc != nil {
+		return m.AcquireFunc(ctx, key)
+	}
+	return "lease-1", 1, nil
+}
+
+func (m *MockLeaseLimiter) Release(ctx context.Context, key, leaseID string) error {
+	m.Released = append(m.Released, leaseID)
+	return nil
+}
+
+func setupConcurrencyRouter(ll limiter.LeaseLimiter, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ConcurrencyLimit(ll))
+	r.GET("/test", handler)
+	return r
+}
+
+func TestConcurrencyLimit_ReleasesAfterHandler(t *testing.T) {
+	mock := &MockLeaseLimiter{
+		AcquireFunc: func(ctx context.Context, key string) (string, float64, error) {
+			return "lease-abc", 2, nil
+		},
+	}
+
+	router := setupConcurrencyRouter(mock, func(c *gin.Context) {
+		// Slot is still held while the handler runs
+		assert.Empty(t, mock.Released)
+		c.JSON(200, gin.H{"status": "ok"})
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/test", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-Concurrency-Remaining"))
+	assert.Equal(t, []string{"lease-abc"}, mock.Released)
+}
+
+func TestConcurrencyLimit_Denied(t *testing.T) {
+	mock := &MockLeaseLimiter{
+		AcquireFunc: func(ctx context.Context, key string) (string, float64, error) {
+			return "", 0, nil
+		},
+	}
+
+	router := setupConcurrencyRouter(mock, func(c *gin.Context) {
+		t.Fatal("handler must not run when no slot is free")
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/test", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Empty(t, mock.Released) // Nothing acquired, nothing released
+}
+
+func TestConcurrencyLimit_Error(t *testing.T) {
+	mock := &MockLeaseLimiter{
+		AcquireFunc: func(ctx context.Context, key string) (string, float64, error) {
+			return "", 0, assert.AnError
+		},
+	}
+
+	router := setupConcurrencyRouter(mock, func(c *gin.Context) {
+		c.JSON(200, gin.H{"status": "ok"})
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/test", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Empty(t, mock.Released)
+}
+
+func TestConcurrencyLimitWithConfig_PanicOnNilLimiter(t *testing.T) {
+	assert.Panics(t, func() {
+		ConcurrencyLimitWithConfig(ConcurrencyLimitConfig{
+			Limiter: nil,
+		})
+	})
+}
+
+func TestRateLimitWithConfig_CostFunc(t *testing.T) {
+	mock := &MockRateLimiter{
+		AllowNFunc: func(ctx context.Context, key string, n int64) (*limiter.Result, error) {
+			// Batch of 100 items is charged 100
+			assert.Equal(t, int64(100), n)
+			return &limiter.Result{Allowed: true, Remaining: 900}, nil
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RateLimitWithConfig(RateLimitConfig{
+		Limiter: mock,
+		CostFunc: func(c *gin.Context) int64 {
+			return 100
+		},
+	}))
+	r.POST("/batch", func(c *gin.Context) {
+		c.JSON(200, gin.H{"status": "ok"})
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/batch", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "900", w.Header().Get("X-RateLimit-Remaining"))
+}
+
+func TestRateLimitWithConfig_DefaultCost(t *testing.T) {
+	mock := &MockRateLimiter{
+		AllowNFunc: func(ctx context.Context, key string, n int64) (*limiter.Result, error) {
+			assert.Equal(t, int64(1), n)
+			return &limiter.Result{Allowed: true, Remaining: 9}, nil
+		},
+	}
+
+	router := setupRouter(mock)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/test", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRateLimitWithConfig_InvalidCost(t *testing.T) {
+	mock := &MockRateLimiter{
+		AllowNFunc: func(ctx context.Context, key string, n int64) (*limiter.Result, error) {
+			return nil, limiter.ErrInvalidCost
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RateLimitWithConfig(RateLimitConfig{
+		Limiter: mock,
+		CostFunc: func(c *gin.Context) int64 {
+			return 0 // Empty batch
+		},
+	}))
+	r.POST("/batch", func(c *gin.Context) {
+		c.JSON(200, gin.H{"status": "ok"})
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/batch", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRateLimit_DeniedIncludesRetryAfter(t *testing.T) {
+	mock := &MockRateLimiter{
+		AllowFunc: func(ctx context.Context, key string) (*limiter.Result, error) {
+			return &limiter.Result{Allowed: false, Limit: 10, RetryAfter: 1500 * time.Millisecond}, nil
+		},
+	}
+
+	router := setupRouter(mock)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/test", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.JSONEq(t, `{"error":"Too Many Requests","message":"Rate limit exceeded. Please try again later.","retry_after":1.5}`, w.Body.String())
+}
+
+func TestRateLimit_ResultInContext(t *testing.T) {
+	mock := &MockRateLimiter{
+		AllowFunc: func(ctx context.Context, key string) (*limiter.Result, error) {
+			return &limiter.Result{Allowed: true, Limit: 10, Remaining: 7, Algorithm: limiter.AlgorithmTokenBucket}, nil
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RateLimit(mock))
+	r.GET("/test", func(c *gin.Context) {
+		result := GetResult(c)
+		assert.NotNil(t, result)
+		assert.Equal(t, 7.0, result.Remaining)
+		assert.Equal(t, limiter.AlgorithmTokenBucket, result.Algorithm)
+		c.JSON(200, gin.H{"status": "ok"})
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/test", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRateLimitWithConfig_ShapeDelaysRequest(t *testing.T) {
+	mock := &MockRateLimiter{
+		AllowFunc: func(ctx context.Context, key string) (*limiter.Result, error) {
+			return &limiter.Result{Allowed: true, Delay: 30 * time.Millisecond}, nil
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RateLimitWithConfig(RateLimitConfig{
+		Limiter: mock,
+		Shape:   true,
+	}))
+	r.GET("/test", func(c *gin.Context) {
+		c.JSON(200, gin.H{"status": "ok"})
+	})
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/test", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond) // Held for the queue delay
+}
+
+func TestRateLimitWithConfig_ShapeClientGone(t *testing.T) {
+	mock := &MockRateLimiter{
+		AllowFunc: func(ctx context.Context, key string) (*limiter.Result, error) {
+			return &limiter.Result{Allowed: true, Delay: time.Minute}, nil
+		},
+	}
+
+	handlerCalled := false
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RateLimitWithConfig(RateLimitConfig{
+		Limiter: mock,
+		Shape:   true,
+	}))
+	r.GET("/test", func(c *gin.Context) {
+		handlerCalled = true
+	})
+
+	reqCtx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(reqCtx, "GET", "/test", nil)
+	r.ServeHTTP(w, req)
+
+	assert.False(t, handlerCalled) // Client disconnected while queued
+}
@@ -0,0 +1,364 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pastikan MemoryStorage implement Storage interface
+var _ Storage = (*MemoryStorage)(nil)
+
+// ErrWrongType dikembalikan jika key dibaca sebagai tipe yang berbeda (string, hash atau sorted set), seperti WRONGTYPE di Redis
+var ErrWrongType = errors.New("storage: operation against a key holding the wrong kind of value")
+
+// ErrScriptNotSupported dikembalikan MemoryStorage.Eval untuk script tanpa implementasi Go (lihat Script.WithLocal)
+var ErrScriptNotSupported = errors.New("storage: script has no in-memory implementation")
+
+// memoryShards adalah jumlah shard map; key dibagi berdasarkan hash agar lock tidak jadi bottleneck
+const memoryShards = 64
+
+// memoryEntry adalah satu nilai (string, hash atau sorted set) beserta waktu expire-nya (zero = tidak pernah expire)
+type memoryEntry struct {
+	value    string
+	hash     map[string]string  // nil jika bukan hash
+	zset     map[string]float64 // nil jika bukan sorted set (member -> score)
+	expireAt time.Time
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && !now.Before(e.expireAt)
+}
+
+// memoryShard adalah satu bagian map dengan lock sendiri
+type memoryShard struct {
+	mu   sync.Mutex
+	data map[string]memoryEntry
+}
+
+// MemoryStorage menyimpan state limiter di memori proses, tanpa Redis.
+// Cocok untuk single-node (edge service, development); state tidak dibagi antar instance
+// dan hilang saat proses restart.
+// Key yang expire tidak pernah terbaca lagi dan dibersihkan secara berkala oleh janitor.
+type MemoryStorage struct {
+	shards [memoryShards]*memoryShard
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// NewMemoryStorage membuat MemoryStorage dengan janitor yang membersihkan key expire
+// setiap janitorInterval (0 = tanpa janitor, key expire hanya diabaikan saat dibaca)
+func NewMemoryStorage(janitorInterval time.Duration) *MemoryStorage {
+	ms := &MemoryStorage{stop: make(chan struct{})}
+	for i := range ms.shards {
+		ms.shards[i] = &memoryShard{data: make(map[string]memoryEntry)}
+	}
+	if janitorInterval > 0 {
+		go ms.janitor(janitorInterval)
+	}
+	return ms
+}
+
+// Close menghentikan janitor
+func (ms *MemoryStorage) Close() {
+	ms.once.Do(func() { close(ms.stop) })
+}
+
+// shardIndex memilih shard untuk key
+func shardIndex(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % memoryShards)
+}
+
+func (ms *MemoryStorage) shard(key string) *memoryShard {
+	return ms.shards[shardIndex(key)]
+}
+
+// Eval menjalankan implementasi Go dari script sambil mengunci semua shard milik keys,
+// sehingga read-compute-write tetap atomik seperti Lua script di Redis
+func (ms *MemoryStorage) Eval(ctx context.Context, script *Script, keys []string, args ...interface{}) ([]interface{}, error) {
+	if script.local == nil {
+		return nil, ErrScriptNotSupported
+	}
+
+	// Kunci shard dengan urutan index yang sama di semua goroutine agar tidak deadlock
+	indexes := make([]int, 0, len(keys))
+	seen := make(map[int]bool, len(keys))
+	for _, key := range keys {
+		idx := shardIndex(key)
+		if !seen[idx] {
+			seen[idx] = true
+			indexes = append(indexes, idx)
+		}
+	}
+	sort.Ints(indexes)
+	for _, idx := range indexes {
+		ms.shards[idx].mu.Lock()
+	}
+	defer func() {
+		for _, idx := range indexes {
+			ms.shards[idx].mu.Unlock()
+		}
+	}()
+
+	return script.local(&memoryTx{ms: ms, now: time.Now()}, keys, args)
+}
+
+// Get membaca nilai key (ErrNotFound jika tidak ada atau sudah expire)
+func (ms *MemoryStorage) Get(ctx context.Context, key string) (string, error) {
+	sh := ms.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	entry, ok := sh.data[key]
+	if !ok || entry.expired(time.Now()) {
+		return "", ErrNotFound
+	}
+	if entry.hash != nil || entry.zset != nil {
+		return "", ErrWrongType
+	}
+	return entry.value, nil
+}
+
+// HGetAll membaca salinan semua field hash (map kosong jika key tidak ada atau sudah expire)
+func (ms *MemoryStorage) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	sh := ms.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	fields := make(map[string]string)
+	entry, ok := sh.data[key]
+	if !ok || entry.expired(time.Now()) {
+		return fields, nil
+	}
+	if entry.hash == nil {
+		return nil, ErrWrongType
+	}
+	for field, value := range entry.hash {
+		fields[field] = value
+	}
+	return fields, nil
+}
+
+// ZCount menghitung member sorted set dengan score > min (0 jika key tidak ada atau sudah expire)
+func (ms *MemoryStorage) ZCount(ctx context.Context, key string, min float64) (int64, error) {
+	sh := ms.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	entry, ok := sh.data[key]
+	if !ok || entry.expired(time.Now()) {
+		return 0, nil
+	}
+	if entry.zset == nil {
+		return 0, ErrWrongType
+	}
+	var count int64
+	for _, score := range entry.zset {
+		if score > min {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Del menghapus keys
+func (ms *MemoryStorage) Del(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		sh := ms.shard(key)
+		sh.mu.Lock()
+		delete(sh.data, key)
+		sh.mu.Unlock()
+	}
+	return nil
+}
+
+// Keys mencari key yang belum expire dan cocok dengan glob pattern (* dan ? seperti Redis KEYS)
+func (ms *MemoryStorage) Keys(ctx context.Context, pattern string) ([]string, error) {
+	re, err := globToRegexp(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var keys []string
+	for _, sh := range ms.shards {
+		sh.mu.Lock()
+		for key, entry := range sh.data {
+			if !entry.expired(now) && re.MatchString(key) {
+				keys = append(keys, key)
+			}
+		}
+		sh.mu.Unlock()
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Time mengembalikan jam lokal; MemoryStorage hanya dipakai satu proses
+func (ms *MemoryStorage) Time(ctx context.Context) (time.Time, error) {
+	return time.Now(), nil
+}
+
+// janitor menghapus key yang sudah expire secara berkala sampai Close dipanggil
+func (ms *MemoryStorage) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ms.stop:
+			return
+		case <-ticker.C:
+			ms.deleteExpired()
+		}
+	}
+}
+
+// deleteExpired menghapus semua key yang sudah expire
+func (ms *MemoryStorage) deleteExpired() {
+	now := time.Now()
+	for _, sh := range ms.shards {
+		sh.mu.Lock()
+		for key, entry := range sh.data {
+			if entry.expired(now) {
+				delete(sh.data, key)
+			}
+		}
+		sh.mu.Unlock()
+	}
+}
+
+// globToRegexp mengubah glob pattern Redis (* dan ?) menjadi regexp
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// memoryTx memberi akses key ke LocalFunc; shard-nya sudah dikunci oleh Eval
+type memoryTx struct {
+	ms  *MemoryStorage
+	now time.Time
+}
+
+func (tx *memoryTx) Get(key string) (string, bool) {
+	entry, ok := tx.ms.shard(key).data[key]
+	if !ok || entry.expired(tx.now) || entry.hash != nil || entry.zset != nil {
+		return "", false
+	}
+	return entry.value, true
+}
+
+func (tx *memoryTx) Set(key, value string, ttl time.Duration) {
+	entry := memoryEntry{value: value}
+	if ttl > 0 {
+		entry.expireAt = tx.now.Add(ttl)
+	}
+	tx.ms.shard(key).data[key] = entry
+}
+
+func (tx *memoryTx) HGet(key, field string) (string, bool) {
+	entry, ok := tx.ms.shard(key).data[key]
+	if !ok || entry.expired(tx.now) {
+		return "", false
+	}
+	value, ok := entry.hash[field]
+	return value, ok
+}
+
+func (tx *memoryTx) HSet(key string, fields map[string]string, ttl time.Duration) {
+	data := tx.ms.shard(key).data
+	entry, ok := data[key]
+	if !ok || entry.expired(tx.now) || entry.hash == nil {
+		entry = memoryEntry{hash: make(map[string]string, len(fields))}
+	}
+	for field, value := range fields {
+		entry.hash[field] = value
+	}
+	entry.expireAt = time.Time{}
+	if ttl > 0 {
+		entry.expireAt = tx.now.Add(ttl)
+	}
+	data[key] = entry
+}
+
+func (tx *memoryTx) Del(key string) {
+	delete(tx.ms.shard(key).data, key)
+}
+
+func (tx *memoryTx) ZAdd(key string, members map[string]float64, ttl time.Duration) {
+	data := tx.ms.shard(key).data
+	entry, ok := data[key]
+	if !ok || entry.expired(tx.now) || entry.zset == nil {
+		entry = memoryEntry{zset: make(map[string]float64, len(members))}
+	}
+	for member, score := range members {
+		entry.zset[member] = score
+	}
+	entry.expireAt = time.Time{}
+	if ttl > 0 {
+		entry.expireAt = tx.now.Add(ttl)
+	}
+	data[key] = entry
+}
+
+func (tx *memoryTx) ZRem(key string, members ...string) {
+	entry, ok := tx.ms.shard(key).data[key]
+	if !ok || entry.zset == nil {
+		return
+	}
+	for _, member := range members {
+		delete(entry.zset, member)
+	}
+	tx.dropEmpty(key, entry)
+}
+
+func (tx *memoryTx) ZRemRangeByScore(key string, max float64) {
+	entry, ok := tx.ms.shard(key).data[key]
+	if !ok || entry.zset == nil {
+		return
+	}
+	for member, score := range entry.zset {
+		if score <= max {
+			delete(entry.zset, member)
+		}
+	}
+	tx.dropEmpty(key, entry)
+}
+
+func (tx *memoryTx) ZScores(key string) []float64 {
+	entry, ok := tx.ms.shard(key).data[key]
+	if !ok || entry.expired(tx.now) {
+		return nil
+	}
+	scores := make([]float64, 0, len(entry.zset))
+	for _, score := range entry.zset {
+		scores = append(scores, score)
+	}
+	sort.Float64s(scores)
+	return scores
+}
+
+// dropEmpty menghapus sorted set yang sudah kosong, seperti Redis
+func (tx *memoryTx) dropEmpty(key string, entry memoryEntry) {
+	if len(entry.zset) == 0 {
+		delete(tx.ms.shard(key).data, key)
+	}
+}
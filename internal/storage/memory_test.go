@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.TODO()
+
+// setScript menulis ARGV[1] ke KEYS[1] dengan TTL ARGV[2] (ms) dan mengembalikan nilai lama
+var setScript = NewScript(`
+local old = redis.call('GET', KEYS[1])
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return {old}
+`).WithLocal(func(tx Tx, keys []string, args []interface{}) ([]interface{}, error) {
+	old, _ := tx.Get(keys[0])
+	tx.Set(keys[0], args[0].(string), time.Duration(args[1].(int64))*time.Millisecond)
+	return []interface{}{old}, nil
+})
+
+func TestMemoryStorage_EvalGetDel(t *testing.T) {
+	ms := NewMemoryStorage(0)
+	defer ms.Close()
+
+	_, err := ms.Get(ctx, "a")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	res, err := ms.Eval(ctx, setScript, []string{"a"}, "1", int64(0))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{""}, res)
+
+	res, err = ms.Eval(ctx, setScript, []string{"a"}, "2", int64(0))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"1"}, res)
+
+	val, err := ms.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, "2", val)
+
+	assert.NoError(t, ms.Del(ctx, "a", "missing"))
+	_, err = ms.Get(ctx, "a")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestMemoryStorage_TTLExpiry(t *testing.T) {
+	ms := NewMemoryStorage(0)
+	defer ms.Close()
+
+	_, err := ms.Eval(ctx, setScript, []string{"short"}, "1", int64(10))
+	assert.NoError(t, err)
+
+	time.Sleep(20 * time.Millisecond)
+
+	// Key expire tidak terbaca lagi, walaupun janitor tidak berjalan
+	_, err = ms.Get(ctx, "short")
+	assert.ErrorIs(t, err, ErrNotFound)
+	keys, err := ms.Keys(ctx, "*")
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestMemoryStorage_JanitorRemovesExpired(t *testing.T) {
+	ms := NewMemoryStorage(5 * time.Millisecond)
+	defer ms.Close()
+
+	_, err := ms.Eval(ctx, setScript, []string{"short"}, "1", int64(1))
+	assert.NoError(t, err)
+	_, err = ms.Eval(ctx, setScript, []string{"long"}, "1", int64(0))
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		sh := ms.shard("short")
+		sh.mu.Lock()
+		defer sh.mu.Unlock()
+		_, exists := sh.data["short"]
+		return !exists
+	}, time.Second, 5*time.Millisecond)
+
+	_, err = ms.Get(ctx, "long") // Tanpa TTL tidak pernah dihapus
+	assert.NoError(t, err)
+}
+
+func TestMemoryStorage_KeysGlob(t *testing.T) {
+	ms := NewMemoryStorage(0)
+	defer ms.Close()
+
+	for _, key := range []string{"bucket:1.2.3.4:water", "bucket:1.2.3.4:time", "bucket:a/b:water", "token:x:tokens"} {
+		_, err := ms.Eval(ctx, setScript, []string{key}, "1", int64(0))
+		assert.NoError(t, err)
+	}
+
+	keys, err := ms.Keys(ctx, "bucket:*:water")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bucket:1.2.3.4:water", "bucket:a/b:water"}, keys) // Titik bukan wildcard, / ikut cocok
+
+	keys, err = ms.Keys(ctx, "token:?:tokens")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"token:x:tokens"}, keys)
+}
+
+func TestMemoryStorage_ScriptWithoutLocal(t *testing.T) {
+	ms := NewMemoryStorage(0)
+	defer ms.Close()
+
+	_, err := ms.Eval(ctx, NewScript(`return 1`), []string{"a"})
+	assert.ErrorIs(t, err, ErrScriptNotSupported)
+}
+
+// hsetScript menulis field ARGV[1] = ARGV[2] di hash KEYS[1] dengan TTL ARGV[3] (ms, 0 = tanpa TTL) dan mengembalikan nilai lama
+var hsetScript = NewScript(`
+local old = redis.call('HGET', KEYS[1], ARGV[1])
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+if tonumber(ARGV[3]) > 0 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[3])
+end
+return {old}
+`).WithLocal(func(tx Tx, keys []string, args []interface{}) ([]interface{}, error) {
+	old, _ := tx.HGet(keys[0], args[0].(string))
+	tx.HSet(keys[0], map[string]string{args[0].(string): args[1].(string)}, time.Duration(args[2].(int64))*time.Millisecond)
+	return []interface{}{old}, nil
+})
+
+func TestMemoryStorage_Hash(t *testing.T) {
+	ms := NewMemoryStorage(0)
+	defer ms.Close()
+
+	fields, err := ms.HGetAll(ctx, "h")
+	assert.NoError(t, err)
+	assert.Empty(t, fields)
+
+	_, err = ms.Eval(ctx, hsetScript, []string{"h"}, "water", "1", int64(0))
+	assert.NoError(t, err)
+	res, err := ms.Eval(ctx, hsetScript, []string{"h"}, "time", "1000", int64(0))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{""}, res)
+
+	// Field lain tetap ada saat satu field ditulis ulang
+	fields, err = ms.HGetAll(ctx, "h")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"water": "1", "time": "1000"}, fields)
+
+	// Hash tidak bisa dibaca sebagai string, dan sebaliknya
+	_, err = ms.Get(ctx, "h")
+	assert.ErrorIs(t, err, ErrWrongType)
+	_, err = ms.Eval(ctx, setScript, []string{"s"}, "1", int64(0))
+	assert.NoError(t, err)
+	_, err = ms.HGetAll(ctx, "s")
+	assert.ErrorIs(t, err, ErrWrongType)
+}
+
+func TestMemoryStorage_HashTTLExpiry(t *testing.T) {
+	ms := NewMemoryStorage(0)
+	defer ms.Close()
+
+	_, err := ms.Eval(ctx, hsetScript, []string{"h"}, "water", "1", int64(10))
+	assert.NoError(t, err)
+
+	time.Sleep(20 * time.Millisecond)
+
+	// Satu TTL untuk seluruh hash
+	fields, err := ms.HGetAll(ctx, "h")
+	assert.NoError(t, err)
+	assert.Empty(t, fields)
+}
+
+// zaddScript menambahkan member ARGV[1] dengan score ARGV[2], menghapus score <= ARGV[3] dan mengembalikan semua score
+var zaddScript = NewScript(`
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[3])
+local scores = {}
+local entries = redis.call('ZRANGE', KEYS[1], 0, -1, 'WITHSCORES')
+for i = 2, #entries, 2 do
+  scores[#scores + 1] = tonumber(entries[i])
+end
+return scores
+`).WithLocal(func(tx Tx, keys []string, args []interface{}) ([]interface{}, error) {
+	tx.ZAdd(keys[0], map[string]float64{args[0].(string): args[1].(float64)}, 0)
+	tx.ZRemRangeByScore(keys[0], args[2].(float64))
+	var scores []interface{}
+	for _, score := range tx.ZScores(keys[0]) {
+		scores = append(scores, score)
+	}
+	return scores, nil
+})
+
+func TestMemoryStorage_SortedSet(t *testing.T) {
+	ms := NewMemoryStorage(0)
+	defer ms.Close()
+
+	res, err := ms.Eval(ctx, zaddScript, []string{"z"}, "b", 20.0, 0.0)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{20.0}, res)
+
+	res, err = ms.Eval(ctx, zaddScript, []string{"z"}, "a", 10.0, 0.0)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{10.0, 20.0}, res) // Urut berdasarkan score
+
+	// Member yang sama hanya mengganti score
+	res, err = ms.Eval(ctx, zaddScript, []string{"z"}, "a", 30.0, 15.0)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{20.0, 30.0}, res)
+
+	count, err := ms.ZCount(ctx, "z", 20)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count) // Hanya score > min
+
+	// Sorted set bukan string
+	_, err = ms.Get(ctx, "z")
+	assert.ErrorIs(t, err, ErrWrongType)
+
+	// Sorted set yang kosong dihapus
+	_, err = ms.Eval(ctx, zaddScript, []string{"z"}, "c", 1.0, 100.0)
+	assert.NoError(t, err)
+	keys, err := ms.Keys(ctx, "z")
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
@@ -8,16 +8,26 @@ import (
 )
 
 var (
-	RedisClient *redis.Client
+	RedisClient redis.UniversalClient
 	Ctx         = context.Background()
 )
 
+// InitRedis menghubungkan ke satu node Redis
 func InitRedis(addr string, password string, db int) {
-	RedisClient = redis.NewClient(&redis.Options{
-		Addr:     addr,
+	InitRedisUniversal(&redis.UniversalOptions{
+		Addrs:    []string{addr},
 		Password: password,
 		DB:       db,
 	})
+}
+
+// InitRedisUniversal menghubungkan ke Redis single node, Cluster atau Sentinel:
+// - MasterName diisi: Sentinel (Addrs = alamat sentinel)
+// - Lebih dari satu Addrs: Cluster
+// - Selain itu: single node
+// Username (ACL), Password dan TLSConfig berlaku untuk semua mode.
+func InitRedisUniversal(opts *redis.UniversalOptions) {
+	RedisClient = redis.NewUniversalClient(opts)
 
 	err := RedisClient.Ping(Ctx).Err()
 	if err != nil {
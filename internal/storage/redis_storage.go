@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Pastikan RedisStorage implement Storage dan Subscriber interface
+var (
+	_ Storage    = (*RedisStorage)(nil)
+	_ Subscriber = (*RedisStorage)(nil)
+)
+
+// RedisStorage adalah implementasi Storage di atas Redis
+type RedisStorage struct {
+	Client redis.UniversalClient
+}
+
+// NewRedisStorage membuat Storage yang memakai client Redis tertentu
+func NewRedisStorage(client redis.UniversalClient) *RedisStorage {
+	return &RedisStorage{Client: client}
+}
+
+// Eval menjalankan script dengan EVALSHA, fallback ke EVAL jika script belum di-load (NOSCRIPT)
+func (rs *RedisStorage) Eval(ctx context.Context, script *Script, keys []string, args ...interface{}) ([]interface{}, error) {
+	return script.redis.Run(ctx, rs.Client, keys, args...).Slice()
+}
+
+// Get membaca nilai key; redis.Nil diterjemahkan menjadi ErrNotFound
+func (rs *RedisStorage) Get(ctx context.Context, key string) (string, error) {
+	val, err := rs.Client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", ErrNotFound
+	}
+	return val, err
+}
+
+// HGetAll membaca semua field hash dengan HGETALL
+func (rs *RedisStorage) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return rs.Client.HGetAll(ctx, key).Result()
+}
+
+// ZCount menghitung member dengan ZCOUNT key (min +inf
+func (rs *RedisStorage) ZCount(ctx context.Context, key string, min float64) (int64, error) {
+	return rs.Client.ZCount(ctx, key, "("+strconv.FormatFloat(min, 'f', -1, 64), "+inf").Result()
+}
+
+// Del menghapus keys dalam satu perintah DEL
+func (rs *RedisStorage) Del(ctx context.Context, keys ...string) error {
+	return rs.Client.Del(ctx, keys...).Err()
+}
+
+// scanCount adalah jumlah key yang diminta per SCAN; Redis tidak diblok lama untuk keyspace besar
+const scanCount = 1000
+
+// Keys mencari key dengan perintah SCAN (bukan KEYS, agar Redis tidak diblok selama keyspace di-scan).
+// Pada Redis Cluster setiap master hanya menyimpan sebagian slot, jadi SCAN dijalankan di semua master.
+// Key bisa muncul lebih dari sekali; key yang dibuat atau dihapus selama scan belum tentu ikut.
+func (rs *RedisStorage) Keys(ctx context.Context, pattern string) ([]string, error) {
+	cluster, ok := rs.Client.(*redis.ClusterClient)
+	if !ok {
+		return scanKeys(ctx, rs.Client, pattern)
+	}
+
+	var mu sync.Mutex
+	var keys []string
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		nodeKeys, err := scanKeys(ctx, node, pattern)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		keys = append(keys, nodeKeys...)
+		mu.Unlock()
+		return nil
+	})
+	return keys, err
+}
+
+// scanKeys mengumpulkan semua key yang cocok dengan pattern di satu node
+func scanKeys(ctx context.Context, client redis.Cmdable, pattern string) ([]string, error) {
+	var keys []string
+	iter := client.Scan(ctx, 0, pattern, scanCount).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+// Time membaca jam server Redis dengan perintah TIME
+func (rs *RedisStorage) Time(ctx context.Context) (time.Time, error) {
+	return rs.Client.Time(ctx).Result()
+}
+
+// Subscribe berlangganan channel dengan SUBSCRIBE dan menunggu konfirmasinya.
+// Jika Redis belum bisa dihubungi, subscription tetap dibuka: go-redis berlangganan ulang
+// setelah koneksi pulih. Error hanya dikembalikan jika ctx selesai lebih dulu.
+func (rs *RedisStorage) Subscribe(ctx context.Context, channel string) (<-chan string, error) {
+	pubsub := rs.Client.Subscribe(ctx, channel)
+	if _, err := pubsub.Receive(ctx); err != nil && ctx.Err() != nil {
+		pubsub.Close()
+		return nil, ctx.Err()
+	}
+
+	payloads := make(chan string)
+	go func() {
+		defer close(payloads)
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				select {
+				case payloads <- msg.Payload:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return payloads, nil
+}
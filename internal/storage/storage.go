@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrNotFound dikembalikan oleh Storage.Get jika key tidak ada (atau sudah expire)
+var ErrNotFound = errors.New("storage: key not found")
+
+// Storage adalah backend penyimpanan state rate limiter.
+// Semua update state dijalankan lewat Eval agar read-compute-write tetap atomik.
+type Storage interface {
+	// Eval menjalankan script secara atomik terhadap keys dan mengembalikan reply-nya
+	Eval(ctx context.Context, script *Script, keys []string, args ...interface{}) ([]interface{}, error)
+
+	// Get membaca nilai key (ErrNotFound jika tidak ada)
+	Get(ctx context.Context, key string) (string, error)
+
+	// HGetAll membaca semua field hash (map kosong jika key tidak ada)
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+
+	// ZCount menghitung member sorted set dengan score > min (0 jika key tidak ada)
+	ZCount(ctx context.Context, key string, min float64) (int64, error)
+
+	// Del menghapus satu atau lebih key
+	Del(ctx context.Context, keys ...string) error
+
+	// Keys mencari key yang cocok dengan glob pattern (misalnya "bucket:{*}"); hasilnya bisa berisi duplikat
+	Keys(ctx context.Context, pattern string) ([]string, error)
+
+	// Time mengembalikan jam backend (TIME di Redis, jam lokal untuk MemoryStorage)
+	Time(ctx context.Context) (time.Time, error)
+}
+
+// Subscriber diimplementasi backend yang mendukung pub/sub (RedisStorage; MemoryStorage tidak,
+// karena hanya dipakai satu proses). Script mengirim pesan dengan PUBLISH.
+type Subscriber interface {
+	// Subscribe berlangganan channel dan kembali setelah subscription dikonfirmasi (atau ctx selesai).
+	// Channel hasil menerima payload setiap pesan dan ditutup setelah ctx selesai.
+	Subscribe(ctx context.Context, channel string) (<-chan string, error)
+}
+
+// Script adalah Lua script yang dijalankan oleh Storage.Eval.
+// Backend tanpa Lua (MemoryStorage) menjalankan implementasi Go yang dipasang lewat WithLocal.
+type Script struct {
+	redis *redis.Script
+	local LocalFunc
+}
+
+// LocalFunc adalah implementasi Go dari sebuah Script.
+// Menerima keys dan args yang sama dengan Lua script, dan harus mengembalikan reply dengan format yang sama.
+type LocalFunc func(tx Tx, keys []string, args []interface{}) ([]interface{}, error)
+
+// Tx memberi LocalFunc akses ke keys milik Eval yang sedang berjalan (hanya keys yang dikirim ke Eval)
+type Tx interface {
+	// Get membaca nilai key (false jika tidak ada atau sudah expire)
+	Get(key string) (string, bool)
+
+	// Set menulis nilai key dengan TTL (0 = tanpa expiry)
+	Set(key, value string, ttl time.Duration)
+
+	// HGet membaca satu field hash (false jika key atau field tidak ada)
+	HGet(key, field string) (string, bool)
+
+	// HSet menulis field hash dan mengganti TTL seluruh key (0 = tanpa expiry)
+	HSet(key string, fields map[string]string, ttl time.Duration)
+
+	// Del menghapus key
+	Del(key string)
+
+	// ZAdd menambahkan member sorted set (member -> score) dan mengganti TTL seluruh key (0 = tanpa expiry)
+	ZAdd(key string, members map[string]float64, ttl time.Duration)
+
+	// ZRem menghapus member dari sorted set
+	ZRem(key string, members ...string)
+
+	// ZRemRangeByScore menghapus semua member dengan score <= max
+	ZRemRangeByScore(key string, max float64)
+
+	// ZScores mengembalikan score semua member, urut dari kecil ke besar (seperti ZRANGE ... WITHSCORES)
+	ZScores(key string) []float64
+}
+
+// NewScript membuat Script dari source Lua
+func NewScript(src string) *Script {
+	return &Script{redis: redis.NewScript(src)}
+}
+
+// WithLocal memasang implementasi Go untuk backend tanpa Lua dan mengembalikan script yang sama
+func (s *Script) WithLocal(fn LocalFunc) *Script {
+	s.local = fn
+	return s
+}
+
+// Hash mengembalikan SHA1 dari source script (dipakai EVALSHA)
+func (s *Script) Hash() string {
+	return s.redis.Hash()
+}
+
+// Default mengembalikan Storage Redis di atas RedisClient global.
+// Dipakai limiter yang tidak diberi Storage secara eksplisit.
+func Default() Storage {
+	return NewRedisStorage(RedisClient)
+}
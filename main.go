@@ -1,10 +1,22 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"github.com/user/Rate-Limiting-API/internal/dashboard"
 	"github.com/user/Rate-Limiting-API/internal/limiter"
 	"github.com/user/Rate-Limiting-API/internal/middleware"
@@ -25,21 +37,92 @@ var funcMap = template.FuncMap{
 }
 
 func main() {
-	// Initialize Redis connection
-	storage.InitRedis("localhost:6379", "", 0)
+	// Storage backend dipilih saat startup: STORAGE_BACKEND=memory untuk single-node tanpa Redis
+	useRedis := os.Getenv("STORAGE_BACKEND") != "memory"
+
+	// Optional key prefix so several services can share one Redis (keys become "<namespace>:bucket:{...}")
+	namespace := os.Getenv("RATE_LIMIT_NAMESPACE")
+
+	var store storage.Storage
+	var clock limiter.Clock = limiter.SystemClock{}
+	if useRedis {
+		// Initialize Redis connection (single node, Cluster or Sentinel - see redisOptionsFromEnv)
+		storage.InitRedisUniversal(redisOptionsFromEnv())
+		store = storage.NewRedisStorage(storage.RedisClient)
+
+		// One-shot migration of bucket state from the old two-key layout to one hash per client
+		if os.Getenv("MIGRATE_BUCKET_KEYS") == "true" {
+			migrated, err := limiter.MigrateBucketKeys(context.Background(), store, limiter.WithNamespace(namespace))
+			if err != nil {
+				log.Fatalf("bucket key migration failed: %v", err)
+			}
+			log.Printf("Migrated %d bucket keys to hash layout", migrated)
+		}
+
+		// Use Redis server time so every API instance computes leak/refill from the same clock
+		// (offset to the local clock is re-synced every 30 seconds)
+		clock = limiter.NewRedisClock(30*time.Second, limiter.WithStorage(store))
+	} else {
+		// In-process state: expired keys are swept every minute
+		memoryStore := storage.NewMemoryStorage(time.Minute)
+		defer memoryStore.Close()
+		store = memoryStore
+	}
 
 	// Create both rate limiting algorithm instances
 	// Leaky Bucket: Capacity 10, LeakRate 2/sec, TTL 1 hour
-	leakyBucket := limiter.NewLeakyBucket(10, 2, time.Hour)
+	leakyBucket := limiter.NewLeakyBucket(10, 2, time.Hour, limiter.WithStorage(store))
 
 	// Token Bucket: Capacity 10, RefillRate 2/sec, TTL 1 hour
-	tokenBucket := limiter.NewTokenBucket(10, 2, time.Hour)
+	// TOKEN_LEASE_SIZE > 0 claims that many tokens per storage round trip, served locally for up to 200ms
+	tokenBucket := limiter.NewTokenBucket(10, 2, time.Hour, limiter.WithStorage(store))
+	if leaseSize, _ := strconv.ParseInt(os.Getenv("TOKEN_LEASE_SIZE"), 10, 64); leaseSize > 0 {
+		tokenBucket = limiter.NewLeasingTokenBucket(10, 2, time.Hour, leaseSize, 200*time.Millisecond, limiter.WithStorage(store))
+	}
+	defer tokenBucket.Close()
+
+	// Create LimiterManager with both algorithms, default to leaky_bucket (all sharing the same clock and namespace)
+	limiterManager := limiter.NewLimiterManager(leakyBucket, tokenBucket, limiter.AlgorithmLeakyBucket,
+		limiter.WithClock(clock), limiter.WithNamespace(namespace))
+
+	// Fixed Window: 10 requests per 10-second window
+	limiterManager.SetFixedWindow(limiter.NewFixedWindow(10, 10*time.Second, limiter.WithStorage(store)))
+
+	// Sliding Window Log: 10 requests in any rolling 10 seconds
+	limiterManager.SetSlidingWindowLog(limiter.NewSlidingWindowLog(10, 10*time.Second, limiter.WithStorage(store)))
+
+	// Sliding Window Counter: ~10 requests per rolling 10 seconds, O(1) storage per key
+	limiterManager.SetSlidingWindowCounter(limiter.NewSlidingWindowCounter(10, 10*time.Second, limiter.WithStorage(store)))
 
-	// Create LimiterManager with both algorithms, default to leaky_bucket
-	limiterManager := limiter.NewLimiterManager(leakyBucket, tokenBucket, "leaky_bucket")
+	// GCRA: burst 10, 2 requests/sec sustained, single key per client
+	limiterManager.SetGCRA(limiter.NewGCRA(10, 2, limiter.WithStorage(store)))
+
+	// Concurrency: max 2 in-flight exports per client, leaked slots expire after 1 minute
+	exportLimiter := limiter.NewConcurrencyLimiter(2, time.Minute,
+		limiter.WithClock(clock), limiter.WithStorage(store), limiter.WithNamespace(namespace))
+
+	// API limiter chain: deny cache -> circuit breaker -> manager
+	// Stop calling the storage after 5 consecutive errors, probe again after 10 seconds
+	breaker := limiter.NewCircuitBreaker(limiterManager, 5, 10*time.Second)
+
+	// Remember up to 10k blocked clients so they cost no storage round trip while limited
+	denyCache := limiter.NewDenyCache(breaker, 10000)
+	limiterManager.OnChange(denyCache.Clear) // Cached denials were computed with the old algorithm or parameters
+
+	// Share the active algorithm and its parameters with every instance on this storage
+	// (changes arrive over Redis pub/sub; with the memory backend there is only this instance,
+	// but the dashboard still shows it)
+	clusterSync := limiter.NewClusterSync(limiterManager, instanceIDFromEnv(),
+		limiter.WithClock(clock), limiter.WithStorage(store), limiter.WithNamespace(namespace))
+
+	// Stopped on SIGINT/SIGTERM: in-flight requests finish, then leased tokens go back to the storage
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go clusterSync.Run(ctx)
 
 	// Create dashboard handler with manager
-	dashboardHandler := dashboard.NewHandler(limiterManager)
+	dashboardHandler := dashboard.NewHandler(limiterManager, store,
+		dashboard.WithDenyCache(denyCache), dashboard.WithClusterSync(clusterSync))
 
 	r := gin.Default()
 
@@ -68,11 +151,24 @@ func main() {
 		// Algorithm switching endpoints
 		dashboardGroup.GET("/algorithm", dashboardHandler.GetAlgorithm)
 		dashboardGroup.POST("/algorithm", dashboardHandler.SetAlgorithm)
+		dashboardGroup.POST("/config", dashboardHandler.UpdateConfig) // Live capacity/rate/TTL changes
+		dashboardGroup.GET("/deny-cache", dashboardHandler.GetDenyCacheStats)
+		dashboardGroup.GET("/instances", dashboardHandler.GetInstances) // Which instances applied the last change
 	}
 
 	// API routes dengan rate limiting (uses the manager which delegates to active algorithm)
+	// While the storage fails (or the breaker is open) requests are handled by
+	// RATE_LIMIT_ON_ERROR (default: a local in-memory bucket)
+	fallbackStore := storage.NewMemoryStorage(time.Minute)
+	defer fallbackStore.Close()
+	apiLimit := middleware.RateLimitWithConfig(middleware.RateLimitConfig{
+		Limiter:  denyCache,
+		KeyFunc:  middleware.DefaultKeyFunc,
+		OnError:  failurePolicyFromEnv(),
+		Fallback: limiter.NewLeakyBucket(10, 2, time.Hour, limiter.WithStorage(fallbackStore)),
+	})
 	apiGroup := r.Group("/api")
-	apiGroup.Use(middleware.RateLimit(limiterManager))
+	apiGroup.Use(apiLimit)
 	{
 		apiGroup.GET("/ping", func(c *gin.Context) {
 			c.JSON(200, gin.H{
@@ -90,6 +186,19 @@ func main() {
 		})
 	}
 
+	// Export routes dengan concurrency limiting (dibatasi request in-flight, bukan rate)
+	exportGroup := r.Group("/export")
+	exportGroup.Use(middleware.ConcurrencyLimit(exportLimiter))
+	{
+		exportGroup.GET("/report", func(c *gin.Context) {
+			time.Sleep(2 * time.Second) // Simulasi export yang lambat
+			c.JSON(200, gin.H{
+				"report": "This is a slow report export",
+				"time":   time.Now().Format(time.RFC3339),
+			})
+		})
+	}
+
 	// Public endpoint (tanpa rate limiting)
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{
@@ -97,5 +206,67 @@ func main() {
 		})
 	})
 
-	r.Run(":8080")
+	srv := &http.Server{Addr: ":8080", Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server failed: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("server shutdown: %v", err)
+	}
+	if err := tokenBucket.ReturnLeases(shutdownCtx); err != nil {
+		log.Printf("returning token leases: %v", err)
+	}
+}
+
+// redisOptionsFromEnv membaca konfigurasi Redis dari environment:
+// REDIS_ADDRS (dipisah koma, default localhost:6379; lebih dari satu = Cluster),
+// REDIS_MASTER_NAME (Sentinel), REDIS_USERNAME (ACL), REDIS_PASSWORD, REDIS_TLS=true
+func redisOptionsFromEnv() *redis.UniversalOptions {
+	addrs := []string{"localhost:6379"}
+	if env := os.Getenv("REDIS_ADDRS"); env != "" {
+		addrs = strings.Split(env, ",")
+	}
+
+	opts := &redis.UniversalOptions{
+		Addrs:      addrs,
+		MasterName: os.Getenv("REDIS_MASTER_NAME"),
+		Username:   os.Getenv("REDIS_USERNAME"),
+		Password:   os.Getenv("REDIS_PASSWORD"),
+	}
+	if os.Getenv("REDIS_TLS") == "true" {
+		opts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return opts
+}
+
+// instanceIDFromEnv membaca INSTANCE_ID; default hostname-pid agar unik per proses
+func instanceIDFromEnv() string {
+	if id := os.Getenv("INSTANCE_ID"); id != "" {
+		return id
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// failurePolicyFromEnv membaca RATE_LIMIT_ON_ERROR: "open", "closed" atau "fallback" (default)
+func failurePolicyFromEnv() middleware.FailurePolicy {
+	switch os.Getenv("RATE_LIMIT_ON_ERROR") {
+	case "open":
+		return middleware.FailOpen
+	case "closed":
+		return middleware.FailClosed
+	default:
+		return middleware.FailFallback
+	}
 }